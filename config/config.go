@@ -6,15 +6,22 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	Database DatabaseConfig `json:"database"`
-	JWT      JWTConfig      `json:"jwt"`
-	Email    EmailConfig    `json:"email"`
+	Server       ServerConfig       `json:"server"`
+	Database     DatabaseConfig     `json:"database"`
+	JWT          JWTConfig          `json:"jwt"`
+	Email        EmailConfig        `json:"email"`
+	Notification NotificationConfig `json:"notification"`
+	Security     SecurityConfig     `json:"security"`
+	Secrets      SecretsConfig      `json:"secrets"`
+	SSH          SSHConfig          `json:"ssh"`
+	Pool         PoolConfig         `json:"connection_pool"`
+	SQLite       SQLiteConfig       `json:"sqlite"`
 }
 
 type ServerConfig struct {
-	Port string `json:"port"`
-	Mode string `json:"mode"` // debug, release
+	Port    string `json:"port"`
+	Mode    string `json:"mode"`     // debug, release
+	BaseURL string `json:"base_url"` // 对外访问地址（如 https://sync.example.com），用于生成邮件中的链接
 }
 
 type DatabaseConfig struct {
@@ -23,7 +30,14 @@ type DatabaseConfig struct {
 	Port     string `json:"port"`
 	User     string `json:"user"`
 	Password string `json:"password"`
-	DBName   string `json:"dbname"`
+	DBName   string `json:"dbname"` // sqlite 为数据库文件路径
+
+	TLSMode       string            `json:"tls_mode"`        // disable, require, verify-ca, verify-full
+	TLSCAFile     string            `json:"tls_ca_file"`     // CA证书文件（PEM）
+	TLSCertFile   string            `json:"tls_cert_file"`   // 客户端证书文件（PEM）
+	TLSKeyFile    string            `json:"tls_key_file"`    // 客户端私钥文件（PEM）
+	TLSServerName string            `json:"tls_server_name"` // 校验的服务器名称，为空时使用Host
+	Params        map[string]string `json:"params"`          // 额外的DSN参数，可覆盖默认参数
 }
 
 type JWTConfig struct {
@@ -37,6 +51,53 @@ type EmailConfig struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	From     string `json:"from"`
+
+	TemplateDir string `json:"template_dir"` // 自定义邮件模板目录，存在同名模板时覆盖内置模板
+}
+
+type NotificationConfig struct {
+	DigestInterval int    `json:"digest_interval"` // 摘要发送间隔（分钟），默认30
+	WebhookURL     string `json:"webhook_url"`     // webhook渠道默认地址
+	FilePath       string `json:"file_path"`       // file渠道默认输出文件，空或"-"表示标准输出
+
+	WebhookAllowlist []string `json:"webhook_allowlist"` // 普通用户可订阅的webhook地址（同协议、同主机且路径前缀匹配），管理员不受限制
+	FileDirs         []string `json:"file_dirs"`         // 普通用户file渠道允许写入的目录，管理员不受限制
+}
+
+type SecurityConfig struct {
+	MasterKey          string   `json:"master_key"`           // 加密数据库连接密码的主密钥（base64编码的32字节），环境变量 DB_SYNC_MASTER_KEY 优先
+	PreviousMasterKeys []string `json:"previous_master_keys"` // 轮换前的主密钥，仅用于解密，环境变量 DB_SYNC_PREVIOUS_MASTER_KEYS 优先
+}
+
+type SecretsConfig struct {
+	CacheTTL  int         `json:"cache_ttl"`  // 外部密钥缓存时间（秒），默认300
+	EnvPrefix string      `json:"env_prefix"` // env引用允许读取的环境变量前缀，默认 DB_SYNC_SECRET_
+	FileDirs  []string    `json:"file_dirs"`  // file引用允许读取的目录，未配置时禁止读取文件
+	Vault     VaultConfig `json:"vault"`
+}
+
+type VaultConfig struct {
+	Address   string `json:"address"`   // Vault地址，为空时使用环境变量 VAULT_ADDR
+	Token     string `json:"token"`     // 访问token，为空时使用环境变量 VAULT_TOKEN
+	Namespace string `json:"namespace"` // Vault企业版命名空间（可选）
+}
+
+type SSHConfig struct {
+	KnownHostsFile string `json:"known_hosts_file"` // 连接未配置主机公钥时使用的known_hosts文件，默认 ~/.ssh/known_hosts
+}
+
+// PoolConfig 数据库连接池配置，时间单位为秒
+type PoolConfig struct {
+	MaxOpenConns    int `json:"max_open_conns"`     // 每个连接最大打开连接数，默认10
+	MaxIdleConns    int `json:"max_idle_conns"`     // 每个连接最大空闲连接数，默认2
+	ConnMaxLifetime int `json:"conn_max_lifetime"`  // 单个连接最长使用时间，默认1800
+	ConnMaxIdleTime int `json:"conn_max_idle_time"` // 单个连接最长空闲时间，默认300
+	IdleTimeout     int `json:"idle_timeout"`       // 连接池未被使用超过此时间后关闭，默认600
+}
+
+// SQLiteConfig SQLite类型数据库连接的配置（不影响系统数据库）
+type SQLiteConfig struct {
+	DataDirs []string `json:"data_dirs"` // 允许连接的SQLite数据库文件所在目录，未配置时禁止添加SQLite连接
 }
 
 var GlobalConfig *Config
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/utils"
+)
+
+// encryptConnectionPasswords 加密历史明文保存的数据库连接密码及SSH凭据（启动时执行）
+func encryptConnectionPasswords() error {
+	if !utils.SecretEncryptionEnabled() {
+		return nil
+	}
+
+	var connections []models.DatabaseConnection
+	if err := DB.Find(&connections).Error; err != nil {
+		return err
+	}
+
+	count := 0
+	for i := range connections {
+		updates := map[string]interface{}{}
+		for column, field := range connections[i].SecretFields() {
+			if *field == "" || utils.IsEncryptedSecret(*field) {
+				continue
+			}
+			encrypted, err := utils.EncryptSecret(*field)
+			if err != nil {
+				return fmt.Errorf("加密连接 %d 的 %s 失败: %v", connections[i].ID, column, err)
+			}
+			updates[column] = encrypted
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := DB.Model(&connections[i]).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("已加密 %d 个数据库连接的密码", count)
+	}
+	return nil
+}
+
+// RotateConnectionPasswords 使用当前主密钥重新加密所有数据库连接密码及SSH凭据，全部成功才提交
+func RotateConnectionPasswords() (int, error) {
+	if !utils.SecretEncryptionEnabled() {
+		return 0, utils.ErrMasterKeyMissing
+	}
+
+	count := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var connections []models.DatabaseConnection
+		if err := tx.Find(&connections).Error; err != nil {
+			return err
+		}
+
+		for i := range connections {
+			updates := map[string]interface{}{}
+			for column, field := range connections[i].SecretFields() {
+				if *field == "" {
+					continue
+				}
+				encrypted, err := utils.ReencryptSecret(*field)
+				if err != nil {
+					return fmt.Errorf("重新加密连接 %d（%s）的 %s 失败: %v", connections[i].ID, connections[i].Name, column, err)
+				}
+				updates[column] = encrypted
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			if err := tx.Model(&connections[i]).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
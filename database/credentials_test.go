@@ -0,0 +1,100 @@
+package database
+
+import (
+	"bytes"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/utils"
+)
+
+// oldSecret 使用旧主密钥（32个0x01字节）加密的 "secret"
+const oldSecret = "enc:v1:72cd6e8422c407fb:PZqcwh3nsrKUuk+k+WPWrw/Hx00TUmtfAmT/GInYEq65ZaxmJgdmd4xh8ibY/V8+Vptds4JX4lKFyPjU:T8NcX/3DM0BcG8YRi/UzgtbIBpF+c6Pv/A3LbRUjqd1p7Q=="
+
+// 主密钥只加载一次，本包中的测试共用同一组密钥：当前为新主密钥，旧主密钥仅用于解密
+func TestRotateConnectionPasswords(t *testing.T) {
+	t.Setenv(utils.MasterKeyEnv, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)))
+	t.Setenv(utils.PreviousMasterKeyEnv, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+
+	prev := config.GlobalConfig
+	config.GlobalConfig = &config.Config{
+		Database: config.DatabaseConfig{Type: "sqlite", DBName: filepath.Join(t.TempDir(), "system.db")},
+	}
+	defer func() { config.GlobalConfig = prev }()
+	if err := InitDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if sqlDB, err := DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	// 绕过 BeforeSave 写入历史数据：旧主密钥加密的密码和明文保存的SSH密码
+	create := func(name string, columns map[string]interface{}) uint {
+		conn := models.DatabaseConnection{Name: name, Type: "sqlite", Database: name}
+		if err := DB.Create(&conn).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := DB.Model(&conn).UpdateColumns(columns).Error; err != nil {
+			t.Fatal(err)
+		}
+		return conn.ID
+	}
+	legacy := create("legacy", map[string]interface{}{"password": oldSecret, "ssh_password": "plain"})
+	empty := create("empty", map[string]interface{}{"password": ""})
+
+	// 启动时加密明文保存的凭据
+	if err := encryptConnectionPasswords(); err != nil {
+		t.Fatal(err)
+	}
+	conn := reloadConnection(t, legacy)
+	if !utils.IsEncryptedSecret(conn.SSHPassword) || conn.Password != oldSecret {
+		t.Fatalf("password = %s, ssh_password = %s", conn.Password, conn.SSHPassword)
+	}
+
+	// 任一密文无法解密时不提交任何修改
+	broken := create("broken", map[string]interface{}{"password": "enc:v1:0000000000000000:AAAA:AAAA"})
+	if _, err := RotateConnectionPasswords(); err == nil {
+		t.Fatal("无法解密的密文应使轮换失败")
+	}
+	conn = reloadConnection(t, legacy)
+	if conn.Password != oldSecret {
+		t.Error("轮换失败时不应修改已有密文")
+	}
+	DB.Delete(&models.DatabaseConnection{}, broken)
+
+	count, err := RotateConnectionPasswords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("重新加密了 %d 个连接, want 1", count)
+	}
+	conn = reloadConnection(t, legacy)
+	if strings.HasPrefix(conn.Password, "enc:v1:72cd6e8422c407fb:") {
+		t.Errorf("密码仍使用旧主密钥加密: %s", conn.Password)
+	}
+	if plain, err := utils.DecryptSecret(conn.Password); err != nil || plain != "secret" {
+		t.Errorf("password = %q, %v", plain, err)
+	}
+	if plain, err := utils.DecryptSecret(conn.SSHPassword); err != nil || plain != "plain" {
+		t.Errorf("ssh_password = %q, %v", plain, err)
+	}
+	if conn := reloadConnection(t, empty); conn.Password != "" {
+		t.Errorf("空密码不应被加密: %s", conn.Password)
+	}
+}
+
+func reloadConnection(t *testing.T, id uint) models.DatabaseConnection {
+	t.Helper()
+	var conn models.DatabaseConnection
+	if err := DB.First(&conn, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
@@ -2,11 +2,11 @@ package database
 
 import (
 	"fmt"
+	"os"
 	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/dbconn"
 	"zh.xyz/dv/sync/models"
 
-	"gorm.io/driver/mysql"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"zh.xyz/dv/sync/utils"
@@ -16,26 +16,14 @@ var DB *gorm.DB
 
 // InitDatabase 初始化数据库连接
 func InitDatabase() error {
-	var err error
 	cfg := config.GlobalConfig.Database
 
-	var dsn string
-	var dialector gorm.Dialector
-
-	switch cfg.Type {
-	case "mysql":
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-			cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
-		dialector = mysql.Open(dsn)
-	case "postgres":
-		dsn = fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Shanghai",
-			cfg.Host, cfg.User, cfg.Password, cfg.DBName, cfg.Port)
-		dialector = postgres.Open(dsn)
-	default:
-		return fmt.Errorf("unsupported database type: %s", cfg.Type)
+	opts, err := connOptions(&cfg)
+	if err != nil {
+		return err
 	}
 
-	DB, err = gorm.Open(dialector, &gorm.Config{
+	DB, err = dbconn.OpenGorm(opts, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 
@@ -48,22 +36,77 @@ func InitDatabase() error {
 		&models.User{},
 		&models.DatabaseConnection{},
 		&models.SyncTask{},
+		&models.SyncTaskTarget{},
 		&models.DataConflict{},
+		&models.ConflictBulkJob{},
+		&models.ConflictActionToken{},
 		&models.SyncLog{},
+		&models.SyncRowState{},
+		&models.DeadLetterRow{},
 		&models.DatabaseObject{},
 		&models.ObjectSyncLog{},
+		&models.NotificationSubscription{},
+		&models.PendingNotification{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
 	)
 
 	if err != nil {
 		return err
 	}
 
+	// 加密历史明文保存的连接密码
+	if err := encryptConnectionPasswords(); err != nil {
+		return fmt.Errorf("加密数据库连接密码失败: %v", err)
+	}
+
+	// 为多目标同步迁移历史任务的目标库、冲突记录和行同步状态
+	if err := migrateTaskTargets(); err != nil {
+		return fmt.Errorf("迁移同步任务目标库失败: %v", err)
+	}
+
 	// 创建默认管理员账户（如果不存在）
 	createDefaultAdmin()
 
 	return nil
 }
 
+// connOptions 根据系统数据库配置生成连接参数，证书和私钥从文件读取
+func connOptions(cfg *config.DatabaseConfig) (*dbconn.ConnOptions, error) {
+	opts := &dbconn.ConnOptions{
+		Type:     cfg.Type,
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.User,
+		Password: cfg.Password,
+		Database: cfg.DBName,
+		TLS: dbconn.TLSOptions{
+			Mode:       cfg.TLSMode,
+			ServerName: cfg.TLSServerName,
+		},
+		Params: cfg.Params,
+	}
+
+	for _, f := range []struct {
+		path   string
+		target *string
+	}{
+		{cfg.TLSCAFile, &opts.TLS.CACert},
+		{cfg.TLSCertFile, &opts.TLS.ClientCert},
+		{cfg.TLSKeyFile, &opts.TLS.ClientKey},
+	} {
+		if f.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("读取TLS证书文件失败: %v", err)
+		}
+		*f.target = string(data)
+	}
+	return opts, nil
+}
+
 func createDefaultAdmin() {
 	var admin models.User
 	result := DB.Where("username = ?", "admin").First(&admin)
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"zh.xyz/dv/sync/models"
+)
+
+// migrateTaskTargets 将单目标任务迁移为多目标结构（启动时执行，可重复执行）：
+// 为没有目标库记录的任务创建目标库记录，并为历史冲突记录和行同步状态补充目标库ID
+func migrateTaskTargets() error {
+	// 旧的行同步状态唯一索引不含目标库，会阻止同一行在多个目标库的状态
+	if DB.Migrator().HasIndex(&models.SyncRowState{}, "idx_sync_row_state") {
+		if err := DB.Migrator().DropIndex(&models.SyncRowState{}, "idx_sync_row_state"); err != nil {
+			return err
+		}
+	}
+
+	var tasks []models.SyncTask
+	if err := DB.Where("id NOT IN (?)", DB.Model(&models.SyncTaskTarget{}).Select("task_id")).Find(&tasks).Error; err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		target := models.SyncTaskTarget{TaskID: task.ID, TargetDBID: task.TargetDBID}
+		if err := DB.Create(&target).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, table := range []string{"data_conflicts", "sync_row_states"} {
+		err := DB.Exec("UPDATE " + table + " SET target_db_id = (SELECT t.target_db_id FROM sync_tasks t WHERE t.id = " + table + ".task_id)" +
+			" WHERE target_db_id = 0 AND task_id IN (SELECT id FROM sync_tasks)").Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package dbconn
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BulkLoader 支持批量装载协议的方言（如 PostgreSQL COPY、MySQL LOAD DATA），用于向空表首次同步大量数据
+// 装载使用同一个连接，以便会话级设置在装载期间生效
+type BulkLoader interface {
+	// BulkLoad 将 next 依次返回的行（值按 columns 顺序排列，返回 nil 表示结束）装载到表中，返回装载的行数
+	BulkLoad(conn *sql.Conn, table string, columns []string, next func() ([]interface{}, error)) (int64, error)
+	// DisableIndexes 装载前删除表的二级索引并禁用触发器，返回装载后重建索引、恢复触发器的函数
+	DisableIndexes(conn *sql.Conn, table string) (func() error, error)
+}
+
+// bulkTextEscaper 转义批量装载文本格式（制表符分隔、反斜杠转义）中的特殊字符
+var bulkTextEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`)
+
+// bulkTextNull 文本格式中的NULL
+const bulkTextNull = `\N`
+
+// writeBulkText 将 next 返回的行按文本格式（字段以制表符分隔、行以换行符结束）写入 w，format 将非NULL值格式化为未转义的文本
+func writeBulkText(w io.Writer, next func() ([]interface{}, error), format func(val interface{}) string) error {
+	buf := bufio.NewWriterSize(w, 64*1024)
+	for {
+		row, err := next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		for i, val := range row {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			if val == nil {
+				buf.WriteString(bulkTextNull)
+				continue
+			}
+			bulkTextEscaper.WriteString(buf, format(val))
+		}
+		if err := buf.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// formatBulkValue 按文本格式化值，时间按 timeLayout 格式化
+func formatBulkValue(val interface{}, timeLayout string, trueValue, falseValue string) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(timeLayout)
+	case bool:
+		if v {
+			return trueValue
+		}
+		return falseValue
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
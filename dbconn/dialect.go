@@ -0,0 +1,316 @@
+package dbconn
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/models"
+)
+
+// Executor 执行SQL的对象，*sql.DB 和 *sql.Tx 都满足
+type Executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Dialect 数据库方言，封装与数据库类型相关的连接、SQL生成、元数据查询、批量写入和对象目录逻辑
+// 新增数据库类型只需实现该接口并调用 RegisterDialect 注册
+type Dialect interface {
+	// Name 数据库类型，与 DatabaseConnection.Type 一致
+	Name() string
+
+	// ConnOptions 根据连接配置生成打开连接所需的参数（解析密码、校验额外参数、建立SSH隧道等）
+	ConnOptions(dbConn *models.DatabaseConnection) (*ConnOptions, error)
+	// ValidateExtraParams 校验连接的额外DSN参数，不在允许列表中的参数返回错误
+	ValidateExtraParams(params map[string]string) error
+	// Open 按连接参数打开原生连接
+	Open(opts *ConnOptions) (*sql.DB, error)
+	// GormDialector 基于已打开的连接创建GORM方言，不支持GORM时返回nil
+	GormDialector(db *sql.DB) gorm.Dialector
+
+	// QuoteIdentifier 引用表名、列名等标识符
+	QuoteIdentifier(name string) string
+	// Placeholder 第n个（从1开始）绑定参数的占位符
+	Placeholder(n int) string
+	// LimitOffset 分页子句，追加在查询末尾
+	LimitOffset(limit, offset int) string
+	// SelectForUpdate 查询并锁定表中满足条件的行，table 已引用
+	SelectForUpdate(table, where string) string
+	// NormalizeStatement 执行用户输入的SQL前的处理
+	NormalizeStatement(query string) string
+	// ConvertValue 将驱动返回的特殊值转换为通用格式，typeName 为列的数据库类型名
+	ConvertValue(typeName string, val interface{}) interface{}
+
+	// Tables 列出当前数据库（schema）的所有表
+	Tables(db Executor) ([]string, error)
+	// PrimaryKeys 按顺序返回表的主键列
+	PrimaryKeys(db Executor, table string) ([]string, error)
+	// TableExists 判断表是否存在
+	TableExists(db Executor, table string) (bool, error)
+
+	// MaxParams 单条语句最多绑定的参数个数，0 表示不限制；批量写入的行数 × 列数不能超过该值
+	MaxParams() int
+	// Upsert 批量写入，主键已存在时更新、不存在时插入，无主键时只插入；rows 中的值按 columns 顺序排列
+	Upsert(db Executor, table string, columns, primaryKeys []string, rows [][]interface{}) error
+
+	// ObjectsQuery 列出存储过程、函数、视图或触发器的查询，数据库没有该类对象时返回空字符串
+	// 触发器返回（名称, 所属表, schema），其他对象返回（名称, schema）
+	ObjectsQuery(objType, dbName string) (string, []interface{})
+	// ObjectDefinition 获取对象可直接执行的创建语句
+	ObjectDefinition(db Executor, objType, name string) (string, error)
+	// DropObjectSQL 删除对象的语句，不支持时返回空字符串
+	DropObjectSQL(objType, name, table string) string
+}
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]Dialect{
+		"mysql":     mysqlDialect{baseDialect{"mysql"}},
+		"postgres":  postgresDialect{baseDialect{"postgres"}},
+		"oracle":    oracleDialect{baseDialect{"oracle"}},
+		"sqlserver": sqlServerDialect{baseDialect{"sqlserver"}},
+		"sqlite":    sqliteDialect{baseDialect{"sqlite"}},
+	}
+)
+
+// RegisterDialect 注册数据库方言（同名会被替换）
+func RegisterDialect(d Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[d.Name()] = d
+}
+
+// GetDialect 获取数据库类型对应的方言
+func GetDialect(dbType string) (Dialect, error) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	d, ok := dialects[dbType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	return d, nil
+}
+
+// DialectFor 获取数据库类型对应的方言，未注册的类型返回只支持通用SQL的默认方言
+func DialectFor(dbType string) Dialect {
+	if d, err := GetDialect(dbType); err == nil {
+		return d
+	}
+	return baseDialect{dbType}
+}
+
+// DialectNames 返回已注册的数据库类型
+func DialectNames() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TableColumns 获取表的列名列表
+func TableColumns(db Executor, d Dialect, table string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", d.QuoteIdentifier(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return rows.Columns()
+}
+
+// TableEmpty 判断表是否没有数据
+func TableEmpty(db Executor, d Dialect, table string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT 1 FROM %s %s", d.QuoteIdentifier(table), d.LimitOffset(1, 0)))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return !rows.Next(), rows.Err()
+}
+
+// ColumnTypeNames 返回结果集各列的数据库类型名，供 Dialect.ConvertValue 使用
+func ColumnTypeNames(rows *sql.Rows) []string {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.DatabaseTypeName()
+	}
+	return names
+}
+
+// baseDialect 各方言共用的默认实现（标准SQL），也用作未注册类型的方言
+type baseDialect struct {
+	name string
+}
+
+func (d baseDialect) Name() string { return d.name }
+
+func (d baseDialect) ConnOptions(dbConn *models.DatabaseConnection) (*ConnOptions, error) {
+	return nil, d.unsupported()
+}
+
+// ValidateExtraParams 默认不允许任何额外参数
+func (d baseDialect) ValidateExtraParams(params map[string]string) error {
+	return checkExtraParams(params, nil, false)
+}
+
+func (d baseDialect) Open(opts *ConnOptions) (*sql.DB, error) {
+	return nil, d.unsupported()
+}
+
+func (d baseDialect) GormDialector(db *sql.DB) gorm.Dialector { return nil }
+
+func (d baseDialect) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (d baseDialect) Placeholder(n int) string { return "?" }
+
+func (d baseDialect) LimitOffset(limit, offset int) string {
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
+
+func (d baseDialect) SelectForUpdate(table, where string) string {
+	return fmt.Sprintf("SELECT * FROM %s WHERE %s FOR UPDATE", table, where)
+}
+
+func (d baseDialect) NormalizeStatement(query string) string { return query }
+
+func (d baseDialect) ConvertValue(typeName string, val interface{}) interface{} { return val }
+
+func (d baseDialect) Tables(db Executor) ([]string, error) { return nil, d.unsupported() }
+
+func (d baseDialect) PrimaryKeys(db Executor, table string) ([]string, error) {
+	return nil, d.unsupported()
+}
+
+func (d baseDialect) TableExists(db Executor, table string) (bool, error) {
+	return false, d.unsupported()
+}
+
+func (d baseDialect) MaxParams() int { return 0 }
+
+func (d baseDialect) Upsert(db Executor, table string, columns, primaryKeys []string, rows [][]interface{}) error {
+	return fmt.Errorf("不支持的数据库类型: %s", d.name)
+}
+
+func (d baseDialect) ObjectsQuery(objType, dbName string) (string, []interface{}) { return "", nil }
+
+func (d baseDialect) ObjectDefinition(db Executor, objType, name string) (string, error) {
+	return "", fmt.Errorf("不支持获取%s的定义", objType)
+}
+
+func (d baseDialect) DropObjectSQL(objType, name, table string) string { return "" }
+
+func (d baseDialect) unsupported() error {
+	return fmt.Errorf("unsupported database type: %s", d.name)
+}
+
+// queryStrings 执行查询并读取第一列的字符串
+func queryStrings(db Executor, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// queryDefinition 执行查询并拼接所有行的第一列（如按行保存的源码），没有结果时返回错误
+func queryDefinition(db Executor, objType, name, query string, args ...interface{}) (string, error) {
+	lines, err := queryStrings(db, query, args...)
+	if err != nil {
+		return "", err
+	}
+	definition := strings.Join(lines, "")
+	if definition == "" {
+		return "", fmt.Errorf("%s %s 不存在", objType, name)
+	}
+	return definition, nil
+}
+
+// queryExists 执行 COUNT 查询判断是否存在
+func queryExists(db Executor, query string, args ...interface{}) (bool, error) {
+	var count int
+	err := db.QueryRow(query, args...).Scan(&count)
+	return count > 0, err
+}
+
+// quoteAll 引用多个标识符
+func quoteAll(d Dialect, names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = d.QuoteIdentifier(name)
+	}
+	return quoted
+}
+
+// UpsertCache 一次同步运行内按表缓存 Upsert 所需的元数据（如 Oracle 的列类型），避免每批写入都查询元数据
+type UpsertCache struct {
+	mu      sync.Mutex
+	entries map[string]interface{}
+}
+
+// NewUpsertCache 创建 Upsert 元数据缓存，同步运行结束后丢弃
+func NewUpsertCache() *UpsertCache {
+	return &UpsertCache{entries: make(map[string]interface{})}
+}
+
+// load 返回表的缓存值，不存在时调用 fetch 并缓存（出错时不缓存）
+func (c *UpsertCache) load(table string, fetch func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.entries[table]; ok {
+		return v, nil
+	}
+	v, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.entries[table] = v
+	return v, nil
+}
+
+// cachedExecutor 带 Upsert 元数据缓存的执行器
+type cachedExecutor struct {
+	Executor
+	cache *UpsertCache
+}
+
+// WithUpsertCache 返回使用缓存的执行器，方言的 Upsert 通过它复用元数据；cache 为 nil 时直接返回 db
+func WithUpsertCache(db Executor, cache *UpsertCache) Executor {
+	if cache == nil {
+		return db
+	}
+	return cachedExecutor{Executor: db, cache: cache}
+}
+
+// cachedLoad 执行器带缓存时按表缓存 fetch 的结果，否则直接调用 fetch
+func cachedLoad(db Executor, table string, fetch func() (interface{}, error)) (interface{}, error) {
+	if c, ok := db.(cachedExecutor); ok {
+		return c.cache.load(table, fetch)
+	}
+	return fetch()
+}
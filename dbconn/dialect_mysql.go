@@ -0,0 +1,349 @@
+package dbconn
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/models"
+)
+
+var defaultMySQLParams = map[string]string{"charset": "utf8mb4", "parseTime": "True", "loc": "Local"}
+
+// mysqlExtraParams MySQL连接允许的额外参数
+var mysqlExtraParams = map[string]bool{
+	"charset": true, "collation": true, "loc": true, "parseTime": true, "time_zone": true,
+	"timeout": true, "readTimeout": true, "writeTimeout": true, "maxAllowedPacket": true,
+}
+
+// mysqlDialect MySQL
+type mysqlDialect struct {
+	baseDialect
+}
+
+func (d mysqlDialect) ConnOptions(dbConn *models.DatabaseConnection) (*ConnOptions, error) {
+	return networkConnOptions(d, dbConn)
+}
+
+func (d mysqlDialect) ValidateExtraParams(params map[string]string) error {
+	return checkExtraParams(params, mysqlExtraParams, false)
+}
+
+func (d mysqlDialect) Open(opts *ConnOptions) (*sql.DB, error) {
+	dsn, err := mysqlDSN(opts)
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open("mysql", dsn)
+}
+
+func (d mysqlDialect) GormDialector(db *sql.DB) gorm.Dialector {
+	return mysql.New(mysql.Config{Conn: db})
+}
+
+func (d mysqlDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// ConvertValue 不带参数的查询使用文本协议，整数和浮点数以文本返回；带参数的查询使用二进制协议返回 int64、float32/float64。
+// 将文本转换为与二进制协议相同的类型，使两种查询读取的同一行一致（超出 int64 的 UNSIGNED BIGINT 两种协议都返回文本）
+func (d mysqlDialect) ConvertValue(typeName string, val interface{}) interface{} {
+	b, ok := val.([]byte)
+	if !ok {
+		return val
+	}
+	switch strings.TrimPrefix(typeName, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n
+		}
+	case "FLOAT":
+		if f, err := strconv.ParseFloat(string(b), 32); err == nil {
+			return float32(f)
+		}
+	case "DOUBLE":
+		if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+			return f
+		}
+	}
+	return val
+}
+
+func (d mysqlDialect) Tables(db Executor) ([]string, error) {
+	return queryStrings(db, "SHOW TABLES")
+}
+
+func (d mysqlDialect) PrimaryKeys(db Executor, table string) ([]string, error) {
+	return queryStrings(db, `SELECT column_name FROM information_schema.key_column_usage
+		WHERE table_schema = DATABASE() AND table_name = ? AND constraint_name = 'PRIMARY'
+		ORDER BY ordinal_position`, table)
+}
+
+func (d mysqlDialect) TableExists(db Executor, table string) (bool, error) {
+	return queryExists(db, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", table)
+}
+
+// MaxParams 预处理语句的参数个数上限
+func (d mysqlDialect) MaxParams() int { return 65535 }
+
+// Upsert 使用 INSERT ... ON DUPLICATE KEY UPDATE
+func (d mysqlDialect) Upsert(db Executor, table string, columns, primaryKeys []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	quoted := quoteAll(d, columns)
+	updates := make([]string, len(quoted))
+	for i, col := range quoted {
+		updates[i] = fmt.Sprintf("%s=VALUES(%s)", col, col)
+	}
+
+	rowPlaceholders := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+	values := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		values[i] = rowPlaceholders
+		args = append(args, row...)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON DUPLICATE KEY UPDATE %s",
+		d.QuoteIdentifier(table), strings.Join(quoted, ","), strings.Join(values, ","), strings.Join(updates, ","))
+	_, err := db.Exec(query, args...)
+	return err
+}
+
+// mysqlBulkSeq 区分同时进行的 LOAD DATA 所注册的读取器
+var mysqlBulkSeq atomic.Int64
+
+// BulkLoad 使用 LOAD DATA LOCAL INFILE 从注册的读取器装载数据（需要服务器开启 local_infile）
+// 装载期间在当前会话关闭唯一性和外键检查
+func (d mysqlDialect) BulkLoad(conn *sql.Conn, table string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, "SET unique_checks = 0, foreign_key_checks = 0"); err != nil {
+		return 0, err
+	}
+	defer conn.ExecContext(ctx, "SET unique_checks = 1, foreign_key_checks = 1")
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeBulkText(writer, next, func(val interface{}) string {
+			if t, ok := val.(time.Time); ok {
+				// 与写入时驱动的 loc=Local 一致
+				val = t.In(time.Local)
+			}
+			return formatBulkValue(val, "2006-01-02 15:04:05.999999", "1", "0")
+		}))
+	}()
+	defer reader.CloseWithError(io.ErrClosedPipe)
+
+	name := fmt.Sprintf("bulk_%d", mysqlBulkSeq.Add(1))
+	gomysql.RegisterReaderHandler(name, func() io.Reader { return reader })
+	defer gomysql.DeregisterReaderHandler(name)
+
+	loadSQL := fmt.Sprintf(`LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s CHARACTER SET utf8mb4
+		FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (%s)`,
+		name, d.QuoteIdentifier(table), strings.Join(quoteAll(d, columns), ","))
+	result, err := conn.ExecContext(ctx, loadSQL)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DisableIndexes 删除非唯一的二级索引，恢复时重新添加；MySQL 不支持禁用触发器，触发器保持不变
+func (d mysqlDialect) DisableIndexes(conn *sql.Conn, table string) (func() error, error) {
+	ctx := context.Background()
+	rows, err := conn.QueryContext(ctx, `SELECT INDEX_NAME, COLUMN_NAME, SUB_PART, INDEX_TYPE FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND NON_UNIQUE = 1
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, table)
+	if err != nil {
+		return nil, err
+	}
+
+	type mysqlIndex struct {
+		name, indexType string
+		parts           []string
+		expression      bool
+	}
+	var indexes []*mysqlIndex
+	for rows.Next() {
+		var name, indexType string
+		var column sql.NullString
+		var subPart sql.NullInt64
+		if err := rows.Scan(&name, &column, &subPart, &indexType); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if len(indexes) == 0 || indexes[len(indexes)-1].name != name {
+			indexes = append(indexes, &mysqlIndex{name: name, indexType: indexType})
+		}
+		index := indexes[len(indexes)-1]
+		if !column.Valid {
+			// 函数索引无法按列重建，保留不删除
+			index.expression = true
+			continue
+		}
+		part := d.QuoteIdentifier(column.String)
+		if subPart.Valid {
+			part += fmt.Sprintf("(%d)", subPart.Int64)
+		}
+		index.parts = append(index.parts, part)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var drops, adds []string
+	for _, index := range indexes {
+		if index.expression {
+			continue
+		}
+		kind := "INDEX"
+		if index.indexType == "FULLTEXT" || index.indexType == "SPATIAL" {
+			kind = index.indexType + " INDEX"
+		}
+		drops = append(drops, "DROP INDEX "+d.QuoteIdentifier(index.name))
+		adds = append(adds, fmt.Sprintf("ADD %s %s (%s)", kind, d.QuoteIdentifier(index.name), strings.Join(index.parts, ",")))
+	}
+	if len(drops) == 0 {
+		return func() error { return nil }, nil
+	}
+
+	quotedTable := d.QuoteIdentifier(table)
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s %s", quotedTable, strings.Join(drops, ","))); err != nil {
+		return nil, fmt.Errorf("删除索引失败: %v", err)
+	}
+	return func() error {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s %s", quotedTable, strings.Join(adds, ",")))
+		return err
+	}, nil
+}
+
+func (d mysqlDialect) ObjectsQuery(objType, dbName string) (string, []interface{}) {
+	switch objType {
+	case "procedure", "function":
+		return "SELECT ROUTINE_NAME, ROUTINE_SCHEMA FROM information_schema.ROUTINES WHERE ROUTINE_TYPE = ? AND ROUTINE_SCHEMA = ?", []interface{}{strings.ToUpper(objType), dbName}
+	case "view":
+		return "SELECT TABLE_NAME, TABLE_SCHEMA FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ?", []interface{}{dbName}
+	case "trigger":
+		return "SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE, TRIGGER_SCHEMA FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ?", []interface{}{dbName}
+	}
+	return "", nil
+}
+
+// ObjectDefinition 使用 SHOW CREATE，结果包含多列，取其中的创建语句列
+func (d mysqlDialect) ObjectDefinition(db Executor, objType, name string) (string, error) {
+	switch objType {
+	case "procedure", "function", "view", "trigger":
+	default:
+		return "", fmt.Errorf("不支持获取%s的定义", objType)
+	}
+
+	rows, err := db.Query("SHOW CREATE " + strings.ToUpper(objType) + " " + d.QuoteIdentifier(name))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%s %s 不存在", objType, name)
+	}
+
+	values := make([]sql.NullString, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return "", err
+	}
+	for i, col := range columns {
+		// 触发器的创建语句列为 SQL Original Statement
+		if strings.HasPrefix(col, "Create ") || col == "SQL Original Statement" {
+			if !values[i].Valid {
+				return "", fmt.Errorf("没有权限查看%s %s 的定义", objType, name)
+			}
+			return values[i].String, nil
+		}
+	}
+	return "", fmt.Errorf("无法解析%s %s 的定义", objType, name)
+}
+
+func (d mysqlDialect) DropObjectSQL(objType, name, table string) string {
+	switch objType {
+	case "procedure", "function", "view", "trigger":
+		return fmt.Sprintf("DROP %s IF EXISTS %s", strings.ToUpper(objType), d.QuoteIdentifier(name))
+	}
+	return ""
+}
+
+// mysqlDSN 生成MySQL DSN，启用TLS时注册对应的TLS配置
+func mysqlDSN(opts *ConnOptions) (string, error) {
+	params := mergeParams(defaultMySQLParams, opts.Params)
+
+	tlsConfig, err := buildTLSConfig(&opts.TLS, opts.Host)
+	if err != nil {
+		return "", err
+	}
+	if tlsConfig != nil {
+		name, err := registerMySQLTLS(&opts.TLS, tlsConfig)
+		if err != nil {
+			return "", err
+		}
+		params["tls"] = name
+	}
+
+	query := url.Values{}
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?%s",
+		opts.Username, opts.Password, opts.Host, opts.Port, opts.Database, query.Encode()), nil
+}
+
+var (
+	mysqlTLSMu    sync.Mutex
+	mysqlTLSNames = map[string]bool{}
+)
+
+// registerMySQLTLS 按TLS配置内容注册到MySQL驱动，相同配置只注册一次
+func registerMySQLTLS(opts *TLSOptions, tlsConfig *tls.Config) (string, error) {
+	h := sha256.New()
+	for _, v := range []string{opts.Mode, opts.CACert, opts.ClientCert, opts.ClientKey, tlsConfig.ServerName} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	name := "dbsync-" + hex.EncodeToString(h.Sum(nil)[:8])
+
+	mysqlTLSMu.Lock()
+	defer mysqlTLSMu.Unlock()
+	if mysqlTLSNames[name] {
+		return name, nil
+	}
+	if err := gomysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return "", err
+	}
+	mysqlTLSNames[name] = true
+	return name, nil
+}
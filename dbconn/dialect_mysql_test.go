@@ -0,0 +1,31 @@
+package dbconn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMySQLConvertValue(t *testing.T) {
+	d := mysqlDialect{}
+	tests := []struct {
+		typeName string
+		in       interface{}
+		want     interface{}
+	}{
+		{"INT", []byte("1"), int64(1)},
+		{"UNSIGNED BIGINT", []byte("9007199254740993"), int64(9007199254740993)},
+		// 超出 int64 的无符号整数两种协议都返回文本
+		{"UNSIGNED BIGINT", []byte("18446744073709551615"), []byte("18446744073709551615")},
+		{"YEAR", []byte("2024"), int64(2024)},
+		{"FLOAT", []byte("1.5"), float32(1.5)},
+		{"DOUBLE", []byte("2.25"), 2.25},
+		{"DECIMAL", []byte("1.10"), []byte("1.10")},
+		{"VARCHAR", []byte("1"), []byte("1")},
+		{"INT", int64(7), int64(7)},
+	}
+	for _, tt := range tests {
+		if got := d.ConvertValue(tt.typeName, tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ConvertValue(%q, %v) = %#v, want %#v", tt.typeName, tt.in, got, tt.want)
+		}
+	}
+}
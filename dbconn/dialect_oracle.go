@@ -0,0 +1,275 @@
+package dbconn
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	goora "github.com/sijms/go-ora/v2"
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+)
+
+// oracleExtraParams Oracle连接允许的额外参数，驱动的参数名不区分大小写
+var oracleExtraParams = map[string]bool{
+	"sid": true, "timeout": true, "connection timeout": true, "prefetch_rows": true,
+	"ssl": true, "ssl verify": true, "wallet": true, "wallet password": true,
+}
+
+// oracleDialect Oracle，对象属于当前用户的schema
+type oracleDialect struct {
+	baseDialect
+}
+
+func (d oracleDialect) ConnOptions(dbConn *models.DatabaseConnection) (*ConnOptions, error) {
+	return networkConnOptions(d, dbConn)
+}
+
+// ValidateExtraParams wallet目录与外部密钥文件一样，必须位于配置允许的目录中
+func (d oracleDialect) ValidateExtraParams(params map[string]string) error {
+	if err := checkExtraParams(params, oracleExtraParams, true); err != nil {
+		return err
+	}
+	for key, value := range params {
+		if !strings.EqualFold(key, "wallet") {
+			continue
+		}
+		if _, ok, err := PathWithinDirs(value, config.GlobalConfig.Secrets.FileDirs); err != nil || !ok {
+			return fmt.Errorf("wallet目录 %s 不在允许的目录中", value)
+		}
+	}
+	return nil
+}
+
+func (d oracleDialect) Open(opts *ConnOptions) (*sql.DB, error) {
+	dsn, err := oracleURL(opts)
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open("oracle", dsn)
+}
+
+func (d oracleDialect) Placeholder(n int) string { return fmt.Sprintf(":%d", n) }
+
+func (d oracleDialect) LimitOffset(limit, offset int) string {
+	return fmt.Sprintf("OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", offset, limit)
+}
+
+// NormalizeStatement Oracle不接受语句末尾的分号
+func (d oracleDialect) NormalizeStatement(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), ";")
+}
+
+func (d oracleDialect) Tables(db Executor) ([]string, error) {
+	return queryStrings(db, "SELECT table_name FROM user_tables ORDER BY table_name")
+}
+
+func (d oracleDialect) PrimaryKeys(db Executor, table string) ([]string, error) {
+	return queryStrings(db, `SELECT c.column_name FROM user_cons_columns c
+		JOIN user_constraints k ON k.constraint_name = c.constraint_name
+		WHERE k.table_name = :1 AND k.constraint_type = 'P'
+		ORDER BY c.position`, table)
+}
+
+func (d oracleDialect) TableExists(db Executor, table string) (bool, error) {
+	return queryExists(db, "SELECT COUNT(*) FROM user_tables WHERE table_name = :1", table)
+}
+
+// MaxParams 绑定变量个数上限
+func (d oracleDialect) MaxParams() int { return 65535 }
+
+// oracleMaxRowsPerStmt 每条 MERGE/INSERT 语句最多合并的行数，避免语句过长
+const oracleMaxRowsPerStmt = 500
+
+// Upsert 使用 MERGE INTO ... USING (SELECT ... FROM dual UNION ALL ...) 批量写入，主键已存在时更新、不存在时插入；
+// 无主键时使用 INSERT INTO ... SELECT ... FROM dual UNION ALL ... 只插入
+// 绑定变量按目标列类型 CAST，避免同一列的 NULL 与其他值绑定类型不同导致 UNION ALL 类型不一致；
+// LOB 等不能 CAST 的列无法 UNION ALL，写入这些列时每条语句只写一行
+func (d oracleDialect) Upsert(db Executor, table string, columns, primaryKeys []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	cached, err := cachedLoad(db, table, func() (interface{}, error) {
+		return d.columnCastTypes(db, table)
+	})
+	if err != nil {
+		return fmt.Errorf("查询列类型失败: %v", err)
+	}
+	castTypes := cached.(map[string]string)
+
+	pkMap := make(map[string]bool, len(primaryKeys))
+	for _, pk := range primaryKeys {
+		pkMap[pk] = true
+	}
+
+	quotedTable := d.QuoteIdentifier(table)
+	quotedColumns := quoteAll(d, columns)
+	sourceColumns := make([]string, len(columns))
+	updateClauses := make([]string, 0, len(columns))
+	for i, col := range columns {
+		sourceColumns[i] = "s." + quotedColumns[i]
+		// ON 子句中的列不能被更新
+		if !pkMap[col] {
+			updateClauses = append(updateClauses, fmt.Sprintf("t.%s = s.%s", quotedColumns[i], quotedColumns[i]))
+		}
+	}
+	onClauses := make([]string, len(primaryKeys))
+	for i, pk := range primaryKeys {
+		quoted := d.QuoteIdentifier(pk)
+		onClauses[i] = fmt.Sprintf("t.%s = s.%s", quoted, quoted)
+	}
+
+	rowsPerStmt := min(oracleMaxRowsPerStmt, max(d.MaxParams()/len(columns), 1))
+	for _, col := range columns {
+		if castTypes[col] == "" {
+			rowsPerStmt = 1
+			break
+		}
+	}
+	for start := 0; start < len(rows); start += rowsPerStmt {
+		end := min(start+rowsPerStmt, len(rows))
+
+		selects := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for n, row := range rows[start:end] {
+			fields := make([]string, len(row))
+			for i, v := range row {
+				args = append(args, v)
+				fields[i] = d.Placeholder(len(args))
+				if castType := castTypes[columns[i]]; castType != "" {
+					fields[i] = fmt.Sprintf("CAST(%s AS %s)", fields[i], castType)
+				}
+				if n == 0 {
+					// 第一行的列别名决定结果集的列名
+					fields[i] += " " + quotedColumns[i]
+				}
+			}
+			selects = append(selects, "SELECT "+strings.Join(fields, ",")+" FROM dual")
+		}
+		source := strings.Join(selects, " UNION ALL ")
+
+		var stmt string
+		if len(primaryKeys) == 0 {
+			stmt = fmt.Sprintf("INSERT INTO %s (%s) %s", quotedTable, strings.Join(quotedColumns, ","), source)
+		} else {
+			stmt = fmt.Sprintf("MERGE INTO %s t USING (%s) s ON (%s)", quotedTable, source, strings.Join(onClauses, " AND "))
+			if len(updateClauses) > 0 {
+				stmt += " WHEN MATCHED THEN UPDATE SET " + strings.Join(updateClauses, ",")
+			}
+			stmt += fmt.Sprintf(" WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+				strings.Join(quotedColumns, ","), strings.Join(sourceColumns, ","))
+		}
+
+		if _, err := db.Exec(stmt, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// columnCastTypes 查询表各列用于 CAST 的类型，LOB 等不能 CAST 的类型为空字符串
+func (d oracleDialect) columnCastTypes(db Executor, table string) (map[string]string, error) {
+	rows, err := db.Query("SELECT column_name, data_type, char_length, char_used FROM user_tab_columns WHERE table_name = :1", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]string)
+	for rows.Next() {
+		var name, dataType string
+		var charLength sql.NullInt64
+		var charUsed sql.NullString
+		if err := rows.Scan(&name, &dataType, &charLength, &charUsed); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case dataType == "VARCHAR2" || dataType == "NVARCHAR2" || dataType == "CHAR" || dataType == "NCHAR":
+			unit := ""
+			if charUsed.String == "C" && !strings.HasPrefix(dataType, "N") {
+				unit = " CHAR"
+			}
+			result[name] = fmt.Sprintf("%s(%d%s)", dataType, max(charLength.Int64, 1), unit)
+		case dataType == "NUMBER" || dataType == "FLOAT" || dataType == "BINARY_FLOAT" || dataType == "BINARY_DOUBLE" ||
+			dataType == "DATE" || strings.HasPrefix(dataType, "TIMESTAMP"):
+			// TIMESTAMP 的类型名已包含精度和时区，如 TIMESTAMP(6) WITH TIME ZONE
+			result[name] = dataType
+		}
+	}
+	return result, rows.Err()
+}
+
+func (d oracleDialect) ObjectsQuery(objType, dbName string) (string, []interface{}) {
+	switch objType {
+	case "procedure":
+		return "SELECT object_name, owner FROM all_procedures WHERE object_type = 'PROCEDURE' AND owner = USER", nil
+	case "function":
+		return "SELECT object_name, owner FROM all_objects WHERE object_type = 'FUNCTION' AND owner = USER", nil
+	case "view":
+		return "SELECT view_name, owner FROM all_views WHERE owner = USER", nil
+	case "trigger":
+		return "SELECT trigger_name, table_name, owner FROM all_triggers WHERE owner = USER", nil
+	}
+	return "", nil
+}
+
+// ObjectDefinition 源码不含 CREATE，拼接为可直接执行的 CREATE OR REPLACE 语句
+func (d oracleDialect) ObjectDefinition(db Executor, objType, name string) (string, error) {
+	switch objType {
+	case "procedure", "function", "trigger":
+		source, err := queryDefinition(db, objType, name, "SELECT text FROM all_source WHERE type = :1 AND name = :2 AND owner = USER ORDER BY line", strings.ToUpper(objType), name)
+		if err != nil {
+			return "", err
+		}
+		return "CREATE OR REPLACE " + strings.TrimRight(source, " \r\n\t"), nil
+	case "view":
+		text, err := queryDefinition(db, objType, name, "SELECT text FROM all_views WHERE view_name = :1 AND owner = USER", name)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("CREATE OR REPLACE VIEW %s AS\n%s", d.QuoteIdentifier(name), text), nil
+	}
+	return d.baseDialect.ObjectDefinition(db, objType, name)
+}
+
+func (d oracleDialect) DropObjectSQL(objType, name, table string) string {
+	switch objType {
+	case "procedure", "function", "view", "trigger":
+		return fmt.Sprintf("DROP %s %s", strings.ToUpper(objType), d.QuoteIdentifier(name))
+	}
+	return ""
+}
+
+// oracleURL 生成go-ora连接URL，Database为服务名（使用SID时通过额外参数 SID 指定）
+// go-ora 只能通过wallet配置证书（额外参数 WALLET、WALLET PASSWORD），且按连接地址校验服务器名称
+func oracleURL(opts *ConnOptions) (string, error) {
+	port, err := strconv.Atoi(opts.Port)
+	if err != nil {
+		return "", fmt.Errorf("端口格式错误: %s", opts.Port)
+	}
+
+	params := mergeParams(nil, opts.Params)
+	switch opts.TLS.Mode {
+	case "", TLSModeDisable:
+	case TLSModeRequire:
+		params["SSL"] = "true"
+		params["SSL VERIFY"] = "false"
+	case TLSModeVerifyCA, TLSModeVerifyFull:
+		params["SSL"] = "true"
+		params["SSL VERIFY"] = "true"
+	default:
+		return "", fmt.Errorf("不支持的TLS模式: %s", opts.TLS.Mode)
+	}
+	if opts.TLS.CACert != "" || opts.TLS.ClientCert != "" {
+		return "", fmt.Errorf("Oracle连接的证书需通过wallet配置（额外参数 WALLET）")
+	}
+	if len(params) == 0 {
+		params = nil
+	}
+
+	return goora.BuildUrl(opts.Host, port, opts.Database, opts.Username, opts.Password, params), nil
+}
@@ -0,0 +1,79 @@
+package dbconn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// oracleExecutor 返回带有预置列类型缓存的执行器，Upsert 不再查询 user_tab_columns
+func oracleExecutor(table string, castTypes map[string]string) (*recordingExecutor, Executor) {
+	rec := &recordingExecutor{}
+	cache := NewUpsertCache()
+	cache.entries[table] = castTypes
+	return rec, WithUpsertCache(rec, cache)
+}
+
+func TestOracleUpsertMerge(t *testing.T) {
+	rec, db := oracleExecutor("USERS", map[string]string{"ID": "NUMBER", "NAME": "VARCHAR2(50 CHAR)"})
+	rows := [][]interface{}{{1, "a"}, {2, nil}}
+	if err := (oracleDialect{}).Upsert(db, "USERS", []string{"ID", "NAME"}, []string{"ID"}, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `MERGE INTO "USERS" t USING (` +
+		`SELECT CAST(:1 AS NUMBER) "ID",CAST(:2 AS VARCHAR2(50 CHAR)) "NAME" FROM dual UNION ALL ` +
+		`SELECT CAST(:3 AS NUMBER),CAST(:4 AS VARCHAR2(50 CHAR)) FROM dual) s ON (t."ID" = s."ID")` +
+		` WHEN MATCHED THEN UPDATE SET t."NAME" = s."NAME"` +
+		` WHEN NOT MATCHED THEN INSERT ("ID","NAME") VALUES (s."ID",s."NAME")`
+	if len(rec.stmts) != 1 || rec.stmts[0] != want {
+		t.Fatalf("stmts = %q,\nwant %q", rec.stmts, want)
+	}
+	if !reflect.DeepEqual(rec.args[0], []interface{}{1, "a", 2, nil}) {
+		t.Errorf("args = %v", rec.args[0])
+	}
+}
+
+func TestOracleUpsertPrimaryKeyOnly(t *testing.T) {
+	rec, db := oracleExecutor("TAGS", map[string]string{"ID": "NUMBER"})
+	if err := (oracleDialect{}).Upsert(db, "TAGS", []string{"ID"}, []string{"ID"}, [][]interface{}{{1}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.stmts) != 1 || strings.Contains(rec.stmts[0], "WHEN MATCHED") {
+		t.Fatalf("只有主键列时不应生成 UPDATE 子句: %q", rec.stmts)
+	}
+}
+
+func TestOracleUpsertInsertWithoutPrimaryKey(t *testing.T) {
+	rec, db := oracleExecutor("LOGS", map[string]string{"MSG": "VARCHAR2(10)"})
+	if err := (oracleDialect{}).Upsert(db, "LOGS", []string{"MSG"}, nil, [][]interface{}{{"a"}, {"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := `INSERT INTO "LOGS" ("MSG") SELECT CAST(:1 AS VARCHAR2(10)) "MSG" FROM dual UNION ALL SELECT CAST(:2 AS VARCHAR2(10)) FROM dual`
+	if len(rec.stmts) != 1 || rec.stmts[0] != want {
+		t.Fatalf("stmts = %q,\nwant %q", rec.stmts, want)
+	}
+}
+
+func TestOracleUpsertLOBOneRowPerStatement(t *testing.T) {
+	// BODY 为 CLOB，没有可用的 CAST 类型
+	rec, db := oracleExecutor("DOCS", map[string]string{"ID": "NUMBER"})
+	rows := [][]interface{}{{1, "x"}, {2, "y"}, {3, "z"}}
+	if err := (oracleDialect{}).Upsert(db, "DOCS", []string{"ID", "BODY"}, []string{"ID"}, rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.stmts) != len(rows) {
+		t.Fatalf("got %d statements, want %d", len(rec.stmts), len(rows))
+	}
+	for i, stmt := range rec.stmts {
+		if strings.Contains(stmt, "UNION ALL") {
+			t.Errorf("statement %d should not use UNION ALL: %s", i, stmt)
+		}
+		if !strings.Contains(stmt, `CAST(:1 AS NUMBER) "ID",:2 "BODY"`) {
+			t.Errorf("statement %d = %s", i, stmt)
+		}
+		if !reflect.DeepEqual(rec.args[i], rows[i]) {
+			t.Errorf("args %d = %v", i, rec.args[i])
+		}
+	}
+}
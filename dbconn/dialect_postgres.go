@@ -0,0 +1,278 @@
+package dbconn
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/models"
+)
+
+var defaultPostgresParams = map[string]string{"TimeZone": "Asia/Shanghai"}
+
+// postgresExtraParams PostgreSQL连接允许的额外参数
+var postgresExtraParams = map[string]bool{
+	"connect_timeout": true, "application_name": true, "client_encoding": true, "TimeZone": true,
+	"search_path": true, "statement_timeout": true, "lock_timeout": true, "idle_in_transaction_session_timeout": true,
+}
+
+// postgresDialect PostgreSQL，使用 public schema
+type postgresDialect struct {
+	baseDialect
+}
+
+func (d postgresDialect) ConnOptions(dbConn *models.DatabaseConnection) (*ConnOptions, error) {
+	return networkConnOptions(d, dbConn)
+}
+
+func (d postgresDialect) ValidateExtraParams(params map[string]string) error {
+	return checkExtraParams(params, postgresExtraParams, false)
+}
+
+func (d postgresDialect) Open(opts *ConnOptions) (*sql.DB, error) {
+	return openPostgres(opts)
+}
+
+func (d postgresDialect) GormDialector(db *sql.DB) gorm.Dialector {
+	return postgres.New(postgres.Config{Conn: db})
+}
+
+func (d postgresDialect) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (d postgresDialect) Tables(db Executor) ([]string, error) {
+	return queryStrings(db, "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_type = 'BASE TABLE' ORDER BY table_name")
+}
+
+func (d postgresDialect) PrimaryKeys(db Executor, table string) ([]string, error) {
+	return queryStrings(db, `SELECT column_name FROM information_schema.key_column_usage
+		WHERE table_schema = 'public' AND table_name = $1
+		AND constraint_name IN (
+			SELECT constraint_name FROM information_schema.table_constraints
+			WHERE table_schema = 'public' AND table_name = $1 AND constraint_type = 'PRIMARY KEY'
+		)
+		ORDER BY ordinal_position`, table)
+}
+
+func (d postgresDialect) TableExists(db Executor, table string) (bool, error) {
+	return queryExists(db, "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = $1", table)
+}
+
+// MaxParams 扩展查询协议的参数个数为16位整数
+func (d postgresDialect) MaxParams() int { return 65535 }
+
+func (d postgresDialect) Upsert(db Executor, table string, columns, primaryKeys []string, rows [][]interface{}) error {
+	return upsertOnConflict(d, db, table, columns, primaryKeys, rows)
+}
+
+// BulkLoad 使用 COPY FROM STDIN（文本格式）装载数据
+func (d postgresDialect) BulkLoad(conn *sql.Conn, table string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	copySQL := fmt.Sprintf("COPY %s (%s) FROM STDIN", d.QuoteIdentifier(table), strings.Join(quoteAll(d, columns), ","))
+
+	var loaded int64
+	err := conn.Raw(func(driverConn interface{}) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn().PgConn()
+
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(writeBulkText(writer, next, func(val interface{}) string {
+				return formatBulkValue(val, "2006-01-02 15:04:05.999999Z07:00", "t", "f")
+			}))
+		}()
+
+		tag, err := pgConn.CopyFrom(context.Background(), reader, copySQL)
+		// COPY 失败时停止生成数据
+		reader.CloseWithError(io.ErrClosedPipe)
+		loaded = tag.RowsAffected()
+		return err
+	})
+	return loaded, err
+}
+
+// DisableIndexes 删除非唯一、不属于约束的索引并禁用用户触发器，恢复时按原定义重建
+func (d postgresDialect) DisableIndexes(conn *sql.Conn, table string) (func() error, error) {
+	ctx := context.Background()
+	quotedTable := d.QuoteIdentifier(table)
+
+	rows, err := conn.QueryContext(ctx, `SELECT c.relname, pg_get_indexdef(i.indexrelid) FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = 'public' AND t.relname = $1 AND NOT i.indisprimary AND NOT i.indisunique
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint k WHERE k.conindid = i.indexrelid)`, table)
+	if err != nil {
+		return nil, err
+	}
+	var names, definitions []string
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, d.QuoteIdentifier(name))
+		definitions = append(definitions, definition)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DISABLE TRIGGER USER", quotedTable)); err != nil {
+		return nil, fmt.Errorf("禁用触发器失败: %v", err)
+	}
+	restore := func() error {
+		var errs []string
+		for _, definition := range definitions {
+			if _, err := conn.ExecContext(ctx, definition); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", definition, err))
+			}
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ENABLE TRIGGER USER", quotedTable)); err != nil {
+			errs = append(errs, fmt.Sprintf("启用触发器: %v", err))
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%s", strings.Join(errs, "；"))
+		}
+		return nil
+	}
+
+	if len(names) > 0 {
+		if _, err := conn.ExecContext(ctx, "DROP INDEX "+strings.Join(names, ",")); err != nil {
+			definitions = nil
+			if restoreErr := restore(); restoreErr != nil {
+				return nil, fmt.Errorf("删除索引失败: %v；恢复触发器失败: %v", err, restoreErr)
+			}
+			return nil, fmt.Errorf("删除索引失败: %v", err)
+		}
+	}
+	return restore, nil
+}
+
+func (d postgresDialect) ObjectsQuery(objType, dbName string) (string, []interface{}) {
+	switch objType {
+	case "procedure", "function":
+		return "SELECT routine_name, routine_schema FROM information_schema.routines WHERE routine_type = $1 AND routine_schema NOT IN ('pg_catalog', 'information_schema')", []interface{}{strings.ToUpper(objType)}
+	case "view":
+		return "SELECT table_name, table_schema FROM information_schema.views WHERE table_schema NOT IN ('pg_catalog', 'information_schema')", nil
+	case "trigger":
+		return "SELECT trigger_name, event_object_table, trigger_schema FROM information_schema.triggers WHERE trigger_schema NOT IN ('pg_catalog', 'information_schema')", nil
+	}
+	return "", nil
+}
+
+func (d postgresDialect) ObjectDefinition(db Executor, objType, name string) (string, error) {
+	switch objType {
+	case "procedure", "function":
+		return queryDefinition(db, objType, name, "SELECT pg_get_functiondef(oid) FROM pg_proc WHERE proname = $1", name)
+	case "view":
+		// pg_views 只保存查询部分
+		definition, err := queryDefinition(db, objType, name, "SELECT definition FROM pg_views WHERE viewname = $1", name)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("CREATE OR REPLACE VIEW %s AS\n%s", d.QuoteIdentifier(name), definition), nil
+	case "trigger":
+		return queryDefinition(db, objType, name, "SELECT pg_get_triggerdef(oid) FROM pg_trigger WHERE tgname = $1", name)
+	}
+	return d.baseDialect.ObjectDefinition(db, objType, name)
+}
+
+func (d postgresDialect) DropObjectSQL(objType, name, table string) string {
+	switch objType {
+	case "procedure", "function", "view":
+		return fmt.Sprintf("DROP %s IF EXISTS %s CASCADE", strings.ToUpper(objType), d.QuoteIdentifier(name))
+	case "trigger":
+		return fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s CASCADE", d.QuoteIdentifier(name), d.QuoteIdentifier(table))
+	}
+	return ""
+}
+
+// upsertOnConflict 使用 INSERT ... ON CONFLICT ... DO UPDATE（PostgreSQL、SQLite），无主键时只插入
+func upsertOnConflict(d Dialect, db Executor, table string, columns, primaryKeys []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	quoted := quoteAll(d, columns)
+	values := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		placeholders := make([]string, len(row))
+		for j, v := range row {
+			args = append(args, v)
+			placeholders[j] = d.Placeholder(len(args))
+		}
+		values[i] = "(" + strings.Join(placeholders, ",") + ")"
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", d.QuoteIdentifier(table), strings.Join(quoted, ","), strings.Join(values, ","))
+	// 没有主键时只插入（可能会因为唯一约束失败，但这是预期行为）
+	if len(primaryKeys) > 0 {
+		updates := make([]string, len(quoted))
+		for i, col := range quoted {
+			updates[i] = fmt.Sprintf("%s=EXCLUDED.%s", col, col)
+		}
+		query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(quoteAll(d, primaryKeys), ","), strings.Join(updates, ","))
+	}
+
+	_, err := db.Exec(query, args...)
+	return err
+}
+
+// openPostgres 使用pgx打开PostgreSQL连接，TLS配置直接设置到连接配置中
+func openPostgres(opts *ConnOptions) (*sql.DB, error) {
+	params := mergeParams(defaultPostgresParams, opts.Params)
+	params["host"] = opts.Host
+	params["port"] = opts.Port
+	params["user"] = opts.Username
+	params["password"] = opts.Password
+	params["dbname"] = opts.Database
+
+	tlsConfig, err := buildTLSConfig(&opts.TLS, opts.Host)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		params["sslmode"] = "disable"
+	} else {
+		// 由下面的TLS配置决定，避免解析时读取证书文件
+		delete(params, "sslmode")
+		delete(params, "sslrootcert")
+		delete(params, "sslcert")
+		delete(params, "sslkey")
+	}
+
+	connConfig, err := pgx.ParseConfig(postgresDSN(params))
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		connConfig.TLSConfig = tlsConfig
+		connConfig.Fallbacks = nil
+	}
+	return stdlib.OpenDB(*connConfig), nil
+}
+
+// postgresDSN 生成 key=value 格式的DSN，值使用单引号转义
+func postgresDSN(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.ReplaceAll(params[k], `\`, `\\`)
+		v = strings.ReplaceAll(v, `'`, `\'`)
+		parts = append(parts, fmt.Sprintf("%s='%s'", k, v))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,143 @@
+package dbconn
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+)
+
+// 默认SQLite参数：等待写锁而不是立即返回 database is locked，时间按SQLite可识别的格式写入
+// _pragma 可包含多个PRAGMA，用分号分隔
+var defaultSQLiteParams = map[string]string{"_pragma": "busy_timeout(5000)", "_time_format": "sqlite"}
+
+// sqliteExtraParams SQLite连接允许的额外参数
+var sqliteExtraParams = map[string]bool{"_pragma": true, "_txlock": true, "_time_format": true}
+
+// sqliteDialect SQLite（纯Go驱动），没有存储过程和函数
+type sqliteDialect struct {
+	baseDialect
+}
+
+// ConnOptions 生成SQLite连接参数，数据库文件必须位于配置允许的目录中，避免通过连接配置读写服务器上的任意文件
+func (d sqliteDialect) ConnOptions(dbConn *models.DatabaseConnection) (*ConnOptions, error) {
+	if dbConn.SSHEnabled {
+		return nil, fmt.Errorf("SQLite数据库不支持SSH隧道")
+	}
+	params, err := connectionParams(d, dbConn)
+	if err != nil {
+		return nil, err
+	}
+
+	path, allowed, err := PathWithinDirs(dbConn.Database, config.GlobalConfig.SQLite.DataDirs)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("SQLite数据库文件 %s 不在允许的目录中", dbConn.Database)
+	}
+
+	return &ConnOptions{
+		Type:     dbConn.Type,
+		Database: path,
+		Params:   params,
+	}, nil
+}
+
+func (d sqliteDialect) ValidateExtraParams(params map[string]string) error {
+	return checkExtraParams(params, sqliteExtraParams, false)
+}
+
+func (d sqliteDialect) Open(opts *ConnOptions) (*sql.DB, error) {
+	dsn, err := sqliteDSN(opts)
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open(sqlite.DriverName, dsn)
+}
+
+func (d sqliteDialect) GormDialector(db *sql.DB) gorm.Dialector {
+	return sqlite.Dialector{Conn: db}
+}
+
+// SelectForUpdate SQLite 没有行锁，写事务本身是串行的
+func (d sqliteDialect) SelectForUpdate(table, where string) string {
+	return fmt.Sprintf("SELECT * FROM %s WHERE %s", table, where)
+}
+
+func (d sqliteDialect) Tables(db Executor) ([]string, error) {
+	return queryStrings(db, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+}
+
+func (d sqliteDialect) PrimaryKeys(db Executor, table string) ([]string, error) {
+	return queryStrings(db, "SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk", table)
+}
+
+func (d sqliteDialect) TableExists(db Executor, table string) (bool, error) {
+	return queryExists(db, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table)
+}
+
+// MaxParams SQLITE_MAX_VARIABLE_NUMBER 的默认值
+func (d sqliteDialect) MaxParams() int { return 32766 }
+
+// Upsert SQLite 支持与 PostgreSQL 相同的 ON CONFLICT ... DO UPDATE 语法
+func (d sqliteDialect) Upsert(db Executor, table string, columns, primaryKeys []string, rows [][]interface{}) error {
+	return upsertOnConflict(d, db, table, columns, primaryKeys, rows)
+}
+
+func (d sqliteDialect) ObjectsQuery(objType, dbName string) (string, []interface{}) {
+	switch objType {
+	case "view":
+		return "SELECT name, 'main' FROM sqlite_master WHERE type = 'view'", nil
+	case "trigger":
+		return "SELECT name, tbl_name, 'main' FROM sqlite_master WHERE type = 'trigger'", nil
+	}
+	return "", nil
+}
+
+func (d sqliteDialect) ObjectDefinition(db Executor, objType, name string) (string, error) {
+	switch objType {
+	case "view", "trigger":
+		return queryDefinition(db, objType, name, "SELECT sql FROM sqlite_master WHERE type = ? AND name = ?", objType, name)
+	}
+	return d.baseDialect.ObjectDefinition(db, objType, name)
+}
+
+func (d sqliteDialect) DropObjectSQL(objType, name, table string) string {
+	switch objType {
+	case "view", "trigger":
+		return fmt.Sprintf("DROP %s IF EXISTS %s", strings.ToUpper(objType), d.QuoteIdentifier(name))
+	}
+	return ""
+}
+
+// sqliteDSN 生成SQLite DSN，Database 为数据库文件路径（或 :memory:）
+func sqliteDSN(opts *ConnOptions) (string, error) {
+	if opts.Database == "" {
+		return "", fmt.Errorf("SQLite数据库文件路径不能为空")
+	}
+
+	query := url.Values{}
+	for k, v := range mergeParams(defaultSQLiteParams, opts.Params) {
+		if k == "_pragma" {
+			for _, pragma := range strings.Split(v, ";") {
+				if pragma = strings.TrimSpace(pragma); pragma != "" {
+					query.Add(k, pragma)
+				}
+			}
+			continue
+		}
+		query.Set(k, v)
+	}
+	sep := "?"
+	if strings.Contains(opts.Database, "?") {
+		// 已带参数的URI文件名，如 file::memory:?cache=shared
+		sep = "&"
+	}
+	return opts.Database + sep + query.Encode(), nil
+}
@@ -0,0 +1,267 @@
+package dbconn
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"zh.xyz/dv/sync/models"
+)
+
+var defaultSQLServerParams = map[string]string{"encrypt": "disable"}
+
+// sqlServerMaxParams SQL Server 单条语句最多2100个参数，留出余量
+const sqlServerMaxParams = 2000
+
+// sqlServerExtraParams SQL Server连接允许的额外参数，驱动的参数名不区分大小写
+var sqlServerExtraParams = map[string]bool{
+	"app name": true, "connection timeout": true, "dial timeout": true, "keepalive": true,
+	"packet size": true, "encrypt": true, "trustservercertificate": true,
+}
+
+// sqlServerDialect SQL Server，使用当前用户的默认schema
+type sqlServerDialect struct {
+	baseDialect
+}
+
+func (d sqlServerDialect) ConnOptions(dbConn *models.DatabaseConnection) (*ConnOptions, error) {
+	return networkConnOptions(d, dbConn)
+}
+
+func (d sqlServerDialect) ValidateExtraParams(params map[string]string) error {
+	return checkExtraParams(params, sqlServerExtraParams, true)
+}
+
+func (d sqlServerDialect) Open(opts *ConnOptions) (*sql.DB, error) {
+	return openSQLServer(opts)
+}
+
+func (d sqlServerDialect) QuoteIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+func (d sqlServerDialect) Placeholder(n int) string { return fmt.Sprintf("@p%d", n) }
+
+// LimitOffset SQL Server 的 OFFSET 必须跟在 ORDER BY 之后
+func (d sqlServerDialect) LimitOffset(limit, offset int) string {
+	return fmt.Sprintf("ORDER BY (SELECT NULL) OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", offset, limit)
+}
+
+// SelectForUpdate SQL Server 不支持 FOR UPDATE，使用表提示加锁
+func (d sqlServerDialect) SelectForUpdate(table, where string) string {
+	return fmt.Sprintf("SELECT * FROM %s WITH (UPDLOCK, ROWLOCK) WHERE %s", table, where)
+}
+
+// ConvertValue 驱动将 uniqueidentifier 读取为混合字节序的16字节数据，转换为标准 UUID 字符串
+func (d sqlServerDialect) ConvertValue(typeName string, val interface{}) interface{} {
+	b, ok := val.([]byte)
+	if !ok || typeName != "UNIQUEIDENTIFIER" || len(b) != 16 {
+		return val
+	}
+	var guid mssql.UniqueIdentifier
+	if err := guid.Scan(b); err != nil {
+		return val
+	}
+	return strings.ToLower(guid.String())
+}
+
+func (d sqlServerDialect) Tables(db Executor) ([]string, error) {
+	return queryStrings(db, "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA = SCHEMA_NAME() ORDER BY TABLE_NAME")
+}
+
+func (d sqlServerDialect) PrimaryKeys(db Executor, table string) ([]string, error) {
+	return queryStrings(db, `SELECT k.COLUMN_NAME FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS c
+		JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE k
+			ON k.CONSTRAINT_NAME = c.CONSTRAINT_NAME AND k.CONSTRAINT_SCHEMA = c.CONSTRAINT_SCHEMA AND k.TABLE_NAME = c.TABLE_NAME
+		WHERE c.CONSTRAINT_TYPE = 'PRIMARY KEY' AND c.TABLE_SCHEMA = SCHEMA_NAME() AND c.TABLE_NAME = @p1
+		ORDER BY k.ORDINAL_POSITION`, table)
+}
+
+func (d sqlServerDialect) TableExists(db Executor, table string) (bool, error) {
+	return queryExists(db, "SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = SCHEMA_NAME() AND TABLE_NAME = @p1", table)
+}
+
+// MaxParams 单条语句的参数个数上限
+func (d sqlServerDialect) MaxParams() int { return sqlServerMaxParams }
+
+// Upsert 使用 MERGE 语句，按参数上限拆分；无主键时直接插入
+func (d sqlServerDialect) Upsert(db Executor, table string, columns, primaryKeys []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	quotedTable := d.QuoteIdentifier(table)
+	identityColumns, err := d.identityColumns(db, table)
+	if err != nil {
+		return fmt.Errorf("查询自增列失败: %v", err)
+	}
+
+	pkMap := make(map[string]bool, len(primaryKeys))
+	for _, pk := range primaryKeys {
+		pkMap[pk] = true
+	}
+
+	quotedColumns := quoteAll(d, columns)
+	sourceColumns := make([]string, len(columns))
+	updateClauses := make([]string, 0, len(columns))
+	identityInsert := false
+	for i, col := range columns {
+		sourceColumns[i] = "s." + quotedColumns[i]
+		if identityColumns[col] {
+			// 自增列需要开启 IDENTITY_INSERT 才能写入原值，且不能被更新
+			identityInsert = true
+			continue
+		}
+		if !pkMap[col] {
+			updateClauses = append(updateClauses, fmt.Sprintf("t.%s = s.%s", quotedColumns[i], quotedColumns[i]))
+		}
+	}
+
+	onClauses := make([]string, len(primaryKeys))
+	for i, pk := range primaryKeys {
+		quoted := d.QuoteIdentifier(pk)
+		onClauses[i] = fmt.Sprintf("t.%s = s.%s", quoted, quoted)
+	}
+
+	rowsPerStmt := sqlServerMaxParams / len(columns)
+	if rowsPerStmt < 1 {
+		rowsPerStmt = 1
+	}
+
+	for start := 0; start < len(rows); start += rowsPerStmt {
+		end := start + rowsPerStmt
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		valueRows := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			placeholders := make([]string, len(row))
+			for i, v := range row {
+				args = append(args, v)
+				placeholders[i] = d.Placeholder(len(args))
+			}
+			valueRows = append(valueRows, "("+strings.Join(placeholders, ",")+")")
+		}
+
+		var stmt string
+		if len(primaryKeys) == 0 {
+			stmt = fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;",
+				quotedTable, strings.Join(quotedColumns, ","), strings.Join(valueRows, ","))
+		} else {
+			stmt = fmt.Sprintf("MERGE INTO %s WITH (HOLDLOCK) AS t USING (VALUES %s) AS s (%s) ON %s",
+				quotedTable, strings.Join(valueRows, ","), strings.Join(quotedColumns, ","), strings.Join(onClauses, " AND "))
+			if len(updateClauses) > 0 {
+				stmt += " WHEN MATCHED THEN UPDATE SET " + strings.Join(updateClauses, ",")
+			}
+			stmt += fmt.Sprintf(" WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s);",
+				strings.Join(quotedColumns, ","), strings.Join(sourceColumns, ","))
+		}
+		if identityInsert {
+			stmt = fmt.Sprintf("SET IDENTITY_INSERT %s ON; %s SET IDENTITY_INSERT %s OFF;", quotedTable, stmt, quotedTable)
+		}
+
+		if _, err := db.Exec(stmt, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// identityColumns 查询表的自增（IDENTITY）列
+func (d sqlServerDialect) identityColumns(db Executor, table string) (map[string]bool, error) {
+	names, err := queryStrings(db, "SELECT name FROM sys.identity_columns WHERE object_id = OBJECT_ID(@p1)", d.QuoteIdentifier(table))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]bool, len(names))
+	for _, name := range names {
+		result[name] = true
+	}
+	return result, nil
+}
+
+// sqlServerObjectTypes 对象类型对应的 sys.objects.type
+var sqlServerObjectTypes = map[string]string{
+	"procedure": "'P'",
+	"function":  "'FN', 'IF', 'TF'",
+	"view":      "'V'",
+	"trigger":   "'TR'",
+}
+
+func (d sqlServerDialect) ObjectsQuery(objType, dbName string) (string, []interface{}) {
+	if objType == "trigger" {
+		// 只取表上的DML触发器（parent_class = 1），数据库级DDL触发器没有所属表
+		return `SELECT t.name, OBJECT_NAME(t.parent_id), OBJECT_SCHEMA_NAME(t.parent_id) FROM sys.triggers t
+			WHERE t.parent_class = 1 AND t.is_ms_shipped = 0`, nil
+	}
+	if types, ok := sqlServerObjectTypes[objType]; ok {
+		return "SELECT name, SCHEMA_NAME(schema_id) FROM sys.objects WHERE type IN (" + types + ") AND is_ms_shipped = 0", nil
+	}
+	return "", nil
+}
+
+// ObjectDefinition sys.sql_modules 保存完整的 CREATE 语句，加密的对象定义为NULL
+func (d sqlServerDialect) ObjectDefinition(db Executor, objType, name string) (string, error) {
+	types, ok := sqlServerObjectTypes[objType]
+	if !ok {
+		return d.baseDialect.ObjectDefinition(db, objType, name)
+	}
+	var definition sql.NullString
+	err := db.QueryRow("SELECT m.definition FROM sys.sql_modules m JOIN sys.objects o ON o.object_id = m.object_id WHERE o.name = @p1 AND o.type IN ("+types+")", name).Scan(&definition)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if definition.String == "" {
+		return "", fmt.Errorf("%s %s 不存在或定义已加密", objType, name)
+	}
+	return definition.String, nil
+}
+
+func (d sqlServerDialect) DropObjectSQL(objType, name, table string) string {
+	if _, ok := sqlServerObjectTypes[objType]; !ok {
+		return ""
+	}
+	return fmt.Sprintf("DROP %s IF EXISTS %s", strings.ToUpper(objType), d.QuoteIdentifier(name))
+}
+
+// openSQLServer 打开SQL Server连接，启用TLS时使用生成的TLS配置强制加密
+func openSQLServer(opts *ConnOptions) (*sql.DB, error) {
+	params := mergeParams(defaultSQLServerParams, opts.Params)
+	params["database"] = opts.Database
+
+	tlsConfig, err := buildTLSConfig(&opts.TLS, opts.Host)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		delete(params, "encrypt")
+	}
+
+	query := url.Values{}
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	dsn := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(opts.Username, opts.Password),
+		Host:     net.JoinHostPort(opts.Host, opts.Port),
+		RawQuery: query.Encode(),
+	}
+
+	cfg, err := msdsn.Parse(dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		cfg.Encryption = msdsn.EncryptionRequired
+		cfg.TLSConfig = tlsConfig
+	}
+	return sql.OpenDB(mssql.NewConnectorConfig(cfg)), nil
+}
@@ -0,0 +1,196 @@
+package dbconn
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+)
+
+// recordingExecutor 记录执行的语句和参数，不连接数据库
+type recordingExecutor struct {
+	stmts []string
+	args  [][]interface{}
+}
+
+func (e *recordingExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	e.stmts = append(e.stmts, query)
+	e.args = append(e.args, args)
+	return driverResult{}, nil
+}
+
+func (e *recordingExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("unexpected query: " + query)
+}
+
+func (e *recordingExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+type driverResult struct{}
+
+func (driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (driverResult) RowsAffected() (int64, error) { return 1, nil }
+
+// testDialect 测试注册的网络数据库方言，只允许 app 参数
+type testDialect struct {
+	baseDialect
+}
+
+func (d testDialect) ConnOptions(dbConn *models.DatabaseConnection) (*ConnOptions, error) {
+	return networkConnOptions(d, dbConn)
+}
+
+func (d testDialect) ValidateExtraParams(params map[string]string) error {
+	return checkExtraParams(params, map[string]bool{"app": true}, true)
+}
+
+func registerTestDialect(t *testing.T, d Dialect) {
+	t.Helper()
+	RegisterDialect(d)
+	t.Cleanup(func() {
+		dialectsMu.Lock()
+		delete(dialects, d.Name())
+		dialectsMu.Unlock()
+	})
+}
+
+func TestRegisteredDialectBuildsConnOptions(t *testing.T) {
+	registerTestDialect(t, testDialect{baseDialect{"testdb"}})
+
+	if err := ValidateExtraParams("testdb", map[string]string{"APP": "sync"}); err != nil {
+		t.Errorf("方言允许的参数被拒绝: %v", err)
+	}
+	if err := ValidateExtraParams("testdb", map[string]string{"charset": "utf8"}); err == nil {
+		t.Error("方言不允许的参数应被拒绝")
+	}
+
+	conn := &models.DatabaseConnection{
+		Type: "testdb", Host: "db.internal", Port: "4000", Username: "u", Password: "p", Database: "app",
+		TLSMode: TLSModeVerifyFull, ExtraParams: `{"app":"sync"}`,
+	}
+	opts, err := connOptions(conn)
+	if err != nil {
+		t.Fatalf("connOptions: %v", err)
+	}
+	want := &ConnOptions{
+		Type: "testdb", Host: "db.internal", Port: "4000", Username: "u", Password: "p", Database: "app",
+		TLS:    TLSOptions{Mode: TLSModeVerifyFull, ServerName: "db.internal"},
+		Params: map[string]string{"app": "sync"},
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("opts = %+v, want %+v", opts, want)
+	}
+
+	conn.ExtraParams = `{"host":"elsewhere"}`
+	if _, err := connOptions(conn); err == nil {
+		t.Error("连接配置中不允许的额外参数应报错")
+	}
+}
+
+func TestConnOptionsUnknownType(t *testing.T) {
+	if _, err := connOptions(&models.DatabaseConnection{Type: "nosuchdb"}); err == nil {
+		t.Error("未注册的数据库类型应报错")
+	}
+	if err := ValidateExtraParams("nosuchdb", map[string]string{"charset": "utf8"}); err == nil {
+		t.Error("未注册的数据库类型不允许额外参数")
+	}
+}
+
+func TestSQLiteConnOptions(t *testing.T) {
+	dir := t.TempDir()
+	prev := config.GlobalConfig
+	config.GlobalConfig = &config.Config{SQLite: config.SQLiteConfig{DataDirs: []string{dir}}}
+	defer func() { config.GlobalConfig = prev }()
+
+	path := filepath.Join(dir, "app.db")
+	opts, err := connOptions(&models.DatabaseConnection{Type: "sqlite", Database: path, ExtraParams: `{"_txlock":"immediate"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Database != path || opts.Params["_txlock"] != "immediate" || opts.Host != "" {
+		t.Errorf("opts = %+v", opts)
+	}
+
+	for name, conn := range map[string]models.DatabaseConnection{
+		"outside data dirs": {Type: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")},
+		"ssh tunnel":        {Type: "sqlite", Database: path, SSHEnabled: true},
+		"extra params":      {Type: "sqlite", Database: path, ExtraParams: `{"vfs":"memdb"}`},
+	} {
+		if _, err := connOptions(&conn); err == nil {
+			t.Errorf("%s: 应报错", name)
+		}
+	}
+}
+
+func TestPostgresUpsert(t *testing.T) {
+	rec := &recordingExecutor{}
+	rows := [][]interface{}{{1, "a"}, {2, "b"}}
+	if err := (postgresDialect{}).Upsert(rec, "users", []string{"id", "name"}, []string{"id"}, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `INSERT INTO "users" ("id","name") VALUES ($1,$2),($3,$4) ON CONFLICT ("id") DO UPDATE SET "id"=EXCLUDED."id","name"=EXCLUDED."name"`
+	if len(rec.stmts) != 1 || rec.stmts[0] != want {
+		t.Fatalf("stmts = %q, want %q", rec.stmts, want)
+	}
+	if !reflect.DeepEqual(rec.args[0], []interface{}{1, "a", 2, "b"}) {
+		t.Errorf("args = %v", rec.args[0])
+	}
+}
+
+func TestPostgresUpsertWithoutPrimaryKey(t *testing.T) {
+	rec := &recordingExecutor{}
+	if err := (postgresDialect{}).Upsert(rec, "logs", []string{"msg"}, nil, [][]interface{}{{"x"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := `INSERT INTO "logs" ("msg") VALUES ($1)`
+	if len(rec.stmts) != 1 || rec.stmts[0] != want {
+		t.Fatalf("stmts = %q, want %q", rec.stmts, want)
+	}
+}
+
+func TestUnregisteredDialectFallsBack(t *testing.T) {
+	d := DialectFor("nosuchdb")
+	if d.Name() != "nosuchdb" || d.QuoteIdentifier(`a"b`) != `"a""b"` {
+		t.Errorf("默认方言: name = %s, quote = %s", d.Name(), d.QuoteIdentifier(`a"b`))
+	}
+	if _, err := d.Open(&ConnOptions{}); err == nil {
+		t.Error("默认方言不能打开连接")
+	}
+	if err := d.Upsert(&recordingExecutor{}, "t", []string{"a"}, nil, [][]interface{}{{1}}); err == nil {
+		t.Error("默认方言不支持写入")
+	}
+}
+
+func TestUpsertCacheLoadsOncePerTable(t *testing.T) {
+	cache := NewUpsertCache()
+	calls := 0
+	fetch := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := cache.load("A", fetch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cache.load("B", fetch); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("fetch called %d times, want 2", calls)
+	}
+
+	failing := func() (interface{}, error) { return nil, errors.New("boom") }
+	if _, err := cache.load("C", failing); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, ok := cache.entries["C"]; ok {
+		t.Error("failed fetch should not be cached")
+	}
+}
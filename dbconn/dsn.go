@@ -0,0 +1,261 @@
+package dbconn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/utils"
+)
+
+// TLS 模式
+const (
+	TLSModeDisable    = "disable"     // 不使用TLS
+	TLSModeRequire    = "require"     // 使用TLS，不校验服务器证书
+	TLSModeVerifyCA   = "verify-ca"   // 校验服务器证书由受信任的CA签发
+	TLSModeVerifyFull = "verify-full" // 校验证书并校验服务器名称
+)
+
+// TLSOptions 连接的TLS配置，证书和私钥为PEM内容
+type TLSOptions struct {
+	Mode       string
+	CACert     string
+	ClientCert string
+	ClientKey  string
+	ServerName string // verify-full 时校验的服务器名称，为空时使用连接地址
+}
+
+// ConnOptions 打开数据库连接所需的参数，数据库连接配置和系统数据库共用
+type ConnOptions struct {
+	Type     string
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Database string
+	TLS      TLSOptions
+	Params   map[string]string // 额外的DSN参数，可覆盖默认参数
+}
+
+// IsTLSMode 判断是否为支持的TLS模式
+func IsTLSMode(mode string) bool {
+	switch mode {
+	case "", TLSModeDisable, TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull:
+		return true
+	}
+	return false
+}
+
+// ParseExtraParams 解析JSON格式的额外DSN参数
+func ParseExtraParams(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var params map[string]string
+	if err := json.Unmarshal([]byte(s), &params); err != nil {
+		return nil, fmt.Errorf("额外连接参数格式错误: %v", err)
+	}
+	return params, nil
+}
+
+// ValidateExtraParams 按数据库类型的方言校验连接的额外DSN参数，不在允许列表中的参数返回错误
+func ValidateExtraParams(dbType string, params map[string]string) error {
+	return DialectFor(dbType).ValidateExtraParams(params)
+}
+
+// checkExtraParams 校验参数名是否在方言允许的列表中，foldCase 为true时参数名不区分大小写（按小写比较）
+// 只开放超时、字符集、时区等会话参数，不允许读取服务器本地文件（如MySQL的 allowAllFiles、PostgreSQL的 sslrootcert、
+// SQL Server的 certificate）或改变连接目标、认证方式的参数；TLS通过连接的TLS设置配置
+func checkExtraParams(params map[string]string, allowed map[string]bool, foldCase bool) error {
+	for key := range params {
+		name := key
+		if foldCase {
+			name = strings.ToLower(key)
+		}
+		if !allowed[name] {
+			return fmt.Errorf("不允许的连接参数: %s", key)
+		}
+	}
+	return nil
+}
+
+// connectionParams 解析连接配置中的额外DSN参数并按方言校验
+func connectionParams(d Dialect, dbConn *models.DatabaseConnection) (map[string]string, error) {
+	params, err := ParseExtraParams(dbConn.ExtraParams)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.ValidateExtraParams(params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// connOptions 根据连接配置生成连接参数，由连接类型的方言实现
+func connOptions(dbConn *models.DatabaseConnection) (*ConnOptions, error) {
+	d, err := GetDialect(dbConn.Type)
+	if err != nil {
+		return nil, err
+	}
+	return d.ConnOptions(dbConn)
+}
+
+// networkConnOptions 通过网络连接的数据库共用的连接参数：解析密码、建立SSH隧道、解密客户端私钥
+func networkConnOptions(d Dialect, dbConn *models.DatabaseConnection) (*ConnOptions, error) {
+	password, err := resolvePassword(dbConn)
+	if err != nil {
+		return nil, err
+	}
+	params, err := connectionParams(d, dbConn)
+	if err != nil {
+		return nil, err
+	}
+	clientKey, err := utils.DecryptSecret(dbConn.TLSClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("解密TLS客户端私钥失败: %v", err)
+	}
+	host, port, err := endpoint(dbConn)
+	if err != nil {
+		return nil, err
+	}
+
+	// 经SSH隧道连接时地址为本地转发地址，默认按配置的数据库主机校验证书
+	serverName := dbConn.TLSServerName
+	if serverName == "" {
+		serverName = dbConn.Host
+	}
+
+	return &ConnOptions{
+		Type:     dbConn.Type,
+		Host:     host,
+		Port:     port,
+		Username: dbConn.Username,
+		Password: password,
+		Database: dbConn.Database,
+		TLS: TLSOptions{
+			Mode:       dbConn.TLSMode,
+			CACert:     dbConn.TLSCACert,
+			ClientCert: dbConn.TLSClientCert,
+			ClientKey:  clientKey,
+			ServerName: serverName,
+		},
+		Params: params,
+	}, nil
+}
+
+// OpenGorm 按连接参数打开GORM连接
+func OpenGorm(opts *ConnOptions, gormConfig *gorm.Config) (*gorm.DB, error) {
+	d, err := GetDialect(opts.Type)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := d.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	dialector := d.GormDialector(sqlDB)
+	if dialector == nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("%s数据库暂不支持GORM", opts.Type)
+	}
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenDB 按连接参数打开原生连接
+func OpenDB(opts *ConnOptions) (*sql.DB, error) {
+	d, err := GetDialect(opts.Type)
+	if err != nil {
+		return nil, err
+	}
+	return d.Open(opts)
+}
+
+func mergeParams(defaults, extra map[string]string) map[string]string {
+	params := make(map[string]string, len(defaults)+len(extra))
+	for k, v := range defaults {
+		params[k] = v
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	return params
+}
+
+// buildTLSConfig 根据TLS模式生成TLS配置，disable 时返回nil
+func buildTLSConfig(opts *TLSOptions, host string) (*tls.Config, error) {
+	mode := opts.Mode
+	if mode == "" || mode == TLSModeDisable {
+		return nil, nil
+	}
+	if !IsTLSMode(mode) {
+		return nil, fmt.Errorf("不支持的TLS模式: %s", mode)
+	}
+
+	serverName := opts.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	tlsConfig := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(opts.ClientCert), []byte(opts.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("解析TLS客户端证书失败: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	var roots *x509.CertPool
+	if opts.CACert != "" {
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(opts.CACert)) {
+			return nil, fmt.Errorf("解析TLS CA证书失败")
+		}
+	}
+
+	switch mode {
+	case TLSModeRequire:
+		tlsConfig.InsecureSkipVerify = true
+	case TLSModeVerifyCA:
+		// 只校验证书链，不校验服务器名称
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertChain(rawCerts, roots)
+		}
+	case TLSModeVerifyFull:
+		tlsConfig.RootCAs = roots
+	}
+	return tlsConfig, nil
+}
+
+// verifyCertChain 校验服务器证书链，roots 为nil时使用系统CA
+func verifyCertChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("服务器未提供证书")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
@@ -0,0 +1,293 @@
+package dbconn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zh.xyz/dv/sync/config"
+)
+
+// testCert 测试证书及其PEM内容
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM string
+	keyPEM  string
+}
+
+// newTestCert 生成证书，parent 为nil时生成自签名CA
+func newTestCert(t *testing.T, dnsName string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		template.DNSNames = []string{dnsName}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+// handshake 使用客户端TLS配置与持有 server 证书的服务端握手
+func handshake(t *testing.T, clientConfig *tls.Config, server *testCert) error {
+	t.Helper()
+	serverCert, err := tls.X509KeyPair([]byte(server.certPEM), []byte(server.keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{serverCert}}).Handshake()
+	return tls.Client(clientConn, clientConfig).Handshake()
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	otherCA := newTestCert(t, "other ca", nil)
+	server := newTestCert(t, "db.internal", ca)
+	untrusted := newTestCert(t, "db.internal", otherCA)
+
+	for _, mode := range []string{"", TLSModeDisable} {
+		if cfg, err := buildTLSConfig(&TLSOptions{Mode: mode}, "db.internal"); cfg != nil || err != nil {
+			t.Errorf("mode %q: cfg = %v, err = %v, want nil", mode, cfg, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		opts   TLSOptions
+		host   string
+		server *testCert
+		ok     bool
+	}{
+		// require 只加密，不校验证书
+		{"require", TLSOptions{Mode: TLSModeRequire}, "db.internal", untrusted, true},
+		// verify-ca 校验证书链，不校验服务器名称（如经SSH隧道或按IP连接）
+		{"verify-ca", TLSOptions{Mode: TLSModeVerifyCA, CACert: ca.certPEM}, "10.0.0.1", server, true},
+		{"verify-ca untrusted", TLSOptions{Mode: TLSModeVerifyCA, CACert: ca.certPEM}, "db.internal", untrusted, false},
+		// verify-full 同时校验服务器名称，默认使用连接地址
+		{"verify-full", TLSOptions{Mode: TLSModeVerifyFull, CACert: ca.certPEM}, "db.internal", server, true},
+		{"verify-full server name", TLSOptions{Mode: TLSModeVerifyFull, CACert: ca.certPEM, ServerName: "db.internal"}, "127.0.0.1", server, true},
+		{"verify-full wrong name", TLSOptions{Mode: TLSModeVerifyFull, CACert: ca.certPEM}, "10.0.0.1", server, false},
+		{"verify-full untrusted", TLSOptions{Mode: TLSModeVerifyFull, CACert: ca.certPEM}, "db.internal", untrusted, false},
+	}
+	for _, tt := range tests {
+		cfg, err := buildTLSConfig(&tt.opts, tt.host)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if cfg.MinVersion != tls.VersionTLS12 {
+			t.Errorf("%s: MinVersion = %x", tt.name, cfg.MinVersion)
+		}
+		if err := handshake(t, cfg, tt.server); (err == nil) != tt.ok {
+			t.Errorf("%s: handshake err = %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestBuildTLSConfigRejectsInvalidOptions(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	client := newTestCert(t, "client", ca)
+	other := newTestCert(t, "other", ca)
+
+	cfg, err := buildTLSConfig(&TLSOptions{Mode: TLSModeVerifyFull, ClientCert: client.certPEM, ClientKey: client.keyPEM}, "db")
+	if err != nil || len(cfg.Certificates) != 1 {
+		t.Errorf("客户端证书: cfg = %v, err = %v", cfg, err)
+	}
+
+	for name, opts := range map[string]TLSOptions{
+		"unknown mode":        {Mode: "prefer"},
+		"invalid CA":          {Mode: TLSModeVerifyCA, CACert: "not a certificate"},
+		"key mismatch":        {Mode: TLSModeRequire, ClientCert: client.certPEM, ClientKey: other.keyPEM},
+		"cert without key":    {Mode: TLSModeRequire, ClientCert: client.certPEM},
+		"invalid client cert": {Mode: TLSModeRequire, ClientCert: "x", ClientKey: "y"},
+	} {
+		if _, err := buildTLSConfig(&opts, "db"); err == nil {
+			t.Errorf("%s: 应报错", name)
+		}
+	}
+}
+
+func TestMySQLDSN(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	opts := &ConnOptions{
+		Host: "db", Port: "3306", Username: "u", Password: "p", Database: "app",
+		TLS:    TLSOptions{Mode: TLSModeVerifyFull, CACert: ca.certPEM},
+		Params: map[string]string{"charset": "latin1"},
+	}
+
+	dsn, err := mysqlDSN(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := "u:p@tcp(db:3306)/app?"
+	if !strings.HasPrefix(dsn, prefix) {
+		t.Fatalf("dsn = %s", dsn)
+	}
+	query, _ := url.ParseQuery(strings.TrimPrefix(dsn, prefix))
+	if query.Get("charset") != "latin1" || query.Get("parseTime") == "" {
+		t.Errorf("额外参数应覆盖默认参数: %s", dsn)
+	}
+	if !strings.HasPrefix(query.Get("tls"), "dbsync-") {
+		t.Errorf("启用TLS时应使用注册的TLS配置: %s", dsn)
+	}
+
+	// 相同的TLS配置复用同一注册名，不同的配置使用新的注册名
+	again, _ := mysqlDSN(opts)
+	if again != dsn {
+		t.Errorf("相同配置生成的DSN不同: %s != %s", again, dsn)
+	}
+	opts.TLS.ServerName = "db.internal"
+	changed, _ := mysqlDSN(opts)
+	if q, _ := url.ParseQuery(strings.TrimPrefix(changed, prefix)); q.Get("tls") == query.Get("tls") {
+		t.Error("TLS配置变化后应注册新的TLS配置")
+	}
+
+	opts.TLS = TLSOptions{}
+	plain, _ := mysqlDSN(opts)
+	if q, _ := url.ParseQuery(strings.TrimPrefix(plain, prefix)); q.Has("tls") {
+		t.Errorf("未启用TLS时不应设置tls参数: %s", plain)
+	}
+}
+
+func TestPostgresDSN(t *testing.T) {
+	got := postgresDSN(map[string]string{"password": `it's\secret`, "host": "db", "application_name": "a b"})
+	want := `application_name='a b' host='db' password='it\'s\\secret'`
+	if got != want {
+		t.Errorf("postgresDSN = %s, want %s", got, want)
+	}
+}
+
+func TestOracleURL(t *testing.T) {
+	base := ConnOptions{Host: "db", Port: "1521", Username: "u", Password: "p", Database: "ORCL"}
+	tests := []struct {
+		mode      string
+		ssl       string
+		sslVerify string
+	}{
+		{"", "", ""},
+		{TLSModeRequire, "true", "false"},
+		{TLSModeVerifyCA, "true", "true"},
+		{TLSModeVerifyFull, "true", "true"},
+	}
+	for _, tt := range tests {
+		opts := base
+		opts.TLS.Mode = tt.mode
+		raw, err := oracleURL(&opts)
+		if err != nil {
+			t.Fatalf("mode %q: %v", tt.mode, err)
+		}
+		u, _ := url.Parse(raw)
+		if u.Host != "db:1521" || u.Path != "/ORCL" {
+			t.Errorf("mode %q: url = %s", tt.mode, raw)
+		}
+		if got := u.Query().Get("SSL"); got != tt.ssl {
+			t.Errorf("mode %q: SSL = %q, want %q", tt.mode, got, tt.ssl)
+		}
+		if got := u.Query().Get("SSL VERIFY"); got != tt.sslVerify {
+			t.Errorf("mode %q: SSL VERIFY = %q, want %q", tt.mode, got, tt.sslVerify)
+		}
+	}
+
+	for name, opts := range map[string]ConnOptions{
+		"unknown mode": {Host: "db", Port: "1521", TLS: TLSOptions{Mode: "prefer"}},
+		"inline CA":    {Host: "db", Port: "1521", TLS: TLSOptions{Mode: TLSModeVerifyFull, CACert: "pem"}},
+		"invalid port": {Host: "db", Port: "port"},
+	} {
+		if _, err := oracleURL(&opts); err == nil {
+			t.Errorf("%s: 应报错", name)
+		}
+	}
+}
+
+func TestParseExtraParams(t *testing.T) {
+	if params, err := ParseExtraParams(" "); params != nil || err != nil {
+		t.Errorf("空参数: %v, %v", params, err)
+	}
+	if params, err := ParseExtraParams(`{"charset":"utf8mb4"}`); err != nil || params["charset"] != "utf8mb4" {
+		t.Errorf("params = %v, %v", params, err)
+	}
+	for _, s := range []string{`["charset"]`, `{"timeout":5}`, `{`} {
+		if _, err := ParseExtraParams(s); err == nil {
+			t.Errorf("ParseExtraParams(%s) 应报错", s)
+		}
+	}
+}
+
+func TestValidateExtraParams(t *testing.T) {
+	walletDir := t.TempDir()
+	prev := config.GlobalConfig
+	config.GlobalConfig = &config.Config{Secrets: config.SecretsConfig{FileDirs: []string{walletDir}}}
+	defer func() { config.GlobalConfig = prev }()
+
+	tests := []struct {
+		dbType string
+		params map[string]string
+		ok     bool
+	}{
+		{"mysql", map[string]string{"charset": "utf8mb4", "timeout": "5s"}, true},
+		{"mysql", map[string]string{"allowAllFiles": "true"}, false},
+		{"mysql", map[string]string{"tls": "skip-verify"}, false},
+		// MySQL 和 PostgreSQL 参数名区分大小写
+		{"mysql", map[string]string{"Charset": "utf8mb4"}, false},
+		{"postgres", map[string]string{"application_name": "sync", "TimeZone": "UTC"}, true},
+		{"postgres", map[string]string{"sslrootcert": "/etc/passwd"}, false},
+		{"postgres", map[string]string{"host": "elsewhere"}, false},
+		// SQL Server 和 Oracle 参数名不区分大小写
+		{"sqlserver", map[string]string{"App Name": "sync", "Dial Timeout": "5"}, true},
+		{"sqlserver", map[string]string{"certificate": "/etc/passwd"}, false},
+		{"oracle", map[string]string{"SID": "ORCL", "PREFETCH_ROWS": "100"}, true},
+		{"oracle", map[string]string{"WALLET": walletDir}, true},
+		{"oracle", map[string]string{"wallet": filepath.Join(walletDir, "..")}, false},
+		{"oracle", map[string]string{"auth type": "os"}, false},
+		{"sqlite", map[string]string{"_pragma": "busy_timeout(5000)"}, true},
+		{"sqlite", map[string]string{"vfs": "memdb"}, false},
+		{"unknown", map[string]string{"charset": "utf8"}, false},
+		{"unknown", nil, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateExtraParams(tt.dbType, tt.params); (err == nil) != tt.ok {
+			t.Errorf("ValidateExtraParams(%s, %v) = %v, want ok=%v", tt.dbType, tt.params, err, tt.ok)
+		}
+	}
+}
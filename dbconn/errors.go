@@ -0,0 +1,79 @@
+package dbconn
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/sijms/go-ora/v2/network"
+)
+
+// IsTransientError 判断错误是否为暂时性错误（死锁、锁等待超时、连接中断等），重试可能成功
+// 数据错误（约束冲突、类型不匹配等）重试不会成功，返回 false
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// 连接中断
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", "40P01", "55P03", "57P01", "57P02", "57P03", "53300":
+			// 序列化失败、死锁、锁不可用、服务器关闭或重启、连接数过多
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, "08") // 连接异常
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1205, 1213, 1040, 2006, 2013:
+			// 锁等待超时、死锁、连接数过多、服务器断开
+			return true
+		}
+		return false
+	}
+
+	var mssqlErr mssql.Error
+	if errors.As(err, &mssqlErr) {
+		switch mssqlErr.Number {
+		case 1204, 1205, 1222, 40197, 40501, 40613:
+			// 锁资源不足、死锁、锁请求超时、服务暂时不可用
+			return true
+		}
+		return false
+	}
+
+	var oraErr *network.OracleError
+	if errors.As(err, &oraErr) {
+		switch oraErr.ErrCode {
+		case 60, 54, 3113, 3114, 3135, 12514, 12528, 12537, 12541, 12560, 12571:
+			// 死锁、资源忙、连接中断或不可用
+			return true
+		}
+		return false
+	}
+
+	// SQLite 的忙/锁错误只能从错误信息判断
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "sqlite_busy") ||
+		strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe")
+}
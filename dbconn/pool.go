@@ -0,0 +1,278 @@
+package dbconn
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+)
+
+// 连接池默认配置
+const (
+	defaultMaxOpenConns    = 10
+	defaultMaxIdleConns    = 2
+	defaultConnMaxLifetime = 30 * time.Minute
+	defaultConnMaxIdleTime = 5 * time.Minute
+	defaultPoolIdleTimeout = 10 * time.Minute
+	poolReapInterval       = time.Minute
+)
+
+// poolEntry 一个数据库连接配置对应的连接池
+type poolEntry struct {
+	id          uint
+	dbType      string
+	fingerprint string // 连接设置摘要，设置变化后重建连接池
+	db          *sql.DB
+
+	refs      int  // 正在使用（未归还）的次数
+	retired   bool // 已失效，归还后关闭
+	tunnels   []*sshTunnel
+	createdAt time.Time
+	lastUsed  time.Time
+}
+
+var (
+	poolMu     sync.Mutex
+	pools      = map[uint]*poolEntry{}    // 连接ID -> 连接池
+	poolsByDB  = map[*sql.DB]*poolEntry{} // 用于归还连接
+	reaperOnce sync.Once
+)
+
+// PoolStats 连接池统计信息
+type PoolStats struct {
+	ConnectionID       uint      `json:"connection_id"`
+	Type               string    `json:"type"`
+	ActiveUsers        int       `json:"active_users"` // 正在使用连接池的请求或任务数
+	CreatedAt          time.Time `json:"created_at"`
+	LastUsedAt         time.Time `json:"last_used_at"`
+	MaxOpenConnections int       `json:"max_open_connections"`
+	OpenConnections    int       `json:"open_connections"`
+	InUse              int       `json:"in_use"`
+	Idle               int       `json:"idle"`
+	WaitCount          int64     `json:"wait_count"`
+	WaitDurationMs     int64     `json:"wait_duration_ms"`
+	MaxIdleClosed      int64     `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64     `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64     `json:"max_lifetime_closed"`
+}
+
+// acquirePool 获取连接的连接池，不存在或设置已变化时创建；ref 为true时计入使用次数，需调用 ReleaseConnection 归还
+func acquirePool(dbConn *models.DatabaseConnection, ref bool) (*poolEntry, error) {
+	reaperOnce.Do(func() { go reapIdlePools() })
+
+	fingerprint := connFingerprint(dbConn)
+
+	poolMu.Lock()
+	if entry, ok := pools[dbConn.ID]; ok {
+		if entry.fingerprint == fingerprint {
+			entry.use(ref)
+			poolMu.Unlock()
+			return entry, nil
+		}
+		// 连接设置已变化，旧连接池归还后关闭
+		retireLocked(entry)
+	}
+	poolMu.Unlock()
+
+	// 建立连接（可能需要建立SSH隧道）不持有锁
+	opts, err := connOptions(dbConn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := OpenDB(opts)
+	if err != nil {
+		return nil, err
+	}
+	configurePool(db)
+
+	now := time.Now()
+	entry := &poolEntry{
+		id:          dbConn.ID,
+		dbType:      dbConn.Type,
+		fingerprint: fingerprint,
+		db:          db,
+		createdAt:   now,
+		lastUsed:    now,
+	}
+
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	if existing, ok := pools[dbConn.ID]; ok && existing.fingerprint == fingerprint {
+		// 并发创建，使用先创建的连接池
+		db.Close()
+		existing.use(ref)
+		return existing, nil
+	} else if ok {
+		retireLocked(existing)
+	}
+	pools[dbConn.ID] = entry
+	poolsByDB[db] = entry
+	entry.use(ref)
+	return entry, nil
+}
+
+func (e *poolEntry) use(ref bool) {
+	if ref {
+		e.refs++
+	}
+	e.lastUsed = time.Now()
+}
+
+// configurePool 按配置设置连接池大小和连接生命周期
+func configurePool(db *sql.DB) {
+	cfg := config.GlobalConfig.Pool
+
+	maxOpen := cfg.MaxOpenConns
+	if maxOpen <= 0 {
+		maxOpen = defaultMaxOpenConns
+	}
+	maxIdle := cfg.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = defaultMaxIdleConns
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(secondsOr(cfg.ConnMaxLifetime, defaultConnMaxLifetime))
+	db.SetConnMaxIdleTime(secondsOr(cfg.ConnMaxIdleTime, defaultConnMaxIdleTime))
+}
+
+func secondsOr(seconds int, def time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return def
+}
+
+// connFingerprint 连接设置摘要（包括凭据、SSH和TLS设置）
+func connFingerprint(dbConn *models.DatabaseConnection) string {
+	h := sha256.New()
+	for _, v := range []string{dbConn.Type, dbConn.Host, dbConn.Port, dbConn.Username, dbConn.Password, dbConn.PasswordRef,
+		dbConn.Database, fmt.Sprint(dbConn.SSHEnabled), dbConn.SSHHost, dbConn.SSHPort, dbConn.SSHUser, dbConn.SSHPassword,
+		dbConn.SSHPrivateKey, dbConn.SSHPassphrase, dbConn.SSHKnownHosts, dbConn.TLSMode, dbConn.TLSCACert,
+		dbConn.TLSClientCert, dbConn.TLSClientKey, dbConn.TLSServerName, dbConn.ExtraParams} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// retireLocked 将连接池移出缓存，无人使用时立即关闭，否则在最后一次归还时关闭
+func retireLocked(entry *poolEntry) {
+	if pools[entry.id] == entry {
+		delete(pools, entry.id)
+	}
+	entry.retired = true
+	// 隧道从缓存中移除，新的连接池会建立新的隧道
+	entry.tunnels = append(entry.tunnels, detachTunnels(entry.id)...)
+	if entry.refs <= 0 {
+		closeEntryLocked(entry)
+	}
+}
+
+func closeEntryLocked(entry *poolEntry) {
+	delete(poolsByDB, entry.db)
+	entry.db.Close()
+	for _, t := range entry.tunnels {
+		t.close()
+	}
+	entry.tunnels = nil
+}
+
+// ReleaseConnection 归还 GetRawConnection 获取的连接；未放入连接池的连接直接关闭
+func ReleaseConnection(db *sql.DB) {
+	if db == nil {
+		return
+	}
+
+	poolMu.Lock()
+	defer poolMu.Unlock()
+
+	entry, ok := poolsByDB[db]
+	if !ok {
+		db.Close()
+		return
+	}
+	releaseLocked(entry)
+}
+
+// releaseLocked 减少连接池的使用次数，已失效的连接池在最后一次归还时关闭
+func releaseLocked(entry *poolEntry) {
+	if entry.refs > 0 {
+		entry.refs--
+	}
+	entry.lastUsed = time.Now()
+	if entry.retired && entry.refs == 0 {
+		closeEntryLocked(entry)
+	}
+}
+
+// invalidatePool 使连接的连接池失效（连接配置更新或删除后调用）
+func invalidatePool(dbConnID uint) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+
+	if entry, ok := pools[dbConnID]; ok {
+		retireLocked(entry)
+		return
+	}
+	for _, t := range detachTunnels(dbConnID) {
+		t.close()
+	}
+}
+
+// reapIdlePools 定期关闭长时间未使用的连接池
+func reapIdlePools() {
+	ticker := time.NewTicker(poolReapInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		retireIdlePools(secondsOr(config.GlobalConfig.Pool.IdleTimeout, defaultPoolIdleTimeout))
+	}
+}
+
+// retireIdlePools 关闭无人使用且超过 idleTimeout 未使用的连接池
+func retireIdlePools(idleTimeout time.Duration) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+
+	for _, entry := range pools {
+		if entry.refs == 0 && time.Since(entry.lastUsed) > idleTimeout {
+			retireLocked(entry)
+		}
+	}
+}
+
+// GetPoolStats 获取所有连接池的统计信息
+func GetPoolStats() []PoolStats {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+
+	result := make([]PoolStats, 0, len(pools))
+	for _, entry := range pools {
+		stats := entry.db.Stats()
+		result = append(result, PoolStats{
+			ConnectionID:       entry.id,
+			Type:               entry.dbType,
+			ActiveUsers:        entry.refs,
+			CreatedAt:          entry.createdAt,
+			LastUsedAt:         entry.lastUsed,
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ConnectionID < result[j].ConnectionID })
+	return result
+}
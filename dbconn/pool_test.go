@@ -0,0 +1,161 @@
+package dbconn
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+)
+
+// newPoolTestConn 返回位于临时目录中的SQLite连接配置
+func newPoolTestConn(t *testing.T, id uint) *models.DatabaseConnection {
+	t.Helper()
+	dir := t.TempDir()
+	prev := config.GlobalConfig
+	config.GlobalConfig = &config.Config{SQLite: config.SQLiteConfig{DataDirs: []string{dir}}}
+	t.Cleanup(func() {
+		CloseConnection(id)
+		config.GlobalConfig = prev
+	})
+	return &models.DatabaseConnection{ID: id, Name: "pool", Type: "sqlite", Database: filepath.Join(dir, "pool.db")}
+}
+
+func mustGetRaw(t *testing.T, conn *models.DatabaseConnection) *sql.DB {
+	t.Helper()
+	db, err := GetRawConnection(conn)
+	if err != nil {
+		t.Fatalf("GetRawConnection: %v", err)
+	}
+	return db
+}
+
+func poolRefs(id uint) (int, bool) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	entry, ok := pools[id]
+	if !ok {
+		return 0, false
+	}
+	return entry.refs, true
+}
+
+// isClosed 判断连接池是否已关闭
+func isClosed(db *sql.DB) bool {
+	return db.Ping() != nil
+}
+
+func TestGetRawConnectionSharesPool(t *testing.T) {
+	conn := newPoolTestConn(t, 9101)
+
+	db1, db2 := mustGetRaw(t, conn), mustGetRaw(t, conn)
+	if db1 != db2 {
+		t.Fatal("同一连接应共用连接池")
+	}
+	if refs, _ := poolRefs(conn.ID); refs != 2 {
+		t.Errorf("refs = %d, want 2", refs)
+	}
+
+	ReleaseConnection(db1)
+	ReleaseConnection(db2)
+	if refs, ok := poolRefs(conn.ID); !ok || refs != 0 {
+		t.Errorf("归还后 refs = %d, cached = %v, want 0, true", refs, ok)
+	}
+	if isClosed(db1) {
+		t.Error("归还后连接池应保留以便复用")
+	}
+}
+
+func TestInvalidatePoolKeepsInUsePool(t *testing.T) {
+	conn := newPoolTestConn(t, 9102)
+	db := mustGetRaw(t, conn)
+
+	CloseConnection(conn.ID)
+	if _, ok := poolRefs(conn.ID); ok {
+		t.Error("失效的连接池应移出缓存")
+	}
+	if isClosed(db) {
+		t.Fatal("正在使用的连接池不应被关闭")
+	}
+
+	// 失效后获取的是新的连接池
+	fresh := mustGetRaw(t, conn)
+	if fresh == db {
+		t.Error("失效后应创建新的连接池")
+	}
+	ReleaseConnection(fresh)
+
+	// 最后一次归还时关闭
+	ReleaseConnection(db)
+	if !isClosed(db) {
+		t.Error("失效的连接池在归还后应关闭")
+	}
+	if isClosed(fresh) {
+		t.Error("新的连接池不应受影响")
+	}
+}
+
+func TestSettingsChangeRetiresOldPool(t *testing.T) {
+	conn := newPoolTestConn(t, 9103)
+	db := mustGetRaw(t, conn)
+
+	changed := *conn
+	changed.Database = filepath.Join(filepath.Dir(conn.Database), "other.db")
+	other := mustGetRaw(t, &changed)
+	defer ReleaseConnection(other)
+	if other == db {
+		t.Fatal("连接设置变化后应创建新的连接池")
+	}
+	if isClosed(db) {
+		t.Fatal("旧连接池仍在使用，不应关闭")
+	}
+	ReleaseConnection(db)
+	if !isClosed(db) {
+		t.Error("旧连接池归还后应关闭")
+	}
+}
+
+func TestRetireIdlePools(t *testing.T) {
+	conn := newPoolTestConn(t, 9104)
+	db := mustGetRaw(t, conn)
+
+	// 长时间未使用但仍在使用中的连接池不会被回收
+	setLastUsed(conn.ID, time.Now().Add(-time.Hour))
+	retireIdlePools(time.Minute)
+	if _, ok := poolRefs(conn.ID); !ok || isClosed(db) {
+		t.Fatal("正在使用的连接池被回收")
+	}
+
+	// 归还后未超时不回收
+	ReleaseConnection(db)
+	retireIdlePools(time.Minute)
+	if _, ok := poolRefs(conn.ID); !ok || isClosed(db) {
+		t.Fatal("刚归还的连接池被回收")
+	}
+
+	setLastUsed(conn.ID, time.Now().Add(-time.Hour))
+	retireIdlePools(time.Minute)
+	if _, ok := poolRefs(conn.ID); ok || !isClosed(db) {
+		t.Error("空闲超时的连接池应关闭")
+	}
+}
+
+func setLastUsed(id uint, at time.Time) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	pools[id].lastUsed = at
+}
+
+func TestUnsavedConnectionIsNotPooled(t *testing.T) {
+	conn := newPoolTestConn(t, 0)
+	db := mustGetRaw(t, conn)
+	if _, ok := poolRefs(0); ok {
+		t.Error("未保存的连接不应放入连接池")
+	}
+	ReleaseConnection(db)
+	if !isClosed(db) {
+		t.Error("未放入连接池的连接归还时应关闭")
+	}
+}
@@ -0,0 +1,248 @@
+package dbconn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/utils"
+)
+
+const (
+	defaultSecretCacheTTL  = 5 * time.Minute   // 外部密钥默认缓存时间
+	defaultSecretEnvPrefix = "DB_SYNC_SECRET_" // env引用默认允许的环境变量前缀
+)
+
+// SecretProvider 外部密钥提供者，根据引用（不含 scheme 前缀）返回密钥内容
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+var (
+	providersMu     sync.RWMutex
+	secretProviders = map[string]SecretProvider{
+		"env":   &envSecretProvider{},
+		"file":  &fileSecretProvider{},
+		"vault": &vaultSecretProvider{client: &http.Client{Timeout: 10 * time.Second}},
+	}
+)
+
+// RegisterSecretProvider 注册外部密钥提供者（同名会被替换）
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	secretProviders[scheme] = provider
+}
+
+// parseSecretRef 拆分密钥引用 scheme:ref
+func parseSecretRef(ref string) (SecretProvider, string, error) {
+	scheme, rest, ok := strings.Cut(ref, ":")
+	if !ok || rest == "" {
+		return nil, "", fmt.Errorf("密钥引用格式错误，应为 scheme:ref")
+	}
+
+	providersMu.RLock()
+	provider, exists := secretProviders[scheme]
+	providersMu.RUnlock()
+	if !exists {
+		return nil, "", fmt.Errorf("不支持的密钥提供者: %s", scheme)
+	}
+	return provider, rest, nil
+}
+
+// ValidateSecretRef 校验密钥引用格式及提供者是否存在
+func ValidateSecretRef(ref string) error {
+	_, _, err := parseSecretRef(ref)
+	return err
+}
+
+// cachedSecret 缓存的外部密钥
+type cachedSecret struct {
+	value     string
+	expiresAt time.Time
+}
+
+var secretCache sync.Map
+
+// resolvePassword 获取连接密码：有外部引用时从提供者获取（带缓存），否则解密保存的密码
+func resolvePassword(dbConn *models.DatabaseConnection) (string, error) {
+	if dbConn.PasswordRef == "" {
+		password, err := utils.DecryptSecret(dbConn.Password)
+		if err != nil {
+			return "", fmt.Errorf("解密数据库密码失败: %v", err)
+		}
+		return password, nil
+	}
+
+	if cached, ok := secretCache.Load(dbConn.PasswordRef); ok {
+		secret := cached.(*cachedSecret)
+		if time.Now().Before(secret.expiresAt) {
+			return secret.value, nil
+		}
+	}
+
+	provider, ref, err := parseSecretRef(dbConn.PasswordRef)
+	if err != nil {
+		return "", err
+	}
+	value, err := provider.Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("获取外部密钥失败: %v", err)
+	}
+
+	secretCache.Store(dbConn.PasswordRef, &cachedSecret{value: value, expiresAt: time.Now().Add(secretCacheTTL())})
+	return value, nil
+}
+
+// InvalidateSecret 清除外部密钥缓存（密钥轮换后调用）
+func InvalidateSecret(ref string) {
+	secretCache.Delete(ref)
+}
+
+func secretCacheTTL() time.Duration {
+	if ttl := config.GlobalConfig.Secrets.CacheTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultSecretCacheTTL
+}
+
+// envSecretProvider 从环境变量读取：env:NAME，只允许读取配置前缀的变量，避免泄露其他环境变量
+type envSecretProvider struct{}
+
+func (p *envSecretProvider) Resolve(ref string) (string, error) {
+	prefix := config.GlobalConfig.Secrets.EnvPrefix
+	if prefix == "" {
+		prefix = defaultSecretEnvPrefix
+	}
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("只允许读取以 %s 开头的环境变量", prefix)
+	}
+
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("环境变量 %s 不存在", ref)
+	}
+	return value, nil
+}
+
+// fileSecretProvider 从文件读取（如挂载的Kubernetes Secret）：file:/path，去除末尾换行
+// 只允许读取配置目录下的文件，避免通过连接配置读取服务器上的任意文件
+type fileSecretProvider struct{}
+
+func (p *fileSecretProvider) Resolve(ref string) (string, error) {
+	path, allowed, err := PathWithinDirs(ref, config.GlobalConfig.Secrets.FileDirs)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", fmt.Errorf("文件 %s 不在允许的密钥目录中", ref)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// PathWithinDirs 解析文件的绝对路径（跟随符号链接），并判断是否位于允许的目录中
+func PathWithinDirs(ref string, dirs []string) (string, bool, error) {
+	path, err := filepath.Abs(ref)
+	if err != nil {
+		return "", false, err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	for _, dir := range dirs {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return path, true, nil
+		}
+	}
+	return path, false, nil
+}
+
+// vaultSecretProvider 兼容HashiCorp Vault HTTP API：vault:<path>#<key>
+// 支持KV v1（data.<key>）和KV v2（data.data.<key>），path 如 secret/data/db
+type vaultSecretProvider struct {
+	client *http.Client
+}
+
+func (p *vaultSecretProvider) Resolve(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("Vault密钥引用格式错误，应为 vault:<path>#<key>")
+	}
+
+	cfg := config.GlobalConfig.Secrets.Vault
+	address := cfg.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	token := cfg.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if address == "" {
+		return "", fmt.Errorf("未配置Vault地址")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(address, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", cfg.Namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Vault返回状态码 %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("解析Vault响应失败: %v", err)
+	}
+
+	data := body.Data
+	// KV v2 的内容位于 data.data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nested
+		}
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("Vault密钥 %s 中不存在 %s", path, key)
+	}
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("Vault密钥 %s 的 %s 不是字符串", path, key)
+	}
+	return str, nil
+}
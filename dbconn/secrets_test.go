@@ -0,0 +1,161 @@
+package dbconn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+)
+
+func withSecretsConfig(t *testing.T, cfg config.SecretsConfig) {
+	t.Helper()
+	prev := config.GlobalConfig
+	config.GlobalConfig = &config.Config{Secrets: cfg}
+	t.Cleanup(func() { config.GlobalConfig = prev })
+}
+
+func TestEnvSecretProvider(t *testing.T) {
+	withSecretsConfig(t, config.SecretsConfig{})
+	t.Setenv("DB_SYNC_SECRET_DB", "s3cret")
+	t.Setenv("HOME_TOKEN", "private")
+	p := &envSecretProvider{}
+
+	if got, err := p.Resolve("DB_SYNC_SECRET_DB"); err != nil || got != "s3cret" {
+		t.Errorf("Resolve = %q, %v", got, err)
+	}
+	// 只能读取允许前缀的环境变量
+	if _, err := p.Resolve("HOME_TOKEN"); err == nil {
+		t.Error("不应读取前缀之外的环境变量")
+	}
+	if _, err := p.Resolve("DB_SYNC_SECRET_MISSING"); err == nil {
+		t.Error("不存在的环境变量应报错")
+	}
+
+	withSecretsConfig(t, config.SecretsConfig{EnvPrefix: "HOME_"})
+	if got, err := p.Resolve("HOME_TOKEN"); err != nil || got != "private" {
+		t.Errorf("Resolve = %q, %v", got, err)
+	}
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	secretFile := filepath.Join(dir, "password")
+	outsideFile := filepath.Join(outside, "password")
+	os.WriteFile(secretFile, []byte("s3cret\r\n"), 0600)
+	os.WriteFile(outsideFile, []byte("private"), 0600)
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(outsideFile, link); err != nil {
+		t.Fatal(err)
+	}
+	p := &fileSecretProvider{}
+
+	// 未配置目录时禁止读取文件
+	withSecretsConfig(t, config.SecretsConfig{})
+	if _, err := p.Resolve(secretFile); err == nil {
+		t.Error("未配置密钥目录时不应读取文件")
+	}
+
+	withSecretsConfig(t, config.SecretsConfig{FileDirs: []string{dir}})
+	if got, err := p.Resolve(secretFile); err != nil || got != "s3cret" {
+		t.Errorf("Resolve = %q, %v", got, err)
+	}
+	for _, ref := range []string{outsideFile, filepath.Join(dir, "..", filepath.Base(outside), "password"), link} {
+		if _, err := p.Resolve(ref); err == nil {
+			t.Errorf("不应读取密钥目录之外的文件 %s", ref)
+		}
+	}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/db":
+			w.Write([]byte(`{"data":{"password":"v1-secret","port":5432}}`))
+		case "/v1/secret/data/db":
+			w.Write([]byte(`{"data":{"data":{"password":"v2-secret"},"metadata":{"version":3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	withSecretsConfig(t, config.SecretsConfig{Vault: config.VaultConfig{Address: server.URL + "/", Token: "token", Namespace: "team"}})
+	p := &vaultSecretProvider{client: server.Client()}
+
+	for ref, want := range map[string]string{"kv/db#password": "v1-secret", "/secret/data/db#password": "v2-secret"} {
+		if got, err := p.Resolve(ref); err != nil || got != want {
+			t.Errorf("Resolve(%s) = %q, %v, want %q", ref, got, err, want)
+		}
+	}
+	for _, ref := range []string{"kv/db", "kv/db#missing", "kv/db#port", "kv/other#password"} {
+		if _, err := p.Resolve(ref); err == nil {
+			t.Errorf("Resolve(%s) 应报错", ref)
+		}
+	}
+
+	withSecretsConfig(t, config.SecretsConfig{Vault: config.VaultConfig{Address: server.URL, Token: "wrong", Namespace: "team"}})
+	if _, err := p.Resolve("kv/db#password"); err == nil {
+		t.Error("Vault拒绝访问时应报错")
+	}
+}
+
+// countingSecretProvider 返回固定密钥并记录调用次数
+type countingSecretProvider struct {
+	calls int
+}
+
+func (p *countingSecretProvider) Resolve(ref string) (string, error) {
+	p.calls++
+	return "value-of-" + ref, nil
+}
+
+func TestResolvePasswordCachesExternalSecrets(t *testing.T) {
+	withSecretsConfig(t, config.SecretsConfig{})
+	provider := &countingSecretProvider{}
+	RegisterSecretProvider("counting", provider)
+	conn := &models.DatabaseConnection{Password: "ignored", PasswordRef: "counting:db"}
+	defer InvalidateSecret(conn.PasswordRef)
+
+	for i := 0; i < 2; i++ {
+		if got, err := resolvePassword(conn); err != nil || got != "value-of-db" {
+			t.Fatalf("resolvePassword = %q, %v", got, err)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("提供者被调用 %d 次, want 1（应使用缓存）", provider.calls)
+	}
+
+	// 密钥轮换后清除缓存重新获取
+	InvalidateSecret(conn.PasswordRef)
+	resolvePassword(conn)
+	if provider.calls != 2 {
+		t.Errorf("清除缓存后提供者被调用 %d 次, want 2", provider.calls)
+	}
+
+	// 没有外部引用时使用保存的密码
+	if got, err := resolvePassword(&models.DatabaseConnection{Password: "plain"}); err != nil || got != "plain" {
+		t.Errorf("resolvePassword = %q, %v", got, err)
+	}
+}
+
+func TestValidateSecretRef(t *testing.T) {
+	for ref, ok := range map[string]bool{
+		"env:DB_SYNC_SECRET_DB":    true,
+		"file:/run/secrets/db":     true,
+		"vault:secret/data/db#pwd": true,
+		"env:":                     false,
+		"DB_SYNC_SECRET_DB":        false,
+		"aws:db":                   false,
+	} {
+		if err := ValidateSecretRef(ref); (err == nil) != ok {
+			t.Errorf("ValidateSecretRef(%q) = %v, want ok=%v", ref, err, ok)
+		}
+	}
+}
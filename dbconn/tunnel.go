@@ -0,0 +1,301 @@
+package dbconn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/utils"
+)
+
+// sshDialTimeout 连接SSH跳板机的超时时间
+const sshDialTimeout = 15 * time.Second
+
+// sshTunnel 进程内SSH本地端口转发：监听本地随机端口，将连接经跳板机转发到数据库地址
+type sshTunnel struct {
+	sshAddr    string
+	remoteAddr string
+	config     *ssh.ClientConfig
+	listener   net.Listener
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+var tunnels sync.Map // key: 连接ID|设置摘要 -> *sshTunnel
+
+// endpoint 返回连接数据库使用的地址：未启用SSH隧道时为配置的地址，否则为本地转发地址
+func endpoint(dbConn *models.DatabaseConnection) (string, string, error) {
+	if !dbConn.SSHEnabled {
+		return dbConn.Host, dbConn.Port, nil
+	}
+
+	key := tunnelKey(dbConn)
+	if t, ok := tunnels.Load(key); ok {
+		return t.(*sshTunnel).localAddr()
+	}
+
+	tunnel, err := newSSHTunnel(dbConn)
+	if err != nil {
+		return "", "", fmt.Errorf("建立SSH隧道失败: %v", err)
+	}
+	if existing, loaded := tunnels.LoadOrStore(key, tunnel); loaded {
+		tunnel.close()
+		return existing.(*sshTunnel).localAddr()
+	}
+	go tunnel.serve()
+	return tunnel.localAddr()
+}
+
+// tunnelKey 隧道缓存键，SSH设置或目标地址变化后使用新的隧道
+func tunnelKey(dbConn *models.DatabaseConnection) string {
+	h := sha256.New()
+	for _, v := range []string{dbConn.Host, dbConn.Port, dbConn.SSHHost, dbConn.SSHPort, dbConn.SSHUser,
+		dbConn.SSHPassword, dbConn.SSHPrivateKey, dbConn.SSHPassphrase, dbConn.SSHKnownHosts} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%d|%s", dbConn.ID, hex.EncodeToString(h.Sum(nil)[:8]))
+}
+
+// detachTunnels 将连接的所有SSH隧道移出缓存并返回，由调用方在不再使用时关闭
+func detachTunnels(dbConnID uint) []*sshTunnel {
+	var detached []*sshTunnel
+	prefix := fmt.Sprintf("%d|", dbConnID)
+	tunnels.Range(func(key, value interface{}) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			tunnels.Delete(key)
+			detached = append(detached, value.(*sshTunnel))
+		}
+		return true
+	})
+	return detached
+}
+
+// closeTunnel 关闭连接当前设置对应的SSH隧道
+func closeTunnel(dbConn *models.DatabaseConnection) {
+	if t, ok := tunnels.LoadAndDelete(tunnelKey(dbConn)); ok {
+		t.(*sshTunnel).close()
+	}
+}
+
+// newSSHTunnel 创建SSH隧道：校验配置、连接跳板机并监听本地端口
+func newSSHTunnel(dbConn *models.DatabaseConnection) (*sshTunnel, error) {
+	if dbConn.SSHHost == "" || dbConn.SSHUser == "" {
+		return nil, fmt.Errorf("SSH主机和用户名不能为空")
+	}
+	sshPort := dbConn.SSHPort
+	if sshPort == "" {
+		sshPort = "22"
+	}
+
+	auth, err := sshAuthMethods(dbConn)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := sshHostKeyCallback(dbConn.SSHKnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &sshTunnel{
+		sshAddr:    net.JoinHostPort(dbConn.SSHHost, sshPort),
+		remoteAddr: net.JoinHostPort(dbConn.Host, dbConn.Port),
+		config: &ssh.ClientConfig{
+			User:            dbConn.SSHUser,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         sshDialTimeout,
+		},
+	}
+
+	// 先连接一次，尽早发现认证或主机公钥错误
+	if _, err := t.sshClient(); err != nil {
+		return nil, err
+	}
+
+	t.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// sshAuthMethods 根据配置的密码或私钥生成认证方式
+func sshAuthMethods(dbConn *models.DatabaseConnection) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	if dbConn.SSHPrivateKey != "" {
+		key, err := utils.DecryptSecret(dbConn.SSHPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("解密SSH私钥失败: %v", err)
+		}
+		passphrase, err := utils.DecryptSecret(dbConn.SSHPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("解密SSH私钥密码失败: %v", err)
+		}
+
+		var signer ssh.Signer
+		if passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(key), []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(key))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析SSH私钥失败: %v", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if dbConn.SSHPassword != "" {
+		password, err := utils.DecryptSecret(dbConn.SSHPassword)
+		if err != nil {
+			return nil, fmt.Errorf("解密SSH密码失败: %v", err)
+		}
+		methods = append(methods, ssh.Password(password))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("需要提供SSH密码或私钥")
+	}
+	return methods, nil
+}
+
+// sshHostKeyCallback 校验跳板机公钥：优先使用连接配置的known_hosts内容，否则使用全局known_hosts文件
+func sshHostKeyCallback(knownHosts string) (ssh.HostKeyCallback, error) {
+	if strings.TrimSpace(knownHosts) != "" {
+		// knownhosts 只能从文件读取，写入临时文件后立即删除
+		f, err := os.CreateTemp("", "known_hosts")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.WriteString(knownHosts)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		callback, err := knownhosts.New(f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("解析known_hosts失败: %v", err)
+		}
+		return callback, nil
+	}
+
+	path := config.GlobalConfig.SSH.KnownHostsFile
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("未配置SSH主机公钥（known_hosts）")
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("未配置SSH主机公钥（known_hosts）: %v", err)
+	}
+	return callback, nil
+}
+
+// sshClient 获取SSH客户端，断开后自动重连
+func (t *sshTunnel) sshClient() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, fmt.Errorf("SSH隧道已关闭")
+	}
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	client, err := ssh.Dial("tcp", t.sshAddr, t.config)
+	if err != nil {
+		return nil, err
+	}
+	t.client = client
+
+	// 连接断开后清除，下次使用时重连
+	go func() {
+		client.Wait()
+		t.mu.Lock()
+		if t.client == client {
+			t.client = nil
+		}
+		t.mu.Unlock()
+	}()
+	return client, nil
+}
+
+func (t *sshTunnel) localAddr() (string, string, error) {
+	host, port, err := net.SplitHostPort(t.listener.Addr().String())
+	return host, port, err
+}
+
+// serve 接受本地连接并转发
+func (t *sshTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(local)
+	}
+}
+
+// forward 经跳板机连接数据库，双向复制数据
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	client, err := t.sshClient()
+	if err != nil {
+		log.Printf("SSH隧道 %s 连接失败: %v", t.sshAddr, err)
+		return
+	}
+	remote, err := client.Dial("tcp", t.remoteAddr)
+	if err != nil {
+		log.Printf("SSH隧道 %s 连接 %s 失败: %v", t.sshAddr, t.remoteAddr, err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// close 关闭本地监听和SSH连接
+func (t *sshTunnel) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	if t.listener != nil {
+		t.listener.Close()
+	}
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+}
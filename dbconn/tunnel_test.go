@@ -0,0 +1,311 @@
+package dbconn
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/models"
+)
+
+// newTestSigner 生成ed25519密钥，返回签名器和OpenSSH格式的私钥（passphrase 不为空时加密）
+func newTestSigner(t *testing.T, passphrase string) (ssh.Signer, string) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(key, "")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, string(pem.EncodeToMemory(block))
+}
+
+// startSSHServer 启动只支持端口转发（direct-tcpip）的SSH服务，接受密码 "secret" 或 clientKey 认证
+func startSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) string {
+	t.Helper()
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "jump" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if clientKey != nil && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSHConn(conn, cfg)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveSSHConn(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			remote.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			defer remote.Close()
+			go io.Copy(remote, channel)
+			io.Copy(channel, remote)
+		}()
+	}
+}
+
+// startEchoServer 启动回显服务，模拟跳板机后的数据库
+func startEchoServer(t *testing.T) (string, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return host, port
+}
+
+func knownHostsLine(addr string, key ssh.PublicKey) string {
+	return knownhosts.Line([]string{knownhosts.Normalize(addr)}, key) + "\n"
+}
+
+func TestSSHAuthMethods(t *testing.T) {
+	_, plainKey := newTestSigner(t, "")
+	_, encryptedKey := newTestSigner(t, "phrase")
+
+	tests := []struct {
+		name    string
+		conn    models.DatabaseConnection
+		methods int
+	}{
+		{"none", models.DatabaseConnection{}, 0},
+		{"password", models.DatabaseConnection{SSHPassword: "secret"}, 1},
+		{"key", models.DatabaseConnection{SSHPrivateKey: plainKey}, 1},
+		{"encrypted key", models.DatabaseConnection{SSHPrivateKey: encryptedKey, SSHPassphrase: "phrase"}, 1},
+		{"wrong passphrase", models.DatabaseConnection{SSHPrivateKey: encryptedKey, SSHPassphrase: "wrong"}, 0},
+		{"missing passphrase", models.DatabaseConnection{SSHPrivateKey: encryptedKey}, 0},
+		{"invalid key", models.DatabaseConnection{SSHPrivateKey: "not a key"}, 0},
+		{"key and password", models.DatabaseConnection{SSHPrivateKey: plainKey, SSHPassword: "secret"}, 2},
+	}
+	for _, tt := range tests {
+		methods, err := sshAuthMethods(&tt.conn)
+		if tt.methods == 0 {
+			if err == nil {
+				t.Errorf("%s: 应报错", tt.name)
+			}
+			continue
+		}
+		if err != nil || len(methods) != tt.methods {
+			t.Errorf("%s: got %d methods, %v, want %d", tt.name, len(methods), err, tt.methods)
+		}
+	}
+}
+
+func TestSSHHostKeyCallback(t *testing.T) {
+	hostKey, _ := newTestSigner(t, "")
+	otherKey, _ := newTestSigner(t, "")
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 2222}
+	line := knownHostsLine(addr.String(), hostKey.PublicKey())
+
+	// 连接配置的known_hosts内容
+	callback, err := sshHostKeyCallback(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := callback(addr.String(), addr, hostKey.PublicKey()); err != nil {
+		t.Errorf("已知主机公钥校验失败: %v", err)
+	}
+	if err := callback(addr.String(), addr, otherKey.PublicKey()); err == nil {
+		t.Error("公钥不匹配时应拒绝连接")
+	}
+	if _, err := sshHostKeyCallback("not a known_hosts line"); err == nil {
+		t.Error("格式错误的known_hosts应报错")
+	}
+
+	// 未配置时使用全局known_hosts文件
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	os.WriteFile(file, []byte(line), 0600)
+	prev := config.GlobalConfig
+	defer func() { config.GlobalConfig = prev }()
+	config.GlobalConfig = &config.Config{SSH: config.SSHConfig{KnownHostsFile: file}}
+	callback, err = sshHostKeyCallback("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := callback(addr.String(), addr, hostKey.PublicKey()); err != nil {
+		t.Errorf("已知主机公钥校验失败: %v", err)
+	}
+
+	config.GlobalConfig = &config.Config{SSH: config.SSHConfig{KnownHostsFile: filepath.Join(t.TempDir(), "missing")}}
+	if _, err := sshHostKeyCallback(""); err == nil {
+		t.Error("没有可用的known_hosts时应报错，不能跳过主机公钥校验")
+	}
+}
+
+func TestTunnelKey(t *testing.T) {
+	base := models.DatabaseConnection{ID: 7, Name: "db", Host: "db.internal", Port: "5432", SSHHost: "jump", SSHUser: "u"}
+	renamed, moved := base, base
+	renamed.Name = "renamed"
+	moved.SSHHost = "jump2"
+
+	if tunnelKey(&base) != tunnelKey(&renamed) {
+		t.Error("名称变化不应使用新的隧道")
+	}
+	if tunnelKey(&base) == tunnelKey(&moved) {
+		t.Error("SSH设置变化后应使用新的隧道")
+	}
+}
+
+func TestSSHTunnelForwardsConnections(t *testing.T) {
+	hostKey, _ := newTestSigner(t, "")
+	clientKey, privateKey := newTestSigner(t, "phrase")
+	sshAddr := startSSHServer(t, hostKey, clientKey.PublicKey())
+	sshHost, sshPort, _ := net.SplitHostPort(sshAddr)
+	dbHost, dbPort := startEchoServer(t)
+
+	conn := &models.DatabaseConnection{
+		ID: 9001, Host: dbHost, Port: dbPort,
+		SSHEnabled: true, SSHHost: sshHost, SSHPort: sshPort, SSHUser: "jump",
+		SSHPrivateKey: privateKey, SSHPassphrase: "phrase",
+		SSHKnownHosts: knownHostsLine(sshAddr, hostKey.PublicKey()),
+	}
+	defer closeTunnel(conn)
+
+	host, port, err := endpoint(conn)
+	if err != nil {
+		t.Fatalf("endpoint: %v", err)
+	}
+	if host != "127.0.0.1" || port == dbPort {
+		t.Errorf("endpoint = %s:%s, want local forward", host, port)
+	}
+	if again, againPort, _ := endpoint(conn); again != host || againPort != port {
+		t.Error("相同设置应复用已建立的隧道")
+	}
+
+	local, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	local.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(local, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("经隧道读取 %q, %v", buf, err)
+	}
+
+	// 关闭后不再接受本地连接
+	closeTunnel(conn)
+	if c, err := net.Dial("tcp", net.JoinHostPort(host, port)); err == nil {
+		c.Close()
+		t.Error("隧道关闭后仍接受连接")
+	}
+}
+
+func TestSSHTunnelRejectsUnknownHostKey(t *testing.T) {
+	hostKey, _ := newTestSigner(t, "")
+	otherKey, _ := newTestSigner(t, "")
+	sshAddr := startSSHServer(t, hostKey, nil)
+	sshHost, sshPort, _ := net.SplitHostPort(sshAddr)
+
+	conn := &models.DatabaseConnection{
+		ID: 9002, Host: "127.0.0.1", Port: "1",
+		SSHEnabled: true, SSHHost: sshHost, SSHPort: sshPort, SSHUser: "jump", SSHPassword: "secret",
+		SSHKnownHosts: knownHostsLine(sshAddr, otherKey.PublicKey()),
+	}
+	if _, _, err := endpoint(conn); err == nil {
+		closeTunnel(conn)
+		t.Fatal("跳板机公钥不匹配时应拒绝建立隧道")
+	}
+
+	conn.SSHKnownHosts = knownHostsLine(sshAddr, hostKey.PublicKey())
+	conn.SSHPassword = "wrong"
+	if _, _, err := endpoint(conn); err == nil {
+		closeTunnel(conn)
+		t.Fatal("SSH认证失败时应报错")
+	}
+
+	// 未启用SSH时直接使用配置的地址
+	conn.SSHEnabled = false
+	if host, port, err := endpoint(conn); err != nil || host != "127.0.0.1" || port != "1" {
+		t.Errorf("endpoint = %s:%s, %v", host, port, err)
+	}
+}
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"zh.xyz/dv/sync/database"
@@ -12,22 +16,71 @@ import (
 
 type ConflictHandler struct{}
 
-// ListConflicts 列出所有冲突
+// ListConflicts 分页列出冲突，支持按状态、任务、表、冲突类型、时间范围和主键筛选
 func (h *ConflictHandler) ListConflicts(c *gin.Context) {
-	var conflicts []models.DataConflict
-	query := database.DB.Preload("Task").Preload("Resolver")
+	filter, err := parseConflictFilter(conflictFilterRequest{
+		Status:       c.Query("status"),
+		TableName:    c.Query("table_name"),
+		ConflictType: c.Query("conflict_type"),
+		StartTime:    c.Query("start_time"),
+		EndTime:      c.Query("end_time"),
+		PrimaryKey:   c.Query("primary_key"),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if taskID := c.Query("task_id"); taskID != "" {
+		id, err := strconv.ParseUint(taskID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的task_id"})
+			return
+		}
+		filter.TaskID = uint(id)
+	}
+	if targetDBID := c.Query("target_db_id"); targetDBID != "" {
+		id, err := strconv.ParseUint(targetDBID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的target_db_id"})
+			return
+		}
+		filter.TargetDBID = uint(id)
+	}
 
-	status := c.Query("status")
-	if status != "" {
-		query = query.Where("status = ?", status)
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 500 {
+		pageSize = 500 // 限制最大页大小
 	}
 
-	if err := query.Order("created_at DESC").Find(&conflicts).Error; err != nil {
+	var total int64
+	if err := filter.Apply(database.DB.Model(&models.DataConflict{})).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	var conflicts []models.DataConflict
+	query := filter.Apply(database.DB.Preload("Task").Preload("Resolver"))
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&conflicts).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": conflicts})
+	c.JSON(http.StatusOK, gin.H{
+		"data": conflicts,
+		"pagination": gin.H{
+			"total":      total,
+			"page":       page,
+			"page_size":  pageSize,
+			"total_page": (int(total) + pageSize - 1) / pageSize,
+		},
+	})
 }
 
 // GetConflict 获取单个冲突详情
@@ -40,7 +93,7 @@ func (h *ConflictHandler) GetConflict(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": conflict})
+	c.JSON(http.StatusOK, conflictDetailResponse(&conflict))
 }
 
 // ResolveConflict 处理冲突
@@ -49,7 +102,9 @@ func (h *ConflictHandler) ResolveConflict(c *gin.Context) {
 	id := c.Param("id")
 
 	var req struct {
-		Resolution string `json:"resolution" binding:"required,oneof=source target"` // source: 以源数据库为准, target: 以目标数据库为准
+		Resolution string                 `json:"resolution" binding:"required,oneof=source target merge"` // source: 以源数据库为准, target: 以目标数据库为准, merge: 按列合并
+		Columns    map[string]string      `json:"columns"`                                                // merge: 每列取值来源（source/target）
+		Values     map[string]interface{} `json:"values"`                                                 // merge: 手工编辑的列值
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -63,28 +118,28 @@ func (h *ConflictHandler) ResolveConflict(c *gin.Context) {
 		return
 	}
 
-	if conflict.Status == "resolved" {
+	if conflict.Status != "pending" && conflict.Status != "failed" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "冲突已处理"})
 		return
 	}
 
-	// 处理冲突：根据resolution决定使用哪个数据库的数据
-	resolvedBy := userID.(uint)
-	conflict.Resolution = req.Resolution
-	conflict.ResolvedBy = &resolvedBy
-	conflict.Status = "resolved"
-	now := conflict.CreatedAt
-	conflict.ResolvedAt = &now
-
-	if err := database.DB.Save(&conflict).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
-		return
+	// 处理冲突：根据resolution将对应数据写入数据库，失败时冲突标记为failed
+	var merge *service.MergeInput
+	if req.Resolution == "merge" {
+		merge = &service.MergeInput{Columns: req.Columns, Values: req.Values}
 	}
 
-	// 执行同步（应用resolution）
 	syncService := &service.SyncService{}
-	if err := syncService.ApplyConflictResolution(&conflict); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "应用冲突解决失败: " + err.Error()})
+	if err := syncService.ResolveConflict(&conflict, req.Resolution, merge, userID.(uint)); err != nil {
+		if errors.Is(err, service.ErrInvalidMerge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrConflictHandled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "应用冲突解决失败: " + err.Error(), "data": conflict})
 		return
 	}
 
@@ -100,24 +155,194 @@ func (h *ConflictHandler) ViewConflictByToken(c *gin.Context) {
 		return
 	}
 
-	// 解析token
-	tokenData, err := utils.ParseConflictViewToken(token)
+	// 校验token，查看链接及处理链接均可查看冲突
+	claims, _, err := service.ValidateConflictActionToken(token, utils.ConflictActionView, utils.ConflictActionResolveSource, utils.ConflictActionResolveTarget)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token: " + err.Error()})
+		return
+	}
+
+	var conflict models.DataConflict
+	if err := database.DB.Preload("Task").Preload("Resolver").First(&conflict, claims.ConflictID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "冲突记录不存在"})
+		return
+	}
+
+	response := conflictDetailResponse(&conflict)
+	response["action"] = claims.Action
+	c.JSON(http.StatusOK, response)
+}
+
+// ResolveConflictByToken 通过邮件中的处理链接处理冲突，链接仅可使用一次
+func (h *ConflictHandler) ResolveConflictByToken(c *gin.Context) {
+	token := c.Query("token")
+
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少token参数"})
+		return
+	}
+
+	claims, record, err := service.ValidateConflictActionToken(token, utils.ConflictActionResolveSource, utils.ConflictActionResolveTarget)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token: " + err.Error()})
 		return
 	}
 
-	conflictID, ok := tokenData["conflict_id"].(float64)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的token格式"})
+	// 接收人必须仍是有效的管理员
+	var user models.User
+	if err := database.DB.First(&user, claims.UserID).Error; err != nil || user.Status != "active" || user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
 		return
 	}
 
 	var conflict models.DataConflict
-	if err := database.DB.Preload("Task").Preload("Resolver").First(&conflict, uint(conflictID)).Error; err != nil {
+	if err := database.DB.Preload("Task").First(&conflict, claims.ConflictID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "冲突记录不存在"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": conflict})
+	if conflict.Status != "pending" && conflict.Status != "failed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "冲突已处理"})
+		return
+	}
+
+	syncService := &service.SyncService{}
+	if err := syncService.ResolveConflictByToken(&conflict, record, user.ID); err != nil {
+		if errors.Is(err, service.ErrConflictHandled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "应用冲突解决失败: " + err.Error(), "data": conflict})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "冲突处理成功", "data": conflict})
+}
+
+// RevokeConflictLinks 撤销冲突的所有邮件链接
+func (h *ConflictHandler) RevokeConflictLinks(c *gin.Context) {
+	id := c.Param("id")
+
+	var conflict models.DataConflict
+	if err := database.DB.First(&conflict, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "冲突记录不存在"})
+		return
+	}
+
+	if err := service.RevokeConflictActionTokens(conflict.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "链接已撤销"})
+}
+
+// BulkResolveConflicts 按筛选条件批量处理冲突（异步执行）
+func (h *ConflictHandler) BulkResolveConflicts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		conflictFilterRequest
+		TaskID     uint   `json:"task_id"`
+		TargetDBID uint   `json:"target_db_id"`
+		Resolution string `json:"resolution" binding:"required,oneof=source target"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := parseConflictFilter(req.conflictFilterRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.TaskID = req.TaskID
+	filter.TargetDBID = req.TargetDBID
+
+	syncService := &service.SyncService{}
+	job, err := syncService.CreateConflictBulkJob(filter, req.Resolution, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "批量处理任务已创建", "data": job})
+}
+
+// ListBulkJobs 列出批量处理冲突任务
+func (h *ConflictHandler) ListBulkJobs(c *gin.Context) {
+	var jobs []models.ConflictBulkJob
+	if err := database.DB.Order("created_at DESC").Limit(100).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// GetBulkJob 获取批量处理冲突任务的进度和结果
+func (h *ConflictHandler) GetBulkJob(c *gin.Context) {
+	id := c.Param("id")
+
+	var job models.ConflictBulkJob
+	if err := database.DB.First(&job, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "批量处理任务不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": job})
+}
+
+// conflictFilterRequest 冲突筛选条件请求参数
+type conflictFilterRequest struct {
+	Status       string `json:"status"`
+	TableName    string `json:"table_name"`
+	ConflictType string `json:"conflict_type"`
+	StartTime    string `json:"start_time"` // 格式：2006-01-02 15:04:05、2006-01-02 或 RFC3339
+	EndTime      string `json:"end_time"`
+	PrimaryKey   string `json:"primary_key"` // 主键值子串
+}
+
+// parseConflictFilter 解析冲突筛选条件
+func parseConflictFilter(req conflictFilterRequest) (service.ConflictFilter, error) {
+	filter := service.ConflictFilter{
+		Status:       req.Status,
+		TableName:    req.TableName,
+		ConflictType: req.ConflictType,
+		PrimaryKey:   req.PrimaryKey,
+	}
+
+	var err error
+	if filter.StartTime, err = parseFilterTime(req.StartTime); err != nil {
+		return filter, fmt.Errorf("无效的start_time: %v", err)
+	}
+	if filter.EndTime, err = parseFilterTime(req.EndTime); err != nil {
+		return filter, fmt.Errorf("无效的end_time: %v", err)
+	}
+	return filter, nil
+}
+
+// parseFilterTime 解析筛选时间，空字符串返回 nil
+func parseFilterTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("时间格式不正确: %s", value)
+}
+
+// conflictDetailResponse 构建冲突详情响应，附带列级差异
+func conflictDetailResponse(conflict *models.DataConflict) gin.H {
+	syncService := &service.SyncService{}
+	diff, err := syncService.ComputeConflictDiff(conflict)
+	if err != nil {
+		return gin.H{"data": conflict, "diff": nil, "diff_error": err.Error()}
+	}
+	return gin.H{"data": conflict, "diff": diff}
 }
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"zh.xyz/dv/sync/database"
@@ -15,13 +19,16 @@ type DBConnectionHandler struct{}
 func (h *DBConnectionHandler) CreateConnection(c *gin.Context) {
 	var req struct {
 		Name        string `json:"name" binding:"required"`
-		Type        string `json:"type" binding:"required,oneof=mysql oracle postgres"`
-		Host        string `json:"host" binding:"required"`
-		Port        string `json:"port" binding:"required"`
-		Username    string `json:"username" binding:"required"`
-		Password    string `json:"password" binding:"required"`
+		Type        string `json:"type" binding:"required"`
+		Host        string `json:"host" binding:"required_unless=Type sqlite"`
+		Port        string `json:"port" binding:"required_unless=Type sqlite"`
+		Username    string `json:"username" binding:"required_unless=Type sqlite"`
+		Password    string `json:"password"`
+		PasswordRef string `json:"password_ref"` // 外部密钥引用，与password二选一
 		Database    string `json:"database" binding:"required"`
 		Description string `json:"description"`
+		sshTunnelRequest
+		tlsRequest
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -29,18 +36,41 @@ func (h *DBConnectionHandler) CreateConnection(c *gin.Context) {
 		return
 	}
 
+	if err := validateDBType(req.Type); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePasswordInput(req.Password, req.PasswordRef); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.PasswordRef != "" && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": errSecretRefAdminOnly})
+		return
+	}
+	if err := req.sshTunnelRequest.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.tlsRequest.validate(req.Type); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 测试连接
 	testConn := &models.DatabaseConnection{
-		Type:     req.Type,
-		Host:     req.Host,
-		Port:     req.Port,
-		Username: req.Username,
-		Password: req.Password,
-		Database: req.Database,
+		Type:        req.Type,
+		Host:        req.Host,
+		Port:        req.Port,
+		Username:    req.Username,
+		Password:    req.Password,
+		PasswordRef: req.PasswordRef,
+		Database:    req.Database,
 	}
+	req.sshTunnelRequest.applyTo(testConn)
+	req.tlsRequest.applyTo(testConn)
 
-	_, err := dbconn.GetConnection(testConn)
-	if err != nil {
+	if err := dbconn.TestConnection(testConn); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "数据库连接测试失败: " + err.Error()})
 		return
 	}
@@ -52,11 +82,14 @@ func (h *DBConnectionHandler) CreateConnection(c *gin.Context) {
 		Host:        req.Host,
 		Port:        req.Port,
 		Username:    req.Username,
-		Password:    req.Password, // 实际应用中应该加密存储
+		Password:    req.Password, // 保存时加密（见 DatabaseConnection.BeforeSave）
+		PasswordRef: req.PasswordRef,
 		Database:    req.Database,
 		Description: req.Description,
 		Status:      "active",
 	}
+	req.sshTunnelRequest.applyTo(&dbConn)
+	req.tlsRequest.applyTo(&dbConn)
 
 	if err := database.DB.Create(&dbConn).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建数据库连接失败"})
@@ -102,6 +135,7 @@ func (h *DBConnectionHandler) UpdateConnection(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "数据库连接不存在"})
 		return
 	}
+	before := conn
 
 	var req struct {
 		Name        string `json:"name"`
@@ -109,9 +143,26 @@ func (h *DBConnectionHandler) UpdateConnection(c *gin.Context) {
 		Port        string `json:"port"`
 		Username    string `json:"username"`
 		Password    string `json:"password"`
+		PasswordRef string `json:"password_ref"`
 		Database    string `json:"database"`
 		Description string `json:"description"`
 		Status      string `json:"status"`
+
+		SSHEnabled    *bool  `json:"ssh_enabled"`
+		SSHHost       string `json:"ssh_host"`
+		SSHPort       string `json:"ssh_port"`
+		SSHUser       string `json:"ssh_user"`
+		SSHPassword   string `json:"ssh_password"`
+		SSHPrivateKey string `json:"ssh_private_key"`
+		SSHPassphrase string `json:"ssh_passphrase"`
+		SSHKnownHosts string `json:"ssh_known_hosts"`
+
+		TLSMode       string            `json:"tls_mode" binding:"omitempty,oneof=disable require verify-ca verify-full"`
+		TLSCACert     string            `json:"tls_ca_cert"`
+		TLSClientCert string            `json:"tls_client_cert"`
+		TLSClientKey  string            `json:"tls_client_key"`
+		TLSServerName string            `json:"tls_server_name"`
+		ExtraParams   map[string]string `json:"extra_params"` // 提供时整体替换，空对象表示清除
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -132,8 +183,25 @@ func (h *DBConnectionHandler) UpdateConnection(c *gin.Context) {
 	if req.Username != "" {
 		conn.Username = req.Username
 	}
+	if req.Password != "" && req.PasswordRef != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password和password_ref只能提供一个"})
+		return
+	}
 	if req.Password != "" {
 		conn.Password = req.Password
+		conn.PasswordRef = ""
+	}
+	if req.PasswordRef != "" {
+		if !isAdmin(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": errSecretRefAdminOnly})
+			return
+		}
+		if err := dbconn.ValidateSecretRef(req.PasswordRef); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dbconn.InvalidateSecret(req.PasswordRef)
+		conn.PasswordRef = req.PasswordRef
 	}
 	if req.Database != "" {
 		conn.Database = req.Database
@@ -144,12 +212,83 @@ func (h *DBConnectionHandler) UpdateConnection(c *gin.Context) {
 	if req.Status != "" {
 		conn.Status = req.Status
 	}
+	if req.SSHEnabled != nil {
+		conn.SSHEnabled = *req.SSHEnabled
+	}
+	if req.SSHHost != "" {
+		conn.SSHHost = req.SSHHost
+	}
+	if req.SSHPort != "" {
+		conn.SSHPort = req.SSHPort
+	}
+	if req.SSHUser != "" {
+		conn.SSHUser = req.SSHUser
+	}
+	if req.SSHPassword != "" {
+		conn.SSHPassword = req.SSHPassword
+	}
+	if req.SSHPrivateKey != "" {
+		conn.SSHPrivateKey = req.SSHPrivateKey
+		conn.SSHPassphrase = req.SSHPassphrase
+	}
+	if req.SSHKnownHosts != "" {
+		conn.SSHKnownHosts = req.SSHKnownHosts
+	}
+	if req.TLSMode != "" {
+		conn.TLSMode = req.TLSMode
+	}
+	if req.TLSCACert != "" {
+		conn.TLSCACert = req.TLSCACert
+	}
+	if req.TLSClientCert != "" || req.TLSClientKey != "" {
+		if req.TLSClientCert == "" || req.TLSClientKey == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tls_client_cert和tls_client_key需要同时提供"})
+			return
+		}
+		conn.TLSClientCert = req.TLSClientCert
+		conn.TLSClientKey = req.TLSClientKey
+	}
+	if req.TLSServerName != "" {
+		conn.TLSServerName = req.TLSServerName
+	}
+	if req.ExtraParams != nil {
+		if err := dbconn.ValidateExtraParams(conn.Type, req.ExtraParams); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		extraParams, err := encodeExtraParams(req.ExtraParams)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		conn.ExtraParams = extraParams
+	}
+	if conn.SSHEnabled && (conn.SSHHost == "" || conn.SSHUser == "" || (conn.SSHPassword == "" && conn.SSHPrivateKey == "")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "启用SSH隧道需要提供ssh_host、ssh_user以及ssh_password或ssh_private_key"})
+		return
+	}
+
+	// 连接设置变化后重新测试连接，测试失败不保存
+	if dbconn.SettingsChanged(&before, &conn) {
+		// 外部密钥会在连接时发送给数据库主机，普通用户不能修改使用外部密钥的连接的地址等设置
+		if conn.PasswordRef != "" && !isAdmin(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": errSecretRefAdminOnly})
+			return
+		}
+		if err := dbconn.TestConnection(&conn); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "数据库连接测试失败: " + err.Error()})
+			return
+		}
+	}
 
 	if err := database.DB.Save(&conn).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
 
+	// 连接设置可能已变化，关闭旧的连接池
+	dbconn.CloseConnection(conn.ID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "更新成功",
 		"data":    conn,
@@ -178,15 +317,23 @@ func (h *DBConnectionHandler) DeleteConnection(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
 
+// PoolStats 获取数据库连接池统计信息
+func (h *DBConnectionHandler) PoolStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": dbconn.GetPoolStats()})
+}
+
 // TestConnection 测试数据库连接
 func (h *DBConnectionHandler) TestConnection(c *gin.Context) {
 	var req struct {
-		Type     string `json:"type" binding:"required,oneof=mysql oracle postgres"`
-		Host     string `json:"host" binding:"required"`
-		Port     string `json:"port" binding:"required"`
-		Username string `json:"username" binding:"required"`
-		Password string `json:"password" binding:"required"`
-		Database string `json:"database" binding:"required"`
+		Type        string `json:"type" binding:"required"`
+		Host        string `json:"host" binding:"required_unless=Type sqlite"`
+		Port        string `json:"port" binding:"required_unless=Type sqlite"`
+		Username    string `json:"username" binding:"required_unless=Type sqlite"`
+		Password    string `json:"password"`
+		PasswordRef string `json:"password_ref"`
+		Database    string `json:"database" binding:"required"`
+		sshTunnelRequest
+		tlsRequest
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -194,17 +341,40 @@ func (h *DBConnectionHandler) TestConnection(c *gin.Context) {
 		return
 	}
 
+	if err := validateDBType(req.Type); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePasswordInput(req.Password, req.PasswordRef); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.PasswordRef != "" && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": errSecretRefAdminOnly})
+		return
+	}
+	if err := req.sshTunnelRequest.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.tlsRequest.validate(req.Type); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	testConn := &models.DatabaseConnection{
-		Type:     req.Type,
-		Host:     req.Host,
-		Port:     req.Port,
-		Username: req.Username,
-		Password: req.Password,
-		Database: req.Database,
+		Type:        req.Type,
+		Host:        req.Host,
+		Port:        req.Port,
+		Username:    req.Username,
+		Password:    req.Password,
+		PasswordRef: req.PasswordRef,
+		Database:    req.Database,
 	}
+	req.sshTunnelRequest.applyTo(testConn)
+	req.tlsRequest.applyTo(testConn)
 
-	_, err := dbconn.GetConnection(testConn)
-	if err != nil {
+	if err := dbconn.TestConnection(testConn); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"error":   err.Error(),
@@ -217,3 +387,111 @@ func (h *DBConnectionHandler) TestConnection(c *gin.Context) {
 		"message": "连接成功",
 	})
 }
+
+// validateDBType 校验数据库类型是否已注册方言
+func validateDBType(dbType string) error {
+	if _, err := dbconn.GetDialect(dbType); err != nil {
+		return fmt.Errorf("不支持的数据库类型: %s，可选: %s", dbType, strings.Join(dbconn.DialectNames(), ", "))
+	}
+	return nil
+}
+
+// errSecretRefAdminOnly 普通用户使用外部密钥引用时的错误信息
+const errSecretRefAdminOnly = "只有管理员可以使用外部密钥引用（password_ref）或修改使用外部密钥的连接"
+
+// validatePasswordInput 校验密码和外部密钥引用：必须且只能提供一个
+func validatePasswordInput(password, passwordRef string) error {
+	if password == "" && passwordRef == "" {
+		return errors.New("需要提供password或password_ref")
+	}
+	if password != "" && passwordRef != "" {
+		return errors.New("password和password_ref只能提供一个")
+	}
+	if passwordRef != "" {
+		return dbconn.ValidateSecretRef(passwordRef)
+	}
+	return nil
+}
+
+// sshTunnelRequest SSH隧道设置
+type sshTunnelRequest struct {
+	SSHEnabled    bool   `json:"ssh_enabled"`
+	SSHHost       string `json:"ssh_host"`
+	SSHPort       string `json:"ssh_port"` // 默认 22
+	SSHUser       string `json:"ssh_user"`
+	SSHPassword   string `json:"ssh_password"`
+	SSHPrivateKey string `json:"ssh_private_key"`
+	SSHPassphrase string `json:"ssh_passphrase"`
+	SSHKnownHosts string `json:"ssh_known_hosts"` // 跳板机公钥（known_hosts格式）
+}
+
+func (r *sshTunnelRequest) validate() error {
+	if !r.SSHEnabled {
+		return nil
+	}
+	if r.SSHHost == "" || r.SSHUser == "" {
+		return errors.New("启用SSH隧道需要提供ssh_host和ssh_user")
+	}
+	if r.SSHPassword == "" && r.SSHPrivateKey == "" {
+		return errors.New("启用SSH隧道需要提供ssh_password或ssh_private_key")
+	}
+	return nil
+}
+
+func (r *sshTunnelRequest) applyTo(conn *models.DatabaseConnection) {
+	if !r.SSHEnabled {
+		return
+	}
+	conn.SSHEnabled = true
+	conn.SSHHost = r.SSHHost
+	conn.SSHPort = r.SSHPort
+	if conn.SSHPort == "" {
+		conn.SSHPort = "22"
+	}
+	conn.SSHUser = r.SSHUser
+	conn.SSHPassword = r.SSHPassword
+	conn.SSHPrivateKey = r.SSHPrivateKey
+	conn.SSHPassphrase = r.SSHPassphrase
+	conn.SSHKnownHosts = r.SSHKnownHosts
+}
+
+// tlsRequest TLS设置及额外的DSN参数
+type tlsRequest struct {
+	TLSMode       string            `json:"tls_mode" binding:"omitempty,oneof=disable require verify-ca verify-full"`
+	TLSCACert     string            `json:"tls_ca_cert"`     // CA证书（PEM）
+	TLSClientCert string            `json:"tls_client_cert"` // 客户端证书（PEM）
+	TLSClientKey  string            `json:"tls_client_key"`  // 客户端私钥（PEM）
+	TLSServerName string            `json:"tls_server_name"`
+	ExtraParams   map[string]string `json:"extra_params"` // 如 {"timeout": "10s"}、{"TimeZone": "UTC"}
+}
+
+func (r *tlsRequest) validate(dbType string) error {
+	if (r.TLSClientCert == "") != (r.TLSClientKey == "") {
+		return errors.New("tls_client_cert和tls_client_key需要同时提供")
+	}
+	return dbconn.ValidateExtraParams(dbType, r.ExtraParams)
+}
+
+func (r *tlsRequest) applyTo(conn *models.DatabaseConnection) {
+	conn.TLSMode = r.TLSMode
+	if conn.TLSMode == "" {
+		conn.TLSMode = dbconn.TLSModeDisable
+	}
+	conn.TLSCACert = r.TLSCACert
+	conn.TLSClientCert = r.TLSClientCert
+	conn.TLSClientKey = r.TLSClientKey
+	conn.TLSServerName = r.TLSServerName
+	conn.ExtraParams, _ = encodeExtraParams(r.ExtraParams)
+}
+
+// encodeExtraParams 将额外的DSN参数保存为JSON，空参数保存为空字符串
+func encodeExtraParams(params map[string]string) (string, error) {
+	if len(params) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -28,7 +28,7 @@ func (h *DBObjectHandler) ListObjects(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "连接数据库失败: " + err.Error()})
 		return
 	}
-	defer rawConn.Close()
+	defer dbconn.ReleaseConnection(rawConn)
 
 	objectService := &service.DatabaseObjectService{}
 
@@ -82,7 +82,7 @@ func (h *DBObjectHandler) GetObjectDefinition(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "连接数据库失败: " + err.Error()})
 		return
 	}
-	defer rawConn.Close()
+	defer dbconn.ReleaseConnection(rawConn)
 
 	objectService := &service.DatabaseObjectService{}
 	definition, err := objectService.GetObjectDefinitionPublic(rawConn, dbConn.Type, dbConn.Database, objectType, objectName, tableName)
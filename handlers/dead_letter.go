@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/service"
+)
+
+type DeadLetterHandler struct{}
+
+// ListDeadLetters 分页列出死信，支持按状态、任务、目标库、运行ID和表筛选
+func (h *DeadLetterHandler) ListDeadLetters(c *gin.Context) {
+	filter := service.DeadLetterFilter{
+		Status:    c.Query("status"),
+		RunID:     c.Query("run_id"),
+		TableName: c.Query("table_name"),
+	}
+	if taskID := c.Query("task_id"); taskID != "" {
+		id, err := strconv.ParseUint(taskID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的task_id"})
+			return
+		}
+		filter.TaskID = uint(id)
+	}
+	if targetDBID := c.Query("target_db_id"); targetDBID != "" {
+		id, err := strconv.ParseUint(targetDBID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的target_db_id"})
+			return
+		}
+		filter.TargetDBID = uint(id)
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 500 {
+		pageSize = 500 // 限制最大页大小
+	}
+
+	var total int64
+	if err := filter.Apply(database.DB.Model(&models.DeadLetterRow{})).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	var rows []models.DeadLetterRow
+	if err := filter.Apply(database.DB).Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": rows,
+		"pagination": gin.H{
+			"total":      total,
+			"page":       page,
+			"page_size":  pageSize,
+			"total_page": (int(total) + pageSize - 1) / pageSize,
+		},
+	})
+}
+
+// GetDeadLetter 获取单条死信
+func (h *DeadLetterHandler) GetDeadLetter(c *gin.Context) {
+	var row models.DeadLetterRow
+	if err := database.DB.Preload("Task").First(&row, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "死信记录不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": row})
+}
+
+// ReplayDeadLetter 将单条死信重新写入目标库
+func (h *DeadLetterHandler) ReplayDeadLetter(c *gin.Context) {
+	var row models.DeadLetterRow
+	if err := database.DB.First(&row, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "死信记录不存在"})
+		return
+	}
+
+	syncService := &service.SyncService{}
+	if err := syncService.ReplayDeadLetter(&row); err != nil {
+		if errors.Is(err, service.ErrDeadLetterHandled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "重放失败: " + err.Error()})
+		return
+	}
+
+	database.DB.First(&row, row.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "重放成功", "data": row})
+}
+
+// ReplayDeadLetters 按筛选条件批量重放待处理的死信（单次最多1000条）
+func (h *DeadLetterHandler) ReplayDeadLetters(c *gin.Context) {
+	var req struct {
+		TaskID     uint   `json:"task_id"`
+		TargetDBID uint   `json:"target_db_id"`
+		RunID      string `json:"run_id"`
+		TableName  string `json:"table_name"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	syncService := &service.SyncService{}
+	results, err := syncService.ReplayDeadLetters(service.DeadLetterFilter{
+		TaskID:     req.TaskID,
+		TargetDBID: req.TargetDBID,
+		RunID:      req.RunID,
+		TableName:  req.TableName,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询死信失败"})
+		return
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":      results,
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/service"
+)
+
+type NotificationHandler struct{}
+
+// ListSubscriptions 获取当前用户的通知订阅
+func (h *NotificationHandler) ListSubscriptions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var subscriptions []models.NotificationSubscription
+	database.DB.Where("user_id = ?", userID).Order("id").Find(&subscriptions)
+
+	c.JSON(http.StatusOK, gin.H{"data": subscriptions})
+}
+
+// CreateSubscription 创建通知订阅
+func (h *NotificationHandler) CreateSubscription(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		TaskID    uint   `json:"task_id"` // 0 表示全部任务
+		EventType string `json:"event_type" binding:"required,oneof=conflict run_failed run_succeeded schema_drift"`
+		Channel   string `json:"channel" binding:"required"`
+		Target    string `json:"target"` // 空表示使用默认地址（smtp为用户邮箱）
+		Digest    *bool  `json:"digest"` // 默认 true
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !service.IsNotificationChannel(req.Channel) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的通知渠道"})
+		return
+	}
+
+	// 普通用户只能订阅自己创建的任务（订阅全部任务时只接收自己任务的事件），webhook和file渠道只能使用允许的地址
+	admin := isAdmin(c)
+	if req.TaskID != 0 {
+		var task models.SyncTask
+		if err := database.DB.First(&task, req.TaskID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "任务不存在"})
+			return
+		}
+		if !admin && task.CreatedBy != userID.(uint) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只能订阅自己创建的任务"})
+			return
+		}
+	}
+
+	if err := service.CheckNotificationTarget(req.Channel, req.Target, admin); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	digest := req.Digest == nil || *req.Digest
+	subscription := models.NotificationSubscription{
+		UserID:    userID.(uint),
+		TaskID:    req.TaskID,
+		EventType: req.EventType,
+		Channel:   req.Channel,
+		Target:    req.Target,
+		Digest:    digest,
+	}
+
+	if err := database.DB.Create(&subscription).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订阅失败"})
+		return
+	}
+	// digest 字段有默认值，零值不会被写入，需要单独更新
+	if !digest {
+		database.DB.Model(&subscription).Update("digest", false)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": subscription})
+}
+
+// DeleteSubscription 删除当前用户的通知订阅
+func (h *NotificationHandler) DeleteSubscription(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id := c.Param("id")
+
+	result := database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.NotificationSubscription{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除订阅失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "订阅已删除"})
+}
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"zh.xyz/dv/sync/database"
@@ -49,7 +48,7 @@ func (h *QueryHandler) QueryData(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "连接数据库失败: " + err.Error()})
 		return
 	}
-	defer rawConn.Close()
+	defer dbconn.ReleaseConnection(rawConn)
 
 	// 测试连接是否可用
 	if err := rawConn.Ping(); err != nil {
@@ -58,7 +57,8 @@ func (h *QueryHandler) QueryData(c *gin.Context) {
 	}
 
 	// 构建查询SQL
-	tableName := quoteIdentifier(req.TableName, dbConn.Type)
+	d := dbconn.DialectFor(dbConn.Type)
+	tableName := d.QuoteIdentifier(req.TableName)
 	whereClause := ""
 	if req.Condition != "" {
 		whereClause = "WHERE " + req.Condition
@@ -74,15 +74,7 @@ func (h *QueryHandler) QueryData(c *gin.Context) {
 
 	// 查询数据
 	offset := (req.Page - 1) * req.PageSize
-	var limitClause string
-	switch dbConn.Type {
-	case "mysql", "postgres":
-		limitClause = "LIMIT " + strconv.Itoa(req.PageSize) + " OFFSET " + strconv.Itoa(offset)
-	case "oracle":
-		limitClause = "OFFSET " + strconv.Itoa(offset) + " ROWS FETCH NEXT " + strconv.Itoa(req.PageSize) + " ROWS ONLY"
-	default:
-		limitClause = "LIMIT " + strconv.Itoa(req.PageSize) + " OFFSET " + strconv.Itoa(offset)
-	}
+	limitClause := d.LimitOffset(req.PageSize, offset)
 
 	querySQL := "SELECT * FROM " + tableName + " " + whereClause + " " + limitClause
 	rows, err := rawConn.Query(querySQL)
@@ -158,7 +150,7 @@ func (h *QueryHandler) GetTables(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "连接数据库失败: " + err.Error()})
 		return
 	}
-	defer rawConn.Close()
+	defer dbconn.ReleaseConnection(rawConn)
 
 	// 测试连接是否可用
 	if err := rawConn.Ping(); err != nil {
@@ -166,42 +158,11 @@ func (h *QueryHandler) GetTables(c *gin.Context) {
 		return
 	}
 
-	var query string
-	switch dbConn.Type {
-	case "mysql":
-		query = "SHOW TABLES"
-	case "postgres":
-		// 使用 information_schema 更标准，兼容性更好
-		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_type = 'BASE TABLE' ORDER BY table_name"
-	case "oracle":
-		query = "SELECT table_name FROM user_tables"
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的数据库类型"})
-		return
-	}
-
-	rows, err := rawConn.Query(query)
+	tables, err := dbconn.DialectFor(dbConn.Type).Tables(rawConn)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败: " + err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	var tables []string
-	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "扫描结果失败: " + err.Error()})
-			return
-		}
-		tables = append(tables, tableName)
-	}
-
-	// 检查迭代过程中是否有错误
-	if err := rows.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取结果失败: " + err.Error()})
-		return
-	}
 
 	c.JSON(http.StatusOK, gin.H{"data": tables})
 }
@@ -250,7 +211,7 @@ func (h *QueryHandler) ExecuteSQL(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "连接数据库失败: " + err.Error()})
 		return
 	}
-	defer rawConn.Close()
+	defer dbconn.ReleaseConnection(rawConn)
 
 	// 测试连接是否可用
 	if err := rawConn.Ping(); err != nil {
@@ -258,7 +219,9 @@ func (h *QueryHandler) ExecuteSQL(c *gin.Context) {
 		return
 	}
 
-	rows, err := rawConn.Query(req.SQL)
+	query := dbconn.DialectFor(dbConn.Type).NormalizeStatement(req.SQL)
+
+	rows, err := rawConn.Query(query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "执行SQL失败: " + err.Error()})
 		return
@@ -306,14 +269,3 @@ func (h *QueryHandler) ExecuteSQL(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"data": results})
 }
-
-func quoteIdentifier(name, dbType string) string {
-	switch dbType {
-	case "mysql":
-		return "`" + name + "`"
-	case "postgres", "oracle":
-		return `"` + name + `"`
-	default:
-		return name
-	}
-}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -19,10 +20,23 @@ func (h *SyncHandler) CreateSyncTask(c *gin.Context) {
 	var req struct {
 		Name       string `json:"name" binding:"required"`
 		SourceDBID uint   `json:"source_db_id" binding:"required"`
-		TargetDBID uint   `json:"target_db_id" binding:"required"`
+		TargetDBID uint   `json:"target_db_id" binding:"required_without=TargetDBIDs"`
+		TargetDBIDs []uint `json:"target_db_ids"` // 多个目标库，与 target_db_id 合并去重
 		TableName  string `json:"table_name"`                    // 空字符串表示整库同步
+		Direction  string `json:"direction" binding:"omitempty,oneof=one_way two_way"` // 默认 one_way
 		SyncType   string `json:"sync_type" binding:"required,oneof=realtime scheduled"`
 		CronExpr   string `json:"cron_expr"`                     // 定时任务需要
+		ConflictColumns  string  `json:"conflict_columns"`  // 参与冲突检测的列（逗号分隔），空表示全部列
+		NumericTolerance float64 `json:"numeric_tolerance" binding:"min=0"` // 数值比较容差
+		TimeTolerance    int     `json:"time_tolerance" binding:"min=0"`    // 时间比较容差（秒）
+		ConflictPolicy   string  `json:"conflict_policy" binding:"omitempty,oneof=manual source_wins target_wins last_writer_wins version_wins merge"`
+		PolicyColumn     string  `json:"policy_column"` // last_writer_wins/version_wins 需要
+		BatchSize         int   `json:"batch_size" binding:"min=0,max=100000"` // 每批行数，0 表示默认值
+		MaxRowsPerSecond  int   `json:"max_rows_per_second" binding:"min=0"`  // 0 表示不限制
+		MaxBytesPerSecond int64 `json:"max_bytes_per_second" binding:"min=0"` // 0 表示不限制
+		AdaptiveThrottle  bool  `json:"adaptive_throttle"`
+		BulkLoadMode           string `json:"bulk_load_mode" binding:"omitempty,oneof=auto off"` // 默认 auto
+		BulkLoadDisableIndexes bool   `json:"bulk_load_disable_indexes"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -35,28 +49,79 @@ func (h *SyncHandler) CreateSyncTask(c *gin.Context) {
 		return
 	}
 
+	if (req.ConflictPolicy == "last_writer_wins" || req.ConflictPolicy == "version_wins") && req.PolicyColumn == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该冲突解决策略需要提供policy_column"})
+		return
+	}
+	if req.ConflictPolicy == "" {
+		req.ConflictPolicy = "manual"
+	}
+	if req.Direction == "" {
+		req.Direction = "one_way"
+	}
+	if req.BulkLoadMode == "" {
+		req.BulkLoadMode = "auto"
+	}
+
+	// 合并目标库，target_db_id 排在第一个
+	targetIDs := make([]uint, 0, len(req.TargetDBIDs)+1)
+	seen := make(map[uint]bool)
+	for _, id := range append([]uint{req.TargetDBID}, req.TargetDBIDs...) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			targetIDs = append(targetIDs, id)
+		}
+	}
+	if len(targetIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "至少需要一个目标数据库"})
+		return
+	}
+	if req.Direction == "two_way" && len(targetIDs) > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "双向同步只支持一个目标数据库"})
+		return
+	}
+
 	// 验证数据库连接是否存在
-	var sourceDB, targetDB models.DatabaseConnection
+	var sourceDB models.DatabaseConnection
 	if err := database.DB.First(&sourceDB, req.SourceDBID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "源数据库连接不存在"})
 		return
 	}
-	if err := database.DB.First(&targetDB, req.TargetDBID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "目标数据库连接不存在"})
-		return
+	for _, id := range targetIDs {
+		var targetDB models.DatabaseConnection
+		if err := database.DB.First(&targetDB, id).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("目标数据库连接 %d 不存在", id)})
+			return
+		}
 	}
 
 	task := models.SyncTask{
 		Name:       req.Name,
 		SourceDBID: req.SourceDBID,
-		TargetDBID: req.TargetDBID,
+		TargetDBID: targetIDs[0],
 		TableName:  req.TableName,
+		Direction:  req.Direction,
 		SyncType:   req.SyncType,
 		CronExpr:   req.CronExpr,
+		ConflictColumns:  req.ConflictColumns,
+		NumericTolerance: req.NumericTolerance,
+		TimeTolerance:    req.TimeTolerance,
+		ConflictPolicy:   req.ConflictPolicy,
+		PolicyColumn:     req.PolicyColumn,
+		BatchSize:         req.BatchSize,
+		MaxRowsPerSecond:  req.MaxRowsPerSecond,
+		MaxBytesPerSecond: req.MaxBytesPerSecond,
+		AdaptiveThrottle:  req.AdaptiveThrottle,
+		BulkLoadMode:           req.BulkLoadMode,
+		BulkLoadDisableIndexes: req.BulkLoadDisableIndexes,
 		Status:     "stopped",
 		CreatedBy:  userID.(uint),
 	}
 
+	for _, id := range targetIDs {
+		task.Targets = append(task.Targets, models.SyncTaskTarget{TargetDBID: id})
+	}
+
 	if err := database.DB.Create(&task).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建同步任务失败"})
 		return
@@ -71,7 +136,7 @@ func (h *SyncHandler) CreateSyncTask(c *gin.Context) {
 // ListSyncTasks 列出所有同步任务
 func (h *SyncHandler) ListSyncTasks(c *gin.Context) {
 	var tasks []models.SyncTask
-	if err := database.DB.Preload("SourceDB").Preload("TargetDB").Preload("Creator").Find(&tasks).Error; err != nil {
+	if err := database.DB.Preload("SourceDB").Preload("TargetDB").Preload("Targets.TargetDB").Preload("Creator").Find(&tasks).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
 		return
 	}
@@ -84,7 +149,7 @@ func (h *SyncHandler) GetSyncTask(c *gin.Context) {
 	id := c.Param("id")
 
 	var task models.SyncTask
-	if err := database.DB.Preload("SourceDB").Preload("TargetDB").Preload("Creator").First(&task, id).Error; err != nil {
+	if err := database.DB.Preload("SourceDB").Preload("TargetDB").Preload("Targets.TargetDB").Preload("Creator").First(&task, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "同步任务不存在"})
 		return
 	}
@@ -151,6 +216,9 @@ func (h *SyncHandler) StopSyncTask(c *gin.Context) {
 		database.DB.Save(&task)
 	}
 
+	task.Status = "stopped"
+	service.PublishTaskCancelled(&task)
+
 	c.JSON(http.StatusOK, gin.H{"message": "同步任务已停止"})
 }
 
@@ -191,6 +259,9 @@ func (h *SyncHandler) DeleteSyncTask(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
+	database.DB.Where("task_id = ?", task.ID).Delete(&models.SyncTaskTarget{})
+	database.DB.Where("task_id = ?", task.ID).Delete(&models.DeadLetterRow{})
+	database.DB.Where("task_id = ?", task.ID).Delete(&models.SyncRowState{})
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
@@ -17,12 +17,16 @@ func (h *UserHandler) Register(c *gin.Context) {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
 		Email    string `json:"email" binding:"required,email"`
+		Language string `json:"language" binding:"omitempty,oneof=zh en"` // 通知语言，默认 zh
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Language == "" {
+		req.Language = "zh"
+	}
 
 	// 检查用户名是否已存在
 	var existingUser models.User
@@ -45,6 +49,7 @@ func (h *UserHandler) Register(c *gin.Context) {
 		Email:    req.Email,
 		Role:     "user",
 		Status:   "active",
+		Language: req.Language,
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
@@ -128,5 +133,56 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		"email":    user.Email,
 		"role":     user.Role,
 		"status":   user.Status,
+		"language": user.Language,
+	})
+}
+
+// UpdateProfile 更新当前用户的邮箱和通知语言
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		Email    string `json:"email" binding:"omitempty,email"`
+		Language string `json:"language" binding:"omitempty,oneof=zh en"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Email != "" {
+		updates["email"] = req.Email
+	}
+	if req.Language != "" {
+		updates["language"] = req.Language
+	}
+	if len(updates) > 0 {
+		if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户信息失败"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+		"status":   user.Status,
+		"language": user.Language,
 	})
 }
+
+// isAdmin 当前登录用户是否为管理员
+func isAdmin(c *gin.Context) bool {
+	role, _ := c.Get("role")
+	return role == "admin"
+}
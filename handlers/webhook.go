@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/service"
+)
+
+type WebhookHandler struct{}
+
+// normalizeWebhookEvents 校验并规范化事件过滤（逗号分隔），空或*表示全部事件
+func normalizeWebhookEvents(events []string) (string, bool) {
+	var result []string
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+		if event == "*" {
+			return "*", true
+		}
+		if !service.IsWebhookEvent(event) {
+			return "", false
+		}
+		result = append(result, event)
+	}
+	if len(result) == 0 {
+		return "*", true
+	}
+	return strings.Join(result, ","), true
+}
+
+// CreateWebhook 创建webhook，未提供密钥时自动生成（仅在创建时返回）
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		Name   string   `json:"name" binding:"required"`
+		URL    string   `json:"url" binding:"required,url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`  // 为空表示全部事件
+		TaskID uint     `json:"task_id"` // 0 表示全部任务
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, ok := normalizeWebhookEvents(req.Events)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的事件类型", "supported_events": service.WebhookEvents})
+		return
+	}
+
+	if req.Secret == "" {
+		secret, err := service.GenerateWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+			return
+		}
+		req.Secret = secret
+	}
+
+	webhook := models.Webhook{
+		Name:      req.Name,
+		URL:       req.URL,
+		Secret:    req.Secret,
+		Events:    events,
+		TaskID:    req.TaskID,
+		Active:    true,
+		CreatedBy: userID.(uint),
+	}
+
+	if err := database.DB.Create(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建webhook失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": webhook, "secret": webhook.Secret})
+}
+
+// ListWebhooks 获取webhook列表
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	var webhooks []models.Webhook
+	database.DB.Order("id").Find(&webhooks)
+
+	c.JSON(http.StatusOK, gin.H{"data": webhooks})
+}
+
+// GetWebhook 获取webhook详情
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	id := c.Param("id")
+
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": webhook})
+}
+
+// UpdateWebhook 更新webhook
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	id := c.Param("id")
+
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook不存在"})
+		return
+	}
+
+	var req struct {
+		Name   *string  `json:"name"`
+		URL    *string  `json:"url" binding:"omitempty,url"`
+		Secret *string  `json:"secret"`
+		Events []string `json:"events"`
+		TaskID *uint    `json:"task_id"`
+		Active *bool    `json:"active"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.URL != nil {
+		updates["url"] = *req.URL
+	}
+	if req.Secret != nil && *req.Secret != "" {
+		updates["secret"] = *req.Secret
+	}
+	if req.Events != nil {
+		events, ok := normalizeWebhookEvents(req.Events)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的事件类型", "supported_events": service.WebhookEvents})
+			return
+		}
+		updates["events"] = events
+	}
+	if req.TaskID != nil {
+		updates["task_id"] = *req.TaskID
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(&webhook).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新webhook失败"})
+			return
+		}
+	}
+
+	database.DB.First(&webhook, webhook.ID)
+	c.JSON(http.StatusOK, gin.H{"data": webhook})
+}
+
+// DeleteWebhook 删除webhook及其投递记录
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook不存在"})
+		return
+	}
+
+	if err := database.DB.Delete(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	database.DB.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{})
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// ListDeliveries 获取webhook的投递记录（分页，可按状态和事件筛选）
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	id := c.Param("id")
+
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook不存在"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 500 {
+		pageSize = 500 // 限制最大页大小
+	}
+
+	filter := func() *gorm.DB {
+		query := database.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID)
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if event := c.Query("event"); event != "" {
+			query = query.Where("event_type = ?", event)
+		}
+		return query
+	}
+
+	var total int64
+	if err := filter().Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := filter().Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": deliveries,
+		"pagination": gin.H{
+			"total":      total,
+			"page":       page,
+			"page_size":  pageSize,
+			"total_page": (int(total) + pageSize - 1) / pageSize,
+		},
+	})
+}
+
+// RedeliverWebhook 手动重新投递
+func (h *WebhookHandler) RedeliverWebhook(c *gin.Context) {
+	id := c.Param("id")
+	deliveryID := c.Param("delivery_id")
+
+	var delivery models.WebhookDelivery
+	if err := database.DB.Where("id = ? AND webhook_id = ?", deliveryID, id).First(&delivery).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "投递记录不存在"})
+		return
+	}
+
+	redelivery, err := service.RedeliverWebhook(&delivery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建投递记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"data": redelivery})
+}
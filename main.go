@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 
 	"github.com/gin-gonic/gin"
@@ -8,22 +9,52 @@ import (
 	"zh.xyz/dv/sync/database"
 	"zh.xyz/dv/sync/routes"
 	"zh.xyz/dv/sync/service"
+	"zh.xyz/dv/sync/utils"
 )
 
 func main() {
+	rotateKeys := flag.Bool("rotate-keys", false, "使用当前主密钥重新加密所有数据库连接密码后退出")
+	flag.Parse()
+
 	// 加载配置
 	if err := config.LoadConfig("config.json"); err != nil {
 		log.Printf("加载配置文件失败，使用默认配置: %v", err)
 	}
 
+	// 校验主密钥配置
+	if err := utils.InitSecretKeys(); err != nil {
+		log.Fatal("主密钥配置错误:", err)
+	}
+
 	// 初始化数据库
 	if err := database.InitDatabase(); err != nil {
 		log.Fatal("数据库初始化失败:", err)
 	}
 
+	// 轮换主密钥：重新加密后退出
+	if *rotateKeys {
+		count, err := database.RotateConnectionPasswords()
+		if err != nil {
+			log.Fatal("重新加密数据库连接密码失败:", err)
+		}
+		log.Printf("已使用当前主密钥重新加密 %d 个数据库连接密码", count)
+		return
+	}
+
+	// 上次运行中断的冲突处理和批量处理冲突任务标记为失败，重放中断的死信恢复为待处理
+	service.RecoverResolvingConflicts()
+	service.RecoverConflictBulkJobs()
+	service.RecoverReplayingDeadLetters()
+
 	// 初始化定时任务管理器
 	service.InitCronManager()
 
+	// 启动通知摘要发送
+	service.InitNotifier()
+
+	// 启动webhook重试任务
+	service.InitWebhookWorker()
+
 	// 设置Gin模式
 	if config.GlobalConfig.Server.Mode == "release" {
 		gin.SetMode(gin.ReleaseMode)
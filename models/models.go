@@ -2,6 +2,9 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/utils"
 )
 
 // User 用户模型
@@ -12,6 +15,7 @@ type User struct {
 	Email     string    `gorm:"type:varchar(255);not null" json:"email"`
 	Role      string    `gorm:"type:varchar(50);default:user" json:"role"` // admin, user
 	Status    string    `gorm:"type:varchar(50);default:active" json:"status"` // active, inactive
+	Language  string    `gorm:"type:varchar(10);default:zh" json:"language"`   // 通知语言：zh, en
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -20,56 +24,166 @@ type User struct {
 type DatabaseConnection struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	Name        string    `gorm:"not null" json:"name"` // 连接名称
-	Type        string    `gorm:"not null" json:"type"` // mysql, oracle, postgres
+	Type        string    `gorm:"not null" json:"type"` // mysql, oracle, postgres, sqlserver, sqlite
 	Host        string    `gorm:"not null" json:"host"`
 	Port        string    `gorm:"not null" json:"port"`
 	Username    string    `gorm:"not null" json:"username"`
 	Password    string    `gorm:"not null" json:"-"` // 加密存储
+	PasswordRef string    `gorm:"type:varchar(500)" json:"password_ref"` // 外部密钥引用（env:NAME、file:/path、vault:path#key），设置后不保存密码
 	Database    string    `gorm:"not null" json:"database"`
 	Description string    `json:"description"`
 	Status      string    `gorm:"default:active" json:"status"` // active, inactive
+
+	// SSH隧道（经跳板机连接数据库）
+	SSHEnabled    bool   `gorm:"default:false" json:"ssh_enabled"`
+	SSHHost       string `gorm:"type:varchar(255)" json:"ssh_host"`
+	SSHPort       string `gorm:"type:varchar(10)" json:"ssh_port"` // 默认 22
+	SSHUser       string `gorm:"type:varchar(255)" json:"ssh_user"`
+	SSHPassword   string `gorm:"type:text" json:"-"`               // 加密存储
+	SSHPrivateKey string `gorm:"type:text" json:"-"`               // 加密存储
+	SSHPassphrase string `gorm:"type:text" json:"-"`               // 私钥密码，加密存储
+	SSHKnownHosts string `gorm:"type:text" json:"ssh_known_hosts"` // 跳板机公钥（known_hosts格式），为空时使用全局known_hosts文件
+
+	// TLS
+	TLSMode       string `gorm:"type:varchar(20);default:disable" json:"tls_mode"` // disable, require, verify-ca, verify-full
+	TLSCACert     string `gorm:"type:text" json:"tls_ca_cert"`                     // CA证书（PEM），为空时使用系统CA
+	TLSClientCert string `gorm:"type:text" json:"tls_client_cert"`                 // 客户端证书（PEM）
+	TLSClientKey  string `gorm:"type:text" json:"-"`                               // 客户端私钥（PEM），加密存储
+	TLSServerName string `gorm:"type:varchar(255)" json:"tls_server_name"`         // 校验的服务器名称，为空时使用Host
+
+	ExtraParams string `gorm:"type:text" json:"extra_params"` // 额外的DSN参数（JSON对象），可覆盖默认的字符集、时区等参数
+
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// BeforeSave 保存前加密密码和SSH凭据（已加密的不会重复加密），使用外部密钥引用时不保存密码
+func (c *DatabaseConnection) BeforeSave(tx *gorm.DB) error {
+	if c.PasswordRef != "" {
+		c.Password = ""
+	}
+
+	for _, field := range c.SecretFields() {
+		encrypted, err := utils.EncryptSecret(*field)
+		if err != nil {
+			return err
+		}
+		*field = encrypted
+	}
+	return nil
+}
+
+// SecretFields 返回需要加密存储的字段（列名 -> 字段指针）
+func (c *DatabaseConnection) SecretFields() map[string]*string {
+	return map[string]*string{
+		"password":        &c.Password,
+		"ssh_password":    &c.SSHPassword,
+		"ssh_private_key": &c.SSHPrivateKey,
+		"ssh_passphrase":  &c.SSHPassphrase,
+		"tls_client_key":  &c.TLSClientKey,
+	}
+}
+
 // SyncTask 同步任务
 type SyncTask struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	Name        string    `gorm:"type:varchar(255);not null" json:"name"`
 	SourceDBID  uint      `gorm:"not null" json:"source_db_id"`  // 源数据库ID
-	TargetDBID  uint      `gorm:"not null" json:"target_db_id"`  // 目标数据库ID
+	TargetDBID  uint      `gorm:"not null" json:"target_db_id"`  // 目标数据库ID（多个目标库时为第一个）
+	Direction   string    `gorm:"type:varchar(50);default:one_way" json:"direction"` // one_way: 源→目标, two_way: 双向
 	SourceDB    DatabaseConnection `gorm:"foreignKey:SourceDBID" json:"source_db,omitempty"`
 	TargetDB    DatabaseConnection `gorm:"foreignKey:TargetDBID" json:"target_db,omitempty"`
+	Targets     []SyncTaskTarget   `gorm:"foreignKey:TaskID" json:"targets,omitempty"` // 所有目标库及各自的同步状态
 	TableName   string    `gorm:"type:varchar(255);not null" json:"table_name"`    // 表名，空字符串表示整库同步
 	SyncType    string    `gorm:"type:varchar(50);not null" json:"sync_type"`     // realtime, scheduled
 	CronExpr    string    `gorm:"type:varchar(100)" json:"cron_expr"`                     // 定时任务的cron表达式
 	Status      string    `gorm:"type:varchar(50);default:stopped" json:"status"` // running, stopped, error
 	LastSyncAt  *time.Time `json:"last_sync_at"`
+	ConflictColumns  string  `gorm:"type:text" json:"conflict_columns"`            // 参与冲突检测的列（逗号分隔），空字符串表示全部列
+	NumericTolerance float64 `gorm:"default:0" json:"numeric_tolerance"`           // 数值比较容差（绝对值）
+	TimeTolerance    int     `gorm:"default:0" json:"time_tolerance"`              // 时间比较容差（秒）
+	ConflictPolicy   string  `gorm:"type:varchar(50);default:manual" json:"conflict_policy"` // manual, source_wins, target_wins, last_writer_wins, version_wins, merge
+	PolicyColumn     string  `gorm:"type:varchar(255)" json:"policy_column"`               // last_writer_wins 使用的时间戳列或 version_wins 使用的版本列
+	BatchSize         int   `gorm:"default:0" json:"batch_size"`             // 每批行数，0 表示默认值（100）；会按列数和数据库参数上限自动缩小
+	MaxRowsPerSecond  int   `gorm:"default:0" json:"max_rows_per_second"`    // 每秒最多同步的行数，0 表示不限制
+	MaxBytesPerSecond int64 `gorm:"default:0" json:"max_bytes_per_second"`   // 每秒最多同步的字节数（估算），0 表示不限制
+	AdaptiveThrottle  bool  `gorm:"default:false" json:"adaptive_throttle"` // 目标库写入延迟升高时自动降速
+	BulkLoadMode           string `gorm:"type:varchar(50);default:auto" json:"bulk_load_mode"`       // auto: 目标表为空时使用批量装载（COPY/LOAD DATA）, off: 不使用
+	BulkLoadDisableIndexes bool   `gorm:"default:false" json:"bulk_load_disable_indexes"` // 批量装载前删除二级索引并禁用触发器，装载后重建
 	CreatedBy   uint      `gorm:"not null" json:"created_by"`
 	Creator     User      `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	RunID       string    `gorm:"-" json:"-"` // 当前运行ID（不保存），用于关联本次运行产生的死信记录
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// SyncTaskTarget 同步任务的目标库（一个任务可以将源数据同时写入多个目标库）
+type SyncTaskTarget struct {
+	ID         uint               `gorm:"primaryKey" json:"id"`
+	TaskID     uint               `gorm:"not null;uniqueIndex:idx_sync_task_target" json:"task_id"`
+	TargetDBID uint               `gorm:"not null;uniqueIndex:idx_sync_task_target" json:"target_db_id"`
+	TargetDB   DatabaseConnection `gorm:"foreignKey:TargetDBID" json:"target_db,omitempty"`
+	Status     string             `gorm:"type:varchar(50);default:idle" json:"status"` // idle, running, success, error
+	LastError  string             `gorm:"type:text" json:"last_error"`                 // 最近一次同步的错误信息
+	LastSyncAt *time.Time         `json:"last_sync_at"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
+
 // DataConflict 数据冲突记录
 type DataConflict struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	TaskID      uint      `gorm:"not null;index" json:"task_id"`
 	Task        SyncTask  `gorm:"foreignKey:TaskID" json:"task,omitempty"`
+	TargetDBID  uint      `gorm:"index" json:"target_db_id"` // 冲突所在的目标库
 	TableName   string    `gorm:"type:varchar(255);not null" json:"table_name"`
 	PrimaryKey  string    `gorm:"type:varchar(500);not null;index" json:"primary_key"` // 主键值（JSON格式）
 	SourceData  string    `gorm:"type:text" json:"source_data"`      // 源数据库数据（JSON格式）
 	TargetData  string    `gorm:"type:text" json:"target_data"`      // 目标数据库数据（JSON格式）
 	ConflictType string   `gorm:"type:varchar(50);not null" json:"conflict_type"`     // update_conflict, delete_conflict
-	Status      string    `gorm:"type:varchar(50);default:pending" json:"status"`     // pending, resolved
+	Status      string    `gorm:"type:varchar(50);default:pending" json:"status"`     // pending, resolving, resolved, auto_resolved, failed
 	ResolvedBy  *uint     `json:"resolved_by,omitempty"`
 	Resolver    *User     `gorm:"foreignKey:ResolvedBy" json:"resolver,omitempty"`
-	Resolution  string    `gorm:"type:varchar(50)" json:"resolution"`       // resolved: source 或 target
+	Resolution  string    `gorm:"type:varchar(50)" json:"resolution"`       // resolved: source、target 或 merge；auto_resolved: 任务的冲突解决策略
+	ResolvedData   string `gorm:"type:text" json:"resolved_data"`     // 解决后的数据（JSON格式），merge 时为合并后的行
+	ResolutionNote string `gorm:"type:text" json:"resolution_note"`   // 解决说明
+	ErrorMessage   string `gorm:"type:text" json:"error_message"`     // 应用解决方案失败时的错误信息
 	ResolvedAt  *time.Time `json:"resolved_at"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// ConflictActionToken 冲突操作链接token记录（用于撤销和一次性使用）
+type ConflictActionToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	TokenID    string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"token_id"`
+	ConflictID uint       `gorm:"not null;index" json:"conflict_id"`
+	UserID     uint       `gorm:"not null" json:"user_id"`                   // 接收人
+	Action     string     `gorm:"type:varchar(50);not null" json:"action"` // view, resolve_source, resolve_target
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ConflictBulkJob 批量处理冲突任务
+type ConflictBulkJob struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Filter     string     `gorm:"type:text" json:"filter"`                        // 冲突筛选条件（JSON格式）
+	Resolution string     `gorm:"type:varchar(50);not null" json:"resolution"`    // source, target
+	Status     string     `gorm:"type:varchar(50);default:pending" json:"status"` // pending, running, completed, failed
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	Errors     string     `gorm:"type:text" json:"errors"` // 失败的冲突及错误信息（JSON格式，最多保留100条）
+	CreatedBy  uint       `gorm:"not null" json:"created_by"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
 // SyncLog 同步日志
 type SyncLog struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
@@ -80,3 +194,96 @@ type SyncLog struct {
 	Details     string    `gorm:"type:text" json:"details"` // JSON格式的详细信息
 	CreatedAt   time.Time `json:"created_at"`
 }
+
+// SyncRowState 行同步状态（记录上次同步后源端和目标端每行的哈希，用于冲突检测）
+type SyncRowState struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	TaskID        uint      `gorm:"not null;uniqueIndex:idx_sync_row_target_state" json:"task_id"`
+	TargetDBID    uint      `gorm:"not null;default:0;uniqueIndex:idx_sync_row_target_state" json:"target_db_id"` // 目标库，多目标任务按目标库分别记录
+	TableName     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_sync_row_target_state" json:"table_name"`
+	PrimaryKey    string    `gorm:"type:varchar(500);not null;uniqueIndex:idx_sync_row_target_state" json:"primary_key"` // 主键值（JSON格式）
+	SourceHash    string    `gorm:"type:varchar(64)" json:"source_hash"`   // 上次同步后源端行哈希
+	TargetHash    string    `gorm:"type:varchar(64)" json:"target_hash"`   // 上次同步后目标端行哈希
+	SourceColumns string    `gorm:"type:text" json:"source_columns"`       // 上次同步后源端各列哈希（JSON格式）
+	TargetColumns string    `gorm:"type:text" json:"target_columns"`       // 上次同步后目标端各列哈希（JSON格式）
+	SyncedAt      time.Time `json:"synced_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// DeadLetterRow 死信记录（写入目标库失败且重试无效的行，可修复数据后重放）
+type DeadLetterRow struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	TaskID     uint       `gorm:"not null;index" json:"task_id"`
+	Task       SyncTask   `gorm:"foreignKey:TaskID" json:"task,omitempty"`
+	RunID      string     `gorm:"type:varchar(64);index" json:"run_id"` // 产生该记录的同步运行
+	TargetDBID uint       `gorm:"not null;index" json:"target_db_id"`
+	TableName  string     `gorm:"type:varchar(255);not null" json:"table_name"`
+	PrimaryKey string     `gorm:"type:varchar(500)" json:"primary_key"`             // 主键值（JSON格式），无主键的表为空
+	RowData    string     `gorm:"type:text" json:"row_data"`                        // 行数据（JSON格式）
+	Error      string     `gorm:"type:text" json:"error"`                           // 最近一次写入的错误信息
+	Status     string     `gorm:"type:varchar(50);default:pending" json:"status"` // pending, replaying, replayed
+	Attempts   int        `gorm:"default:1" json:"attempts"`                        // 写入次数（含重放）
+	ReplayedAt *time.Time `json:"replayed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// NotificationSubscription 通知订阅
+type NotificationSubscription struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	TaskID    uint      `gorm:"default:0;index" json:"task_id"`                 // 0 表示全部任务
+	EventType string    `gorm:"type:varchar(50);not null" json:"event_type"`   // conflict, run_failed, run_succeeded, schema_drift
+	Channel   string    `gorm:"type:varchar(50);not null" json:"channel"`      // smtp, webhook, file
+	Target    string    `gorm:"type:varchar(500)" json:"target"`               // 渠道地址（邮箱、URL或文件路径），空表示使用默认值
+	Digest    bool      `gorm:"default:true" json:"digest"`                    // 是否合并为周期性摘要发送
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PendingNotification 待发送的摘要通知
+type PendingNotification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	Channel   string     `gorm:"type:varchar(50);not null" json:"channel"`
+	Target    string     `gorm:"type:varchar(500)" json:"target"`
+	EventType string     `gorm:"type:varchar(50);not null" json:"event_type"`
+	TaskID    uint       `json:"task_id"`
+	Payload   string     `gorm:"type:text" json:"payload"` // 事件内容（JSON格式）
+	SentAt    *time.Time `gorm:"index" json:"sent_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Webhook 出站webhook订阅
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
+	URL       string    `gorm:"type:varchar(500);not null" json:"url"`
+	Secret    string    `gorm:"type:varchar(255);not null" json:"-"`     // 签名密钥，不返回给前端
+	Events    string    `gorm:"type:varchar(500)" json:"events"`          // 订阅的事件（逗号分隔），空或*表示全部事件
+	TaskID    uint      `gorm:"default:0;index" json:"task_id"`           // 0 表示全部任务
+	Active    bool      `gorm:"default:true" json:"active"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery webhook投递记录
+type WebhookDelivery struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	WebhookID    uint       `gorm:"not null;index" json:"webhook_id"`
+	EventType    string     `gorm:"type:varchar(50);not null" json:"event_type"`
+	Payload      string     `gorm:"type:text" json:"payload"`                        // 投递的JSON内容
+	Status       string     `gorm:"type:varchar(50);default:pending" json:"status"` // pending, retrying, succeeded, failed
+	Attempts     int        `gorm:"default:0" json:"attempts"`
+	ResponseCode int        `json:"response_code"`
+	ResponseBody string     `gorm:"type:text" json:"response_body"`
+	ErrorMessage string     `gorm:"type:text" json:"error_message"`
+	NextRetryAt  *time.Time `gorm:"index" json:"next_retry_at"`
+	DeliveredAt  *time.Time `json:"delivered_at"`
+	RedeliveryOf uint       `gorm:"default:0" json:"redelivery_of"` // 手动重新投递时指向原投递记录
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
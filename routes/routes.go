@@ -34,6 +34,7 @@ func SetupRoutes(r *gin.Engine) {
 	{
 		userHandler := &handlers.UserHandler{}
 		auth.GET("/profile", userHandler.GetProfile)
+		auth.PUT("/profile", userHandler.UpdateProfile)
 
 		// 数据库连接管理
 		dbHandler := &handlers.DBConnectionHandler{}
@@ -84,8 +85,25 @@ func SetupRoutes(r *gin.Engine) {
 		// 冲突处理
 		conflictHandler := &handlers.ConflictHandler{}
 		auth.GET("/conflicts", conflictHandler.ListConflicts)
+		auth.POST("/conflicts/bulk-resolve", conflictHandler.BulkResolveConflicts)
+		auth.GET("/conflicts/bulk-jobs", conflictHandler.ListBulkJobs)
+		auth.GET("/conflicts/bulk-jobs/:id", conflictHandler.GetBulkJob)
 		auth.GET("/conflicts/:id", conflictHandler.GetConflict)
 		auth.POST("/conflicts/:id/resolve", conflictHandler.ResolveConflict)
+		auth.POST("/conflicts/:id/revoke-links", conflictHandler.RevokeConflictLinks)
+
+		// 死信（写入目标库失败的行）
+		deadLetterHandler := &handlers.DeadLetterHandler{}
+		auth.GET("/dead-letters", deadLetterHandler.ListDeadLetters)
+		auth.POST("/dead-letters/replay", deadLetterHandler.ReplayDeadLetters)
+		auth.GET("/dead-letters/:id", deadLetterHandler.GetDeadLetter)
+		auth.POST("/dead-letters/:id/replay", deadLetterHandler.ReplayDeadLetter)
+
+		// 通知订阅
+		notificationHandler := &handlers.NotificationHandler{}
+		auth.GET("/notifications/subscriptions", notificationHandler.ListSubscriptions)
+		auth.POST("/notifications/subscriptions", notificationHandler.CreateSubscription)
+		auth.DELETE("/notifications/subscriptions/:id", notificationHandler.DeleteSubscription)
 	}
 
 	// 管理员路由
@@ -93,12 +111,32 @@ func SetupRoutes(r *gin.Engine) {
 	admin.Use(middleware.AuthMiddleware())
 	admin.Use(middleware.AdminMiddleware())
 	{
-		// 管理员相关接口可以在这里添加
+		// webhook管理
+		webhookHandler := &handlers.WebhookHandler{}
+		admin.POST("/webhooks", webhookHandler.CreateWebhook)
+		admin.GET("/webhooks", webhookHandler.ListWebhooks)
+		admin.GET("/webhooks/:id", webhookHandler.GetWebhook)
+		admin.PUT("/webhooks/:id", webhookHandler.UpdateWebhook)
+		admin.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+		admin.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+		admin.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", webhookHandler.RedeliverWebhook)
+
+		// 数据库连接池
+		dbHandler := &handlers.DBConnectionHandler{}
+		admin.GET("/connection-pools", dbHandler.PoolStats)
 	}
 
-	// 公共冲突查看接口（通过token）
+	// 公共冲突查看和处理接口（通过签名token）
 	r.GET("/api/v1/conflicts/view", func(c *gin.Context) {
 		handler := &handlers.ConflictHandler{}
 		handler.ViewConflictByToken(c)
 	})
+	r.GET("/api/v1/conflicts/action", func(c *gin.Context) {
+		handler := &handlers.ConflictHandler{}
+		handler.ViewConflictByToken(c)
+	})
+	r.POST("/api/v1/conflicts/action", func(c *gin.Context) {
+		handler := &handlers.ConflictHandler{}
+		handler.ResolveConflictByToken(c)
+	})
 }
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+)
+
+// ConflictFilter 冲突筛选条件
+type ConflictFilter struct {
+	Status       string     `json:"status,omitempty"`
+	TaskID       uint       `json:"task_id,omitempty"`
+	TargetDBID   uint       `json:"target_db_id,omitempty"` // 多目标库任务中的目标库
+	TableName    string     `json:"table_name,omitempty"`
+	ConflictType string     `json:"conflict_type,omitempty"`
+	StartTime    *time.Time `json:"start_time,omitempty"`  // 创建时间下限（含）
+	EndTime      *time.Time `json:"end_time,omitempty"`    // 创建时间上限（含）
+	PrimaryKey   string     `json:"primary_key,omitempty"` // 主键值子串
+}
+
+// Apply 将筛选条件应用到查询上
+func (f *ConflictFilter) Apply(query *gorm.DB) *gorm.DB {
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.TaskID != 0 {
+		query = query.Where("task_id = ?", f.TaskID)
+	}
+	if f.TargetDBID != 0 {
+		query = query.Where("target_db_id = ?", f.TargetDBID)
+	}
+	if f.TableName != "" {
+		query = query.Where("table_name = ?", f.TableName)
+	}
+	if f.ConflictType != "" {
+		query = query.Where("conflict_type = ?", f.ConflictType)
+	}
+	if f.StartTime != nil {
+		query = query.Where("created_at >= ?", *f.StartTime)
+	}
+	if f.EndTime != nil {
+		query = query.Where("created_at <= ?", *f.EndTime)
+	}
+	if f.PrimaryKey != "" {
+		query = query.Where("primary_key LIKE ? ESCAPE '!'", "%"+escapeLike(f.PrimaryKey)+"%")
+	}
+	return query
+}
+
+// escapeLike 转义 LIKE 模式中的通配符，配合 ESCAPE '!' 使用
+// SQLite 没有默认的转义字符；反斜杠在 MySQL 字符串字面量中本身需要转义，因此使用 ! 作为转义字符
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+const (
+	bulkProgressInterval = 50  // 每处理多少条更新一次进度
+	bulkMaxErrors        = 100 // 最多保留的错误条数
+)
+
+// bulkError 批量处理中单条冲突的错误
+type bulkError struct {
+	ConflictID uint   `json:"conflict_id"`
+	Error      string `json:"error"`
+}
+
+// CreateConflictBulkJob 创建批量处理冲突任务并异步执行
+// 只处理待处理（pending）和处理失败（failed）的冲突
+func (s *SyncService) CreateConflictBulkJob(filter ConflictFilter, resolution string, userID uint) (*models.ConflictBulkJob, error) {
+	if filter.Status != "" && filter.Status != "pending" && filter.Status != "failed" {
+		return nil, fmt.Errorf("只能批量处理pending或failed状态的冲突")
+	}
+
+	filterJSON, _ := json.Marshal(filter)
+	job := models.ConflictBulkJob{
+		Filter:     string(filterJSON),
+		Resolution: resolution,
+		Status:     "pending",
+		CreatedBy:  userID,
+	}
+	if err := database.DB.Create(&job).Error; err != nil {
+		return nil, err
+	}
+
+	go s.runConflictBulkJob(job.ID, filter, resolution, userID)
+
+	return &job, nil
+}
+
+// runConflictBulkJob 执行批量处理冲突任务，定期更新进度
+func (s *SyncService) runConflictBulkJob(jobID uint, filter ConflictFilter, resolution string, userID uint) {
+	var job models.ConflictBulkJob
+	if err := database.DB.First(&job, jobID).Error; err != nil {
+		log.Printf("批量处理冲突任务 %d 不存在: %v", jobID, err)
+		return
+	}
+
+	// 先确定要处理的冲突ID，避免处理过程中状态变化影响分页
+	var ids []uint
+	query := filter.Apply(database.DB.Model(&models.DataConflict{}))
+	if filter.Status == "" {
+		query = query.Where("status IN ?", []string{"pending", "failed"})
+	}
+	if err := query.Order("id").Pluck("id", &ids).Error; err != nil {
+		s.finishBulkJob(&job, "failed", nil, fmt.Sprintf("查询冲突失败: %v", err))
+		return
+	}
+
+	now := time.Now()
+	job.Status = "running"
+	job.Total = len(ids)
+	job.StartedAt = &now
+	saveBulkJob(&job)
+
+	var errs []bulkError
+	for i, id := range ids {
+		var conflict models.DataConflict
+		err := database.DB.First(&conflict, id).Error
+		if err == nil && conflict.Status != "pending" && conflict.Status != "failed" {
+			err = fmt.Errorf("冲突已处理")
+		}
+		if err == nil {
+			err = s.ResolveConflict(&conflict, resolution, nil, userID)
+		}
+
+		job.Processed++
+		if err != nil {
+			job.Failed++
+			if len(errs) < bulkMaxErrors {
+				errs = append(errs, bulkError{ConflictID: id, Error: err.Error()})
+			}
+		} else {
+			job.Succeeded++
+		}
+
+		if (i+1)%bulkProgressInterval == 0 {
+			errorsJSON, _ := json.Marshal(errs)
+			job.Errors = string(errorsJSON)
+			saveBulkJob(&job)
+		}
+	}
+
+	s.finishBulkJob(&job, "completed", errs, "")
+}
+
+// finishBulkJob 结束批量处理任务并保存结果
+func (s *SyncService) finishBulkJob(job *models.ConflictBulkJob, status string, errs []bulkError, message string) {
+	if message != "" {
+		errs = append(errs, bulkError{Error: message})
+	}
+	errorsJSON, _ := json.Marshal(errs)
+	now := time.Now()
+	job.Status = status
+	job.Errors = string(errorsJSON)
+	job.FinishedAt = &now
+	saveBulkJob(job)
+}
+
+// saveBulkJob 保存批量处理任务的进度
+func saveBulkJob(job *models.ConflictBulkJob) {
+	if err := database.DB.Save(job).Error; err != nil {
+		log.Printf("保存批量处理冲突任务 %d 失败: %v", job.ID, err)
+	}
+}
+
+// RecoverConflictBulkJobs 启动时将上次运行中断的批量处理任务（pending、running）标记为失败
+// 已处理的冲突状态已经保存，重新创建任务即可处理剩余的冲突
+func RecoverConflictBulkJobs() {
+	errorsJSON, _ := json.Marshal([]bulkError{{Error: "服务重启，任务中断"}})
+	result := database.DB.Model(&models.ConflictBulkJob{}).
+		Where("status IN ?", []string{"pending", "running"}).
+		Updates(map[string]interface{}{"status": "failed", "errors": string(errorsJSON), "finished_at": time.Now()})
+	if result.Error != nil {
+		log.Printf("恢复中断的批量处理冲突任务失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已将 %d 个中断的批量处理冲突任务标记为失败", result.RowsAffected)
+	}
+}
@@ -0,0 +1,532 @@
+package service
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// ConflictOptions 冲突检测选项
+type ConflictOptions struct {
+	Columns          []string      // 参与冲突检测的列，为空表示全部列
+	NumericTolerance float64       // 数值比较容差
+	TimeTolerance    time.Duration // 时间比较容差
+}
+
+// conflictOptionsFromTask 根据任务配置构建冲突检测选项
+func conflictOptionsFromTask(task *models.SyncTask) *ConflictOptions {
+	opts := &ConflictOptions{
+		NumericTolerance: task.NumericTolerance,
+		TimeTolerance:    time.Duration(task.TimeTolerance) * time.Second,
+	}
+	for _, col := range strings.Split(task.ConflictColumns, ",") {
+		col = strings.TrimSpace(col)
+		if col != "" {
+			opts.Columns = append(opts.Columns, col)
+		}
+	}
+	return opts
+}
+
+// participatingColumns 返回某行参与冲突检测的列（按名称排序）
+func (o *ConflictOptions) participatingColumns(row map[string]interface{}) []string {
+	var cols []string
+	if o != nil && len(o.Columns) > 0 {
+		for _, col := range o.Columns {
+			if _, ok := row[col]; ok {
+				cols = append(cols, col)
+			}
+		}
+	} else {
+		for col := range row {
+			cols = append(cols, col)
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// rowFingerprint 行指纹：各列哈希及整行哈希
+type rowFingerprint struct {
+	Columns map[string]string
+	Hash    string
+}
+
+// fingerprintRow 计算行指纹，值先规范化再哈希，避免不同驱动的表示差异被误判为变更
+func (s *SyncService) fingerprintRow(row map[string]interface{}, opts *ConflictOptions) rowFingerprint {
+	cols := opts.participatingColumns(row)
+	fp := rowFingerprint{Columns: make(map[string]string, len(cols))}
+
+	rowHash := sha256.New()
+	for _, col := range cols {
+		sum := sha256.Sum256([]byte(s.canonicalValue(row[col])))
+		colHash := hex.EncodeToString(sum[:8])
+		fp.Columns[col] = colHash
+		rowHash.Write([]byte(col + "=" + colHash + ";"))
+	}
+	fp.Hash = hex.EncodeToString(rowHash.Sum(nil))
+	return fp
+}
+
+// canonicalValue 将值转换为规范化字符串（时间统一为UTC秒，数值统一为精确的十进制表示）
+func (s *SyncService) canonicalValue(v interface{}) string {
+	if v == nil {
+		return "\x00null"
+	}
+	if t, ok := s.parseTimeValue(v); ok {
+		return "t:" + strconv.FormatInt(t.Unix(), 10)
+	}
+	if r, _, ok := s.parseNumber(v); ok {
+		return "n:" + decimalString(r)
+	}
+	if b, ok := v.([]byte); ok {
+		return "s:" + string(b)
+	}
+	return "s:" + fmt.Sprint(v)
+}
+
+// parseNumber 尝试将值解析为精确数值，整数不经过浮点数转换，避免超过 2^53 的整数丢失精度
+// integer 表示值为整数类型或整数文本，浮点数和小数文本为 false
+func (s *SyncService) parseNumber(v interface{}) (r *big.Rat, integer bool, ok bool) {
+	var text string
+	switch n := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		text, integer = fmt.Sprint(n), true
+	case bool:
+		text, integer = "0", true
+		if n {
+			text = "1"
+		}
+	case float32:
+		text = strconv.FormatFloat(float64(n), 'f', -1, 32)
+	case float64:
+		text = strconv.FormatFloat(n, 'f', -1, 64)
+	case json.Number:
+		text = string(n)
+	case string:
+		text = strings.TrimSpace(n)
+		// big.Rat 还接受分数形式，文本中的 / 不视为数值
+		if strings.Contains(text, "/") {
+			return nil, false, false
+		}
+	default:
+		return nil, false, false
+	}
+
+	r, ok = new(big.Rat).SetString(text)
+	if !ok {
+		return nil, false, false
+	}
+	if !integer {
+		integer = !strings.ContainsAny(text, ".eEpP") && r.IsInt()
+	}
+	return r, integer, true
+}
+
+// decimalString 将数值格式化为最短的十进制表示（整数不带小数点，小数去掉末尾的0）
+func decimalString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	// 十进制小数的分母只含因子2和5，所需小数位数为两者指数的较大值
+	denom := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	for denom.Cmp(big.NewInt(1)) > 0 {
+		if mod.Mod(denom, two).Sign() == 0 {
+			denom.Quo(denom, two)
+			twos++
+		} else if mod.Mod(denom, five).Sign() == 0 {
+			denom.Quo(denom, five)
+			fives++
+		} else {
+			return r.RatString()
+		}
+	}
+	return r.FloatString(max(twos, fives))
+}
+
+// numbersEqual 比较两个数值：两端都是整数时精确比较；
+// 浮点数或小数在差值不超过容差时视为相等
+func numbersEqual(r1 *big.Rat, int1 bool, r2 *big.Rat, int2 bool, tolerance float64) bool {
+	if r1.Cmp(r2) == 0 {
+		return true
+	}
+	if (int1 && int2) || tolerance <= 0 {
+		return false
+	}
+	diff := new(big.Rat).Sub(r1, r2)
+	limit := new(big.Rat)
+	if limit.SetFloat64(tolerance) == nil {
+		return false
+	}
+	return diff.Abs(diff).Cmp(limit) <= 0
+}
+
+// rowsEqual 按冲突检测选项比较源行与目标行
+func (s *SyncService) rowsEqual(sourceRow, targetRow map[string]interface{}, opts *ConflictOptions) bool {
+	for _, col := range opts.participatingColumns(sourceRow) {
+		targetVal, ok := targetRow[col]
+		if !ok {
+			return false
+		}
+		if !s.valuesEqualWithOptions(sourceRow[col], targetVal, opts) {
+			return false
+		}
+	}
+	return true
+}
+
+// batchPlan 一批数据的写入计划
+type batchPlan struct {
+	toWrite    []map[string]interface{}          // 需要写入目标库的行
+	sourceRows map[string]map[string]interface{} // 需要刷新同步状态的行对应的源数据（按主键值索引）
+	writeBack  []map[string]interface{}          // 双向同步时需要写回源库的行
+	deleteBack []map[string]interface{}          // 双向同步时需要从源库删除的行
+}
+
+// settle 标记某行需要刷新同步状态，write 为 nil 表示无需写入目标库
+func (p *batchPlan) settle(pkValue string, sourceRow, write map[string]interface{}) {
+	if write != nil {
+		p.toWrite = append(p.toWrite, write)
+	}
+	p.sourceRows[pkValue] = sourceRow
+}
+
+// detectBatchConflicts 对比上次同步后的行状态，生成一批数据的写入计划
+// 只有源端和目标端自上次同步以来都发生变化且结果不一致时才视为冲突：
+// 任务配置了自动解决策略时按策略处理，否则（或策略无法解决时）记录待处理冲突，冲突行不会被覆盖
+// 双向同步时只在目标端变化的行留给反向阶段写回源库，目标端删除的行同步从源库删除
+func (s *SyncService) detectBatchConflicts(targetDB *sql.DB, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, batch []map[string]interface{}, primaryKeys []string, opts *ConflictOptions) (*batchPlan, error) {
+	targetRows, err := s.fetchRowsByKeys(targetDB, targetConn.Type, tableName, primaryKeys, batch)
+	if err != nil {
+		return nil, fmt.Errorf("查询目标表数据失败: %v", err)
+	}
+
+	states, err := s.loadRowStates(task, tableName, primaryKeys, batch)
+	if err != nil {
+		return nil, fmt.Errorf("查询行同步状态失败: %v", err)
+	}
+
+	plan := &batchPlan{
+		toWrite:    make([]map[string]interface{}, 0, len(batch)),
+		sourceRows: make(map[string]map[string]interface{}, len(batch)),
+	}
+	twoWay := isTwoWay(task)
+	for _, row := range batch {
+		pkValue := s.buildPrimaryKeyValue(row, primaryKeys)
+		state, hasState := states[pkValue]
+		if !hasState {
+			// 首次同步没有基准版本，以源数据为准
+			plan.settle(pkValue, row, row)
+			continue
+		}
+
+		targetRow, targetExists := targetRows[pkValue]
+		sourceChanged := s.fingerprintRow(row, opts).Hash != state.SourceHash
+		// 目标行不存在时按空行计算指纹，与按策略保留删除后记录的空状态一致
+		targetChanged := s.fingerprintRow(targetRow, opts).Hash != state.TargetHash
+
+		switch {
+		case !sourceChanged && !targetChanged:
+			// 两端都未变化，无需写入
+			continue
+		case sourceChanged && targetChanged:
+			if targetExists && s.rowsEqual(row, targetRow, opts) {
+				// 两端修改为相同的值，不视为冲突
+				plan.settle(pkValue, row, row)
+				continue
+			}
+			conflictType := "update_conflict"
+			if !targetExists {
+				conflictType = "delete_conflict"
+			}
+
+			outcome, policyErr := s.applyConflictPolicy(task, state, row, targetRow, opts)
+			if policyErr == nil {
+				if err := s.createAutoResolvedConflict(task, tableName, pkValue, row, targetRow, conflictType, outcome); err != nil {
+					s.logError(task.ID, fmt.Sprintf("记录自动解决的冲突失败: %v", err))
+				}
+				s.settleOutcome(plan, twoWay, pkValue, row, outcome)
+				continue
+			}
+			if task.ConflictPolicy != "" && task.ConflictPolicy != PolicyManual {
+				s.logInfo(task.ID, fmt.Sprintf("表 %s 主键 %s 的冲突无法自动解决: %v", tableName, pkValue, policyErr))
+			}
+
+			if err := s.recordDetectedConflict(task, tableName, pkValue, row, targetRow, conflictType); err != nil {
+				s.logError(task.ID, fmt.Sprintf("创建冲突记录失败: %v", err))
+			}
+		case targetChanged && twoWay:
+			if !targetExists {
+				plan.deleteBack = append(plan.deleteBack, row)
+			}
+		default:
+			plan.settle(pkValue, row, row)
+		}
+	}
+
+	return plan, nil
+}
+
+// settleOutcome 按冲突解决结果更新写入计划
+// 双向同步时结果与源数据不一致的行还需写回（或删除）源库，其同步状态在写回后再刷新
+func (s *SyncService) settleOutcome(plan *batchPlan, twoWay bool, pkValue string, sourceRow map[string]interface{}, outcome *policyOutcome) {
+	var write map[string]interface{}
+	if outcome.write {
+		write = outcome.row
+	}
+
+	switch {
+	case twoWay && outcome.row == nil:
+		plan.deleteBack = append(plan.deleteBack, sourceRow)
+	case twoWay && s.fingerprintRow(outcome.row, nil).Hash != s.fingerprintRow(sourceRow, nil).Hash:
+		plan.writeBack = append(plan.writeBack, outcome.row)
+		if write != nil {
+			plan.toWrite = append(plan.toWrite, write)
+		}
+	default:
+		plan.settle(pkValue, sourceRow, write)
+	}
+}
+
+// recordDetectedConflict 记录检测到的冲突，同一行已有待处理冲突时不重复创建
+func (s *SyncService) recordDetectedConflict(task *models.SyncTask, tableName, primaryKey string, sourceData, targetData map[string]interface{}, conflictType string) error {
+	var count int64
+	database.DB.Model(&models.DataConflict{}).
+		Where("task_id = ? AND target_db_id = ? AND table_name = ? AND primary_key = ? AND status = ?", task.ID, task.TargetDBID, tableName, primaryKey, "pending").
+		Count(&count)
+	if count > 0 {
+		return nil
+	}
+	return s.createConflict(task, tableName, primaryKey, sourceData, targetData, conflictType)
+}
+
+// recordRowStates 刷新写入计划中各行的同步状态，目标端哈希基于写入后重新读取的数据计算
+func (s *SyncService) recordRowStates(targetDB *sql.DB, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, plan *batchPlan, primaryKeys []string, opts *ConflictOptions) error {
+	if len(plan.sourceRows) == 0 || len(primaryKeys) == 0 {
+		return nil
+	}
+
+	rows := make([]map[string]interface{}, 0, len(plan.sourceRows))
+	for _, row := range plan.sourceRows {
+		rows = append(rows, row)
+	}
+
+	targetRows, err := s.fetchRowsByKeys(targetDB, targetConn.Type, tableName, primaryKeys, rows)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	states := make([]models.SyncRowState, 0, len(rows))
+	for pkValue, sourceRow := range plan.sourceRows {
+		targetRow, ok := targetRows[pkValue]
+		if !ok {
+			// 目标行不存在（如按策略保留目标端的删除），记录空的目标端状态
+			targetRow = map[string]interface{}{}
+		}
+		states = append(states, s.buildRowState(task, tableName, pkValue, sourceRow, targetRow, opts, now))
+	}
+
+	return s.saveRowStates(states)
+}
+
+// refreshRowStates 按两端当前数据刷新一批行的同步状态，两端都已删除的行清除其同步状态
+func (s *SyncService) refreshRowStates(sourceDB, targetDB dbconn.Executor, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, primaryKeys []string, rows []map[string]interface{}, opts *ConflictOptions) error {
+	sourceRows, err := s.fetchRowsByKeys(sourceDB, sourceConn.Type, tableName, primaryKeys, rows)
+	if err != nil {
+		return err
+	}
+	targetRows, err := s.fetchRowsByKeys(targetDB, targetConn.Type, tableName, primaryKeys, rows)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	states := make([]models.SyncRowState, 0, len(rows))
+	var removed []string
+	for _, row := range rows {
+		pkValue := s.buildPrimaryKeyValue(row, primaryKeys)
+		sourceRow, inSource := sourceRows[pkValue]
+		targetRow, inTarget := targetRows[pkValue]
+		if !inSource && !inTarget {
+			removed = append(removed, pkValue)
+			continue
+		}
+		states = append(states, s.buildRowState(task, tableName, pkValue, sourceRow, targetRow, opts, now))
+	}
+
+	if err := s.deleteRowStates(task, tableName, removed); err != nil {
+		return err
+	}
+	return s.saveRowStates(states)
+}
+
+// buildRowState 根据两端当前数据构建行同步状态
+func (s *SyncService) buildRowState(task *models.SyncTask, tableName, pkValue string, sourceRow, targetRow map[string]interface{}, opts *ConflictOptions, syncedAt time.Time) models.SyncRowState {
+	sourceFP := s.fingerprintRow(sourceRow, opts)
+	targetFP := s.fingerprintRow(targetRow, opts)
+	sourceCols, _ := json.Marshal(sourceFP.Columns)
+	targetCols, _ := json.Marshal(targetFP.Columns)
+
+	return models.SyncRowState{
+		TaskID:        task.ID,
+		TargetDBID:    task.TargetDBID,
+		TableName:     tableName,
+		PrimaryKey:    pkValue,
+		SourceHash:    sourceFP.Hash,
+		TargetHash:    targetFP.Hash,
+		SourceColumns: string(sourceCols),
+		TargetColumns: string(targetCols),
+		SyncedAt:      syncedAt,
+	}
+}
+
+// rowStateKeyParams 按主键值查询行同步状态时，除主键值外绑定的参数个数（任务、目标库、表名）
+const rowStateKeyParams = 3
+
+// metadataMaxParams 系统库单条语句最多绑定的参数个数
+func metadataMaxParams() int {
+	return dbconn.DialectFor(config.GlobalConfig.Database.Type).MaxParams()
+}
+
+// metadataChunkSize 系统库单条语句最多处理的行数：每行绑定 paramsPerRow 个参数，另有 fixedParams 个公共参数；
+// 同步批次的参数上限按源库和目标库计算，写入系统库时需要按系统库的上限分段
+func metadataChunkSize(rows, paramsPerRow, fixedParams int) int {
+	limit := metadataMaxParams()
+	if limit <= 0 {
+		return max(rows, 1)
+	}
+	return max((limit-fixedParams)/paramsPerRow, 1)
+}
+
+// saveRowStates 批量保存行同步状态（存在则更新），按系统库的参数上限分批插入
+func (s *SyncService) saveRowStates(states []models.SyncRowState) error {
+	if len(states) == 0 {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: database.DB}
+	if err := stmt.Parse(&models.SyncRowState{}); err != nil {
+		return err
+	}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}, {Name: "target_db_id"}, {Name: "table_name"}, {Name: "primary_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"source_hash", "target_hash", "source_columns", "target_columns", "synced_at", "updated_at"}),
+	}).CreateInBatches(&states, metadataChunkSize(len(states), len(stmt.Schema.DBNames), 0)).Error
+}
+
+// deleteRowStates 删除一批行的同步状态，按系统库的参数上限分段删除
+func (s *SyncService) deleteRowStates(task *models.SyncTask, tableName string, keys []string) error {
+	chunk := metadataChunkSize(len(keys), 1, rowStateKeyParams)
+	for start := 0; start < len(keys); start += chunk {
+		end := min(start+chunk, len(keys))
+		if err := database.DB.Where("task_id = ? AND target_db_id = ? AND table_name = ? AND primary_key IN ?", task.ID, task.TargetDBID, tableName, keys[start:end]).Delete(&models.SyncRowState{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadRowStates 加载一批行的同步状态，按主键值索引；主键值按系统库的参数上限分段查询
+func (s *SyncService) loadRowStates(task *models.SyncTask, tableName string, primaryKeys []string, rows []map[string]interface{}) (map[string]*models.SyncRowState, error) {
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, s.buildPrimaryKeyValue(row, primaryKeys))
+	}
+
+	result := make(map[string]*models.SyncRowState, len(keys))
+	chunk := metadataChunkSize(len(keys), 1, rowStateKeyParams)
+	for start := 0; start < len(keys); start += chunk {
+		end := min(start+chunk, len(keys))
+		var states []models.SyncRowState
+		if err := database.DB.Where("task_id = ? AND target_db_id = ? AND table_name = ? AND primary_key IN ?", task.ID, task.TargetDBID, tableName, keys[start:end]).Find(&states).Error; err != nil {
+			return nil, err
+		}
+		for i := range states {
+			result[states[i].PrimaryKey] = &states[i]
+		}
+	}
+	return result, nil
+}
+
+// fetchRowsByKeys 按主键批量查询行数据，按主键值索引
+func (s *SyncService) fetchRowsByKeys(db dbconn.Executor, dbType, tableName string, primaryKeys []string, rows []map[string]interface{}) (map[string]map[string]interface{}, error) {
+	return s.queryRowsByKeys(db, dbType, tableName, primaryKeys, rows, false)
+}
+
+// queryRowsByKeys 按主键批量查询行数据，forUpdate 为true时锁定查询到的行
+func (s *SyncService) queryRowsByKeys(db dbconn.Executor, dbType, tableName string, primaryKeys []string, rows []map[string]interface{}, forUpdate bool) (map[string]map[string]interface{}, error) {
+	result := make(map[string]map[string]interface{})
+	if len(rows) == 0 || len(primaryKeys) == 0 {
+		return result, nil
+	}
+
+	d := dbconn.DialectFor(dbType)
+	conditions := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(primaryKeys))
+	for _, row := range rows {
+		parts := make([]string, 0, len(primaryKeys))
+		for _, pk := range primaryKeys {
+			args = append(args, row[pk])
+			parts = append(parts, fmt.Sprintf("%s = %s", d.QuoteIdentifier(pk), d.Placeholder(len(args))))
+		}
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	table := d.QuoteIdentifier(tableName)
+	where := strings.Join(conditions, " OR ")
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s", table, where)
+	if forUpdate {
+		query = d.SelectForUpdate(table, where)
+	}
+	dataRows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer dataRows.Close()
+
+	columns, err := dataRows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	typeNames := dbconn.ColumnTypeNames(dataRows)
+
+	for dataRows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := dataRows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+
+		rowData := make(map[string]interface{})
+		for i, col := range columns {
+			val := values[i]
+			if i < len(typeNames) {
+				val = d.ConvertValue(typeNames[i], val)
+			}
+			rowData[col] = s.normalizeValue(val)
+		}
+		result[s.buildPrimaryKeyValue(rowData, primaryKeys)] = rowData
+	}
+
+	return result, dataRows.Err()
+}
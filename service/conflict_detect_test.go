@@ -0,0 +1,260 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// mysqlValue 按 scanRow 的方式转换 MySQL 驱动返回的值
+func mysqlValue(typeName string, raw interface{}) interface{} {
+	s := &SyncService{}
+	return s.normalizeValue(dbconn.DialectFor("mysql").ConvertValue(typeName, raw))
+}
+
+func TestMySQLRowsKeyedAlikeAcrossProtocols(t *testing.T) {
+	s := &SyncService{}
+	// 不带参数的查询（文本协议）返回 []byte，带参数的查询（二进制协议）返回 int64
+	text := map[string]interface{}{
+		"id":    mysqlValue("INT", []byte("1")),
+		"big":   mysqlValue("UNSIGNED BIGINT", []byte("9007199254740993")),
+		"price": mysqlValue("DOUBLE", []byte("2.5")),
+		"name":  mysqlValue("VARCHAR", []byte("a")),
+	}
+	binary := map[string]interface{}{
+		"id":    mysqlValue("INT", int64(1)),
+		"big":   mysqlValue("UNSIGNED BIGINT", int64(9007199254740993)),
+		"price": mysqlValue("DOUBLE", 2.5),
+		"name":  mysqlValue("VARCHAR", []byte("a")),
+	}
+
+	pks := []string{"id", "big"}
+	textKey, binaryKey := s.buildPrimaryKeyValue(text, pks), s.buildPrimaryKeyValue(binary, pks)
+	if textKey != binaryKey {
+		t.Errorf("主键值不一致: %s != %s", textKey, binaryKey)
+	}
+	if want := `{"big":9007199254740993,"id":1}`; binaryKey != want {
+		t.Errorf("主键值 = %s, want %s", binaryKey, want)
+	}
+	if s.fingerprintRow(text, nil).Hash != s.fingerprintRow(binary, nil).Hash {
+		t.Error("两种协议读取的同一行指纹不一致")
+	}
+}
+
+func TestFingerprintComparesIntegersExactly(t *testing.T) {
+	s := &SyncService{}
+	fp := func(v interface{}) string {
+		return s.fingerprintRow(map[string]interface{}{"v": v}, nil).Hash
+	}
+
+	// 超过 2^53 的整数转换为 float64 后相等，指纹必须不同
+	if fp(int64(9007199254740993)) == fp(int64(9007199254740992)) {
+		t.Error("相差1的大整数指纹相同")
+	}
+	if fp(uint64(18446744073709551615)) == fp(uint64(18446744073709551614)) {
+		t.Error("相差1的大无符号整数指纹相同")
+	}
+	// 同一数值的不同表示指纹相同
+	for _, v := range []interface{}{int32(10), uint8(10), 10.0, "10", "10.00"} {
+		if fp(v) != fp(int64(10)) {
+			t.Errorf("%T(%v) 与 int64(10) 指纹不同", v, v)
+		}
+	}
+	if fp("1/2") == fp(0.5) {
+		t.Error("分数文本不应按数值处理")
+	}
+}
+
+func TestValuesEqualWithOptions(t *testing.T) {
+	s := &SyncService{}
+	opts := &ConflictOptions{NumericTolerance: 0.5, TimeTolerance: 2 * time.Second}
+	tests := []struct {
+		v1, v2 interface{}
+		opts   *ConflictOptions
+		want   bool
+	}{
+		{int64(1), "1", nil, true},
+		{int64(1), "1.0", nil, true},
+		{"1.10", 1.1, nil, true},
+		{1.0, 1.25, nil, false},
+		{1.0, 1.25, opts, true},
+		{"1.0", int64(2), opts, false},
+		// 整数不使用容差
+		{int64(100), int64(101), &ConflictOptions{NumericTolerance: 5}, false},
+		{int64(9007199254740993), int64(9007199254740992), opts, false},
+		{"2024-01-01 00:00:00", "2024-01-01T00:00:01Z", nil, false},
+		{"2024-01-01 00:00:00", "2024-01-01T00:00:01Z", opts, true},
+		{"2024-01-01 00:00:00", "2024-01-01 00:00:00.000", nil, true},
+		{nil, nil, nil, true},
+		{nil, "", nil, false},
+		{"a", "b", nil, false},
+	}
+	for _, tt := range tests {
+		if got := s.valuesEqualWithOptions(tt.v1, tt.v2, tt.opts); got != tt.want {
+			t.Errorf("valuesEqualWithOptions(%#v, %#v, %+v) = %v, want %v", tt.v1, tt.v2, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestConflictColumnsLimitFingerprint(t *testing.T) {
+	s := &SyncService{}
+	opts := &ConflictOptions{Columns: []string{"name", "missing"}}
+	r1 := map[string]interface{}{"id": int64(1), "name": "a", "updated_at": "2024-01-01 00:00:00"}
+	r2 := map[string]interface{}{"id": int64(1), "name": "a", "updated_at": "2024-02-01 00:00:00"}
+
+	if s.fingerprintRow(r1, opts).Hash != s.fingerprintRow(r2, opts).Hash {
+		t.Error("不参与冲突检测的列不应影响指纹")
+	}
+	if s.fingerprintRow(r1, nil).Hash == s.fingerprintRow(r2, nil).Hash {
+		t.Error("未配置冲突检测列时所有列都应参与指纹")
+	}
+	if cols := s.fingerprintRow(r1, opts).Columns; len(cols) != 1 {
+		t.Errorf("columns = %v, want only name", cols)
+	}
+}
+
+func TestDecimalString(t *testing.T) {
+	s := &SyncService{}
+	for in, want := range map[string]string{
+		"10":                   "10",
+		"10.500":               "10.5",
+		"-0.125":               "-0.125",
+		"1e3":                  "1000",
+		"18446744073709551615": "18446744073709551615",
+	} {
+		r, _, ok := s.parseNumber(in)
+		if !ok {
+			t.Fatalf("parseNumber(%q) failed", in)
+		}
+		if got := decimalString(r); got != want {
+			t.Errorf("decimalString(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestSyncCopiesRowsAndRecordsState(t *testing.T) {
+	e := newTestEnv(t, "")
+	e.insertItem(e.source, 1, item{Name: "a", Qty: 1})
+	e.insertItem(e.source, 2, item{Name: "b", Qty: 2})
+	task := e.newTask(nil)
+
+	e.sync(task)
+
+	for id, want := range map[int]item{1: {Name: "a", Qty: 1}, 2: {Name: "b", Qty: 2}} {
+		if got := e.mustItem(e.target, id); got != want {
+			t.Errorf("目标行 %d = %+v, want %+v", id, got, want)
+		}
+	}
+
+	var states []models.SyncRowState
+	database.DB.Where("task_id = ?", task.ID).Order("primary_key").Find(&states)
+	if len(states) != 2 || states[0].PrimaryKey != `{"id":1}` || states[0].TargetDBID != e.targetConn.ID {
+		t.Fatalf("states = %+v", states)
+	}
+	if states[0].SourceHash != states[0].TargetHash {
+		t.Errorf("同步后两端哈希应一致: %+v", states[0])
+	}
+}
+
+func TestSyncRecordsConflictWhenBothSidesChange(t *testing.T) {
+	e := newTestEnv(t, "")
+	e.insertItem(e.source, 1, item{Name: "a"})
+	e.insertItem(e.source, 2, item{Name: "b"})
+	task := e.newTask(nil)
+	e.sync(task)
+
+	e.exec(e.source, "UPDATE items SET name = 'source' WHERE id = 1")
+	e.exec(e.target, "UPDATE items SET name = 'target' WHERE id = 1")
+	// 只有源端变化的行正常同步
+	e.exec(e.source, "UPDATE items SET name = 'b2' WHERE id = 2")
+	e.sync(task)
+	e.sync(task)
+
+	conflicts := e.conflicts(task)
+	if len(conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1（重复同步不应重复记录）", len(conflicts))
+	}
+	c := conflicts[0]
+	if c.PrimaryKey != `{"id":1}` || c.ConflictType != "update_conflict" || c.Status != "pending" || c.TargetDBID != e.targetConn.ID {
+		t.Errorf("conflict = %+v", c)
+	}
+	if got := e.mustItem(e.target, 1).Name; got != "target" {
+		t.Errorf("冲突行不应被覆盖，目标值为 %q", got)
+	}
+	if got := e.mustItem(e.target, 2).Name; got != "b2" {
+		t.Errorf("目标行 2 = %q, want b2", got)
+	}
+}
+
+func TestSyncIgnoresIdenticalChanges(t *testing.T) {
+	e := newTestEnv(t, "")
+	e.insertItem(e.source, 1, item{Name: "a"})
+	task := e.newTask(nil)
+	e.sync(task)
+
+	e.exec(e.source, "UPDATE items SET name = 'same' WHERE id = 1")
+	e.exec(e.target, "UPDATE items SET name = 'same' WHERE id = 1")
+	e.sync(task)
+
+	if conflicts := e.conflicts(task); len(conflicts) != 0 {
+		t.Errorf("两端修改为相同的值不应视为冲突: %+v", conflicts)
+	}
+}
+
+func TestRowStatesExceedMetadataParamLimit(t *testing.T) {
+	e := newTestEnv(t, "")
+	task := e.newTask(nil)
+	s := &SyncService{}
+	// 不输出数万个参数的SQL日志
+	prev := database.DB
+	database.DB = database.DB.Session(&gorm.Session{Logger: logger.Discard})
+	t.Cleanup(func() { database.DB = prev })
+
+	// 按主键查询和删除的行数超过系统库单条语句的参数上限，其中前一部分行的
+	// 同步状态已保存，行数 × 列数 同样超过参数上限
+	n := metadataMaxParams() + 1
+	rows := make([]map[string]interface{}, n)
+	keys := make([]string, n)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"id": int64(i)}
+		keys[i] = s.buildPrimaryKeyValue(rows[i], []string{"id"})
+	}
+	states := make([]models.SyncRowState, n/8)
+	for i := range states {
+		states[i] = s.buildRowState(task, "items", keys[i], rows[i], rows[i], nil, time.Now())
+	}
+	if err := s.saveRowStates(states); err != nil {
+		t.Fatalf("保存行同步状态失败: %v", err)
+	}
+	// 再次保存时更新已有记录
+	last := len(states) - 1
+	states[last].TargetHash = "changed"
+	if err := s.saveRowStates(states); err != nil {
+		t.Fatalf("更新行同步状态失败: %v", err)
+	}
+
+	loaded, err := s.loadRowStates(task, "items", []string{"id"}, rows)
+	if err != nil {
+		t.Fatalf("加载行同步状态失败: %v", err)
+	}
+	if len(loaded) != len(states) {
+		t.Fatalf("loaded %d states, want %d", len(loaded), len(states))
+	}
+	if got := loaded[keys[last]].TargetHash; got != "changed" {
+		t.Errorf("target hash = %q, want changed", got)
+	}
+
+	if err := s.deleteRowStates(task, "items", keys); err != nil {
+		t.Fatalf("删除行同步状态失败: %v", err)
+	}
+	var count int64
+	database.DB.Model(&models.SyncRowState{}).Where("task_id = ?", task.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("删除后仍有 %d 条行同步状态", count)
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+)
+
+// 冲突解决策略
+const (
+	PolicyManual         = "manual"           // 人工处理
+	PolicySourceWins     = "source_wins"      // 以源数据库为准
+	PolicyTargetWins     = "target_wins"      // 以目标数据库为准
+	PolicyLastWriterWins = "last_writer_wins" // 时间戳列较新的一方为准
+	PolicyVersionWins    = "version_wins"     // 版本列较大的一方为准
+	PolicyMerge          = "merge"            // 按列合并，同一列两端都修改时无法自动解决
+)
+
+// policyOutcome 冲突解决策略的执行结果
+type policyOutcome struct {
+	row   map[string]interface{} // 解决后的行数据
+	write bool                   // 是否需要写入目标库
+	note  string                 // 解决说明
+}
+
+// applyConflictPolicy 按任务的冲突解决策略尝试自动解决冲突，无法解决时返回错误
+func (s *SyncService) applyConflictPolicy(task *models.SyncTask, state *models.SyncRowState, sourceRow, targetRow map[string]interface{}, opts *ConflictOptions) (*policyOutcome, error) {
+	switch task.ConflictPolicy {
+	case "", PolicyManual:
+		return nil, fmt.Errorf("任务未配置自动解决策略")
+	case PolicySourceWins:
+		return &policyOutcome{row: sourceRow, write: true, note: "以源数据为准"}, nil
+	case PolicyTargetWins:
+		return &policyOutcome{row: targetRow, write: false, note: "以目标数据为准"}, nil
+	}
+
+	if sourceRow == nil {
+		return nil, fmt.Errorf("源行已删除，策略 %s 无法比较", task.ConflictPolicy)
+	}
+	if targetRow == nil {
+		return nil, fmt.Errorf("目标行已删除，策略 %s 无法比较", task.ConflictPolicy)
+	}
+
+	switch task.ConflictPolicy {
+	case PolicyLastWriterWins:
+		return s.resolveByTimestamp(task.PolicyColumn, sourceRow, targetRow)
+	case PolicyVersionWins:
+		return s.resolveByVersion(task.PolicyColumn, sourceRow, targetRow)
+	case PolicyMerge:
+		return s.resolveByMerge(state, sourceRow, targetRow, opts)
+	default:
+		return nil, fmt.Errorf("不支持的冲突解决策略: %s", task.ConflictPolicy)
+	}
+}
+
+// resolveByTimestamp 比较时间戳列，较新的一方为准
+func (s *SyncService) resolveByTimestamp(column string, sourceRow, targetRow map[string]interface{}) (*policyOutcome, error) {
+	sourceTime, ok1 := s.parseTimeValue(sourceRow[column])
+	targetTime, ok2 := s.parseTimeValue(targetRow[column])
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("时间戳列 %s 的值无法解析", column)
+	}
+
+	switch {
+	case sourceTime.After(targetTime):
+		return &policyOutcome{row: sourceRow, write: true, note: fmt.Sprintf("源数据 %s 较新", column)}, nil
+	case targetTime.After(sourceTime):
+		return &policyOutcome{row: targetRow, write: false, note: fmt.Sprintf("目标数据 %s 较新", column)}, nil
+	default:
+		return nil, fmt.Errorf("两端时间戳列 %s 相同", column)
+	}
+}
+
+// resolveByVersion 比较版本列，版本较大的一方为准
+func (s *SyncService) resolveByVersion(column string, sourceRow, targetRow map[string]interface{}) (*policyOutcome, error) {
+	sourceVersion, _, ok1 := s.parseNumber(sourceRow[column])
+	targetVersion, _, ok2 := s.parseNumber(targetRow[column])
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("版本列 %s 的值无法解析", column)
+	}
+
+	switch sourceVersion.Cmp(targetVersion) {
+	case 1:
+		return &policyOutcome{row: sourceRow, write: true, note: fmt.Sprintf("源数据 %s 版本较高", column)}, nil
+	case -1:
+		return &policyOutcome{row: targetRow, write: false, note: fmt.Sprintf("目标数据 %s 版本较高", column)}, nil
+	default:
+		return nil, fmt.Errorf("两端版本列 %s 相同", column)
+	}
+}
+
+// resolveByMerge 按列合并：只在一端修改的列取修改方的值，两端修改同一列且值不同时无法自动解决
+func (s *SyncService) resolveByMerge(state *models.SyncRowState, sourceRow, targetRow map[string]interface{}, opts *ConflictOptions) (*policyOutcome, error) {
+	var baseSource, baseTarget map[string]string
+	if err := json.Unmarshal([]byte(state.SourceColumns), &baseSource); err != nil {
+		return nil, fmt.Errorf("解析源端列状态失败: %v", err)
+	}
+	if err := json.Unmarshal([]byte(state.TargetColumns), &baseTarget); err != nil {
+		return nil, fmt.Errorf("解析目标端列状态失败: %v", err)
+	}
+
+	sourceFP := s.fingerprintRow(sourceRow, opts)
+	targetFP := s.fingerprintRow(targetRow, opts)
+
+	// 以源数据为基础（保持列集合与源表一致），取只在目标端修改的列
+	merged := make(map[string]interface{}, len(sourceRow))
+	for col, val := range sourceRow {
+		merged[col] = val
+	}
+
+	var fromTarget []string
+	for _, col := range opts.participatingColumns(sourceRow) {
+		targetVal, ok := targetRow[col]
+		if !ok {
+			continue
+		}
+		sourceChanged := sourceFP.Columns[col] != baseSource[col]
+		targetChanged := targetFP.Columns[col] != baseTarget[col]
+
+		switch {
+		case sourceChanged && targetChanged:
+			if !s.valuesEqualWithOptions(sourceRow[col], targetVal, opts) {
+				return nil, fmt.Errorf("列 %s 在两端都被修改", col)
+			}
+		case targetChanged:
+			merged[col] = targetVal
+			fromTarget = append(fromTarget, col)
+		}
+	}
+
+	return &policyOutcome{row: merged, write: true, note: fmt.Sprintf("按列合并，取目标端的列: %v", fromTarget)}, nil
+}
+
+// createAutoResolvedConflict 记录自动解决的冲突（用于审计）
+func (s *SyncService) createAutoResolvedConflict(task *models.SyncTask, tableName, primaryKey string, sourceData, targetData map[string]interface{}, conflictType string, outcome *policyOutcome) error {
+	sourceDataJSON, _ := json.Marshal(sourceData)
+	targetDataJSON, _ := json.Marshal(targetData)
+	resolvedDataJSON, _ := json.Marshal(outcome.row)
+	now := time.Now()
+
+	conflict := models.DataConflict{
+		TaskID:         task.ID,
+		TargetDBID:     task.TargetDBID,
+		TableName:      tableName,
+		PrimaryKey:     primaryKey,
+		SourceData:     string(sourceDataJSON),
+		TargetData:     string(targetDataJSON),
+		ConflictType:   conflictType,
+		Status:         "auto_resolved",
+		Resolution:     task.ConflictPolicy,
+		ResolvedData:   string(resolvedDataJSON),
+		ResolutionNote: outcome.note,
+		ResolvedAt:     &now,
+	}
+
+	if err := database.DB.Create(&conflict).Error; err != nil {
+		return err
+	}
+
+	DispatchWebhookEvent(WebhookEventConflictResolved, task.ID, conflictEventData(&conflict))
+	s.logInfo(task.ID, fmt.Sprintf("表 %s 主键 %s 的冲突已按策略 %s 自动解决: %s", tableName, primaryKey, task.ConflictPolicy, outcome.note))
+	return nil
+}
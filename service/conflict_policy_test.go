@@ -0,0 +1,106 @@
+package service
+
+import (
+	"testing"
+
+	"zh.xyz/dv/sync/models"
+)
+
+func TestSyncConflictPolicies(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		column     string
+		source     item // 源端修改后的行
+		target     item // 目标端修改后的行
+		want       item // 同步后的目标行
+		wantStatus string
+	}{
+		{
+			name:   "source wins",
+			policy: PolicySourceWins,
+			source: item{Name: "s", Qty: 1}, target: item{Name: "t", Qty: 1},
+			want: item{Name: "s", Qty: 1}, wantStatus: "auto_resolved",
+		},
+		{
+			name:   "target wins",
+			policy: PolicyTargetWins,
+			source: item{Name: "s", Qty: 1}, target: item{Name: "t", Qty: 1},
+			want: item{Name: "t", Qty: 1}, wantStatus: "auto_resolved",
+		},
+		{
+			name:   "version wins source",
+			policy: PolicyVersionWins, column: "version",
+			source: item{Name: "s", Version: 3}, target: item{Name: "t", Version: 2},
+			want: item{Name: "s", Version: 3}, wantStatus: "auto_resolved",
+		},
+		{
+			name:   "version wins target",
+			policy: PolicyVersionWins, column: "version",
+			source: item{Name: "s", Version: 2}, target: item{Name: "t", Version: 3},
+			want: item{Name: "t", Version: 3}, wantStatus: "auto_resolved",
+		},
+		{
+			name:   "version tie",
+			policy: PolicyVersionWins, column: "version",
+			source: item{Name: "s", Version: 2}, target: item{Name: "t", Version: 2},
+			want: item{Name: "t", Version: 2}, wantStatus: "pending",
+		},
+		{
+			name:   "last writer wins",
+			policy: PolicyLastWriterWins, column: "updated_at",
+			source: item{Name: "s", UpdatedAt: "2024-01-02 10:00:00"}, target: item{Name: "t", UpdatedAt: "2024-01-01 10:00:00"},
+			want: item{Name: "s", UpdatedAt: "2024-01-02 10:00:00"}, wantStatus: "auto_resolved",
+		},
+		{
+			name:   "merge different columns",
+			policy: PolicyMerge,
+			source: item{Name: "s", Qty: 1}, target: item{Name: "a", Qty: 9},
+			want: item{Name: "s", Qty: 9}, wantStatus: "auto_resolved",
+		},
+		{
+			name:   "merge same column",
+			policy: PolicyMerge,
+			source: item{Name: "s", Qty: 1}, target: item{Name: "t", Qty: 1},
+			want: item{Name: "t", Qty: 1}, wantStatus: "pending",
+		},
+		{
+			name:   "manual",
+			policy: PolicyManual,
+			source: item{Name: "s", Qty: 1}, target: item{Name: "t", Qty: 1},
+			want: item{Name: "t", Qty: 1}, wantStatus: "pending",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t, "")
+			e.insertItem(e.source, 1, item{Name: "a", Qty: 1, Version: 1, UpdatedAt: "2024-01-01 00:00:00"})
+			task := e.newTask(func(task *models.SyncTask) {
+				task.ConflictPolicy = tt.policy
+				task.PolicyColumn = tt.column
+			})
+			e.sync(task)
+
+			e.exec(e.source, "DELETE FROM items")
+			e.exec(e.target, "DELETE FROM items")
+			e.insertItem(e.source, 1, tt.source)
+			e.insertItem(e.target, 1, tt.target)
+			e.sync(task)
+
+			if got := e.mustItem(e.target, 1); got != tt.want {
+				t.Errorf("目标行 = %+v, want %+v", got, tt.want)
+			}
+			conflicts := e.conflicts(task)
+			if len(conflicts) != 1 || conflicts[0].Status != tt.wantStatus {
+				t.Fatalf("conflicts = %+v, want one %s", conflicts, tt.wantStatus)
+			}
+
+			// 自动解决后刷新了同步状态，再次同步不应产生新的冲突
+			e.sync(task)
+			if got := len(e.conflicts(task)); got != 1 {
+				t.Errorf("再次同步后有 %d 条冲突记录, want 1", got)
+			}
+		})
+	}
+}
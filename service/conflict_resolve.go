@@ -0,0 +1,489 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// ErrRowChanged 冲突记录后数据已被修改
+var ErrRowChanged = errors.New("数据在冲突记录后已被修改，请重新同步后再处理")
+
+// ErrInvalidMerge 合并方案不合法
+var ErrInvalidMerge = errors.New("合并方案不合法")
+
+// ErrConflictHandled 冲突已被处理或正在被其他请求处理
+var ErrConflictHandled = errors.New("冲突已处理或正在处理中")
+
+// MergeInput 人工合并方案
+type MergeInput struct {
+	Columns map[string]string      `json:"columns"` // 每列取值来源：source 或 target，未指定的列取源数据
+	Values  map[string]interface{} `json:"values"`  // 手工编辑的列值，优先于 Columns
+}
+
+// ResolveConflict 处理冲突：先将冲突标记为 resolving，再应用解决方案，成功后标记为 resolved，失败时标记为 failed 并记录错误
+// 标记为 resolving 是带状态条件的更新，同一冲突同时被多个请求（如批量任务和邮件链接）处理时只有一个能继续，其余返回 ErrConflictHandled
+// resolution 为 merge 时按 merge 构建合并后的行，合并方案不合法时返回 ErrInvalidMerge 且不修改冲突状态
+func (s *SyncService) ResolveConflict(conflict *models.DataConflict, resolution string, merge *MergeInput, userID uint) error {
+	ctx, err := s.loadConflictContext(conflict)
+	if err != nil {
+		if claimErr := s.claimConflict(conflict); claimErr != nil {
+			return claimErr
+		}
+		conflict.Resolution = resolution
+		return s.markConflictFailed(conflict, err)
+	}
+	defer ctx.close()
+
+	if resolution == "merge" {
+		merged, err := s.buildMergedRow(ctx, merge)
+		if err != nil {
+			return err
+		}
+		mergedJSON, _ := json.Marshal(merged)
+		conflict.ResolvedData = string(mergedJSON)
+	}
+	conflict.Resolution = resolution
+
+	if err := s.claimConflict(conflict); err != nil {
+		return err
+	}
+	if err := s.applyResolution(ctx, conflict); err != nil {
+		return s.markConflictFailed(conflict, err)
+	}
+
+	now := time.Now()
+	resolvedBy := userID
+	conflict.Status = "resolved"
+	conflict.ResolvedBy = &resolvedBy
+	conflict.ResolvedAt = &now
+	conflict.ErrorMessage = ""
+	if err := database.DB.Omit(clause.Associations).Save(conflict).Error; err != nil {
+		return err
+	}
+
+	if err := revokeConflictResolveTokens(conflict.ID); err != nil {
+		s.logError(conflict.TaskID, fmt.Sprintf("撤销冲突 %d 的处理链接失败: %v", conflict.ID, err))
+	}
+
+	DispatchWebhookEvent(WebhookEventConflictResolved, conflict.TaskID, conflictEventData(conflict))
+	return nil
+}
+
+// claimConflict 将待处理（pending）或处理失败（failed）的冲突标记为 resolving，冲突已被其他请求处理时返回 ErrConflictHandled
+func (s *SyncService) claimConflict(conflict *models.DataConflict) error {
+	result := database.DB.Model(&models.DataConflict{}).
+		Where("id = ? AND status IN ?", conflict.ID, []string{"pending", "failed"}).
+		Update("status", "resolving")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflictHandled
+	}
+	conflict.Status = "resolving"
+	return nil
+}
+
+// markConflictFailed 将冲突标记为 failed 并记录错误，返回原错误
+func (s *SyncService) markConflictFailed(conflict *models.DataConflict, err error) error {
+	conflict.Status = "failed"
+	conflict.ErrorMessage = err.Error()
+	database.DB.Omit(clause.Associations).Save(conflict)
+	return err
+}
+
+// RecoverResolvingConflicts 启动时将处理过程中服务中断、停留在 resolving 状态的冲突标记为失败，以便重新处理
+func RecoverResolvingConflicts() {
+	result := database.DB.Model(&models.DataConflict{}).
+		Where("status = ?", "resolving").
+		Updates(map[string]interface{}{"status": "failed", "error_message": "服务重启，处理中断，请确认数据后重新处理"})
+	if result.Error != nil {
+		log.Printf("恢复处理中断的冲突失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已将 %d 个处理中断的冲突标记为失败", result.RowsAffected)
+	}
+}
+
+// conflictContext 处理冲突所需的任务、连接和解析后的数据
+type conflictContext struct {
+	task          models.SyncTask
+	conflictTable string
+	sourceConn    models.DatabaseConnection
+	targetConn    models.DatabaseConnection
+	sourceRaw     *sql.DB
+	targetRaw     *sql.DB
+	primaryKeys   []string
+	primaryKey    map[string]interface{}
+	sourceData    map[string]interface{}
+	targetData    map[string]interface{}
+	opts          *ConflictOptions
+}
+
+func (c *conflictContext) close() {
+	if c.sourceRaw != nil {
+		dbconn.ReleaseConnection(c.sourceRaw)
+	}
+	if c.targetRaw != nil {
+		dbconn.ReleaseConnection(c.targetRaw)
+	}
+}
+
+// loadConflictContext 加载冲突对应的任务、数据库连接，并解析主键和两端数据
+func (s *SyncService) loadConflictContext(conflict *models.DataConflict) (*conflictContext, error) {
+	ctx := &conflictContext{conflictTable: conflict.TableName}
+
+	// 获取任务信息
+	if err := database.DB.First(&ctx.task, conflict.TaskID).Error; err != nil {
+		return nil, fmt.Errorf("同步任务不存在: %v", err)
+	}
+
+	// 多目标任务的冲突属于其中一个目标库，按该目标库处理
+	if conflict.TargetDBID != 0 {
+		ctx.task.TargetDBID = conflict.TargetDBID
+	}
+
+	// 获取数据库连接
+	if err := database.DB.First(&ctx.sourceConn, ctx.task.SourceDBID).Error; err != nil {
+		return nil, fmt.Errorf("源数据库连接不存在: %v", err)
+	}
+	if err := database.DB.First(&ctx.targetConn, ctx.task.TargetDBID).Error; err != nil {
+		return nil, fmt.Errorf("目标数据库连接不存在: %v", err)
+	}
+
+	// 解析主键和两端数据
+	var err error
+	ctx.primaryKey, err = decodeRowJSON(conflict.PrimaryKey)
+	if err != nil || len(ctx.primaryKey) == 0 {
+		return nil, fmt.Errorf("解析主键失败: %v", err)
+	}
+	for col := range ctx.primaryKey {
+		ctx.primaryKeys = append(ctx.primaryKeys, col)
+	}
+	sort.Strings(ctx.primaryKeys)
+
+	if ctx.sourceData, err = decodeRowJSON(conflict.SourceData); err != nil {
+		return nil, fmt.Errorf("解析源数据失败: %v", err)
+	}
+	if ctx.targetData, err = decodeRowJSON(conflict.TargetData); err != nil {
+		return nil, fmt.Errorf("解析目标数据失败: %v", err)
+	}
+	ctx.opts = conflictOptionsFromTask(&ctx.task)
+
+	if ctx.sourceRaw, err = dbconn.GetRawConnection(&ctx.sourceConn); err != nil {
+		return nil, fmt.Errorf("获取源数据库原生连接失败: %v", err)
+	}
+	if ctx.targetRaw, err = dbconn.GetRawConnection(&ctx.targetConn); err != nil {
+		ctx.close()
+		return nil, fmt.Errorf("获取目标数据库原生连接失败: %v", err)
+	}
+
+	return ctx, nil
+}
+
+// ApplyConflictResolution 应用冲突解决方案
+// source: 将源数据写入目标库；target: 双向同步任务将目标数据写回源库，单向任务保持目标数据不变；
+// merge: 将合并后的数据（ResolvedData）写入目标库，双向同步任务同时写回源库
+// 写入在事务中进行，写入前确认两端数据与冲突记录时一致
+func (s *SyncService) ApplyConflictResolution(conflict *models.DataConflict) error {
+	ctx, err := s.loadConflictContext(conflict)
+	if err != nil {
+		return err
+	}
+	defer ctx.close()
+
+	return s.applyResolution(ctx, conflict)
+}
+
+// applyResolution 按冲突的解决方案写入数据并刷新行同步状态
+func (s *SyncService) applyResolution(ctx *conflictContext, conflict *models.DataConflict) error {
+	tableName := conflict.TableName
+	twoWay := ctx.task.Direction == "two_way"
+
+	switch conflict.Resolution {
+	case "source":
+		if err := s.verifyRowUnchanged(ctx.sourceRaw, ctx.sourceConn.Type, tableName, ctx.primaryKeys, ctx.primaryKey, ctx.sourceData, ctx.opts); err != nil {
+			return fmt.Errorf("源库%v", err)
+		}
+		if err := s.applyRowInTx(ctx.targetRaw, &ctx.targetConn, tableName, ctx.primaryKeys, ctx.primaryKey, ctx.targetData, ctx.sourceData, ctx.opts); err != nil {
+			return fmt.Errorf("写入目标库失败: %v", err)
+		}
+	case "target":
+		if err := s.verifyRowUnchanged(ctx.targetRaw, ctx.targetConn.Type, tableName, ctx.primaryKeys, ctx.primaryKey, ctx.targetData, ctx.opts); err != nil {
+			return fmt.Errorf("目标库%v", err)
+		}
+		if twoWay {
+			if err := s.applyRowInTx(ctx.sourceRaw, &ctx.sourceConn, tableName, ctx.primaryKeys, ctx.primaryKey, ctx.sourceData, ctx.targetData, ctx.opts); err != nil {
+				return fmt.Errorf("写回源库失败: %v", err)
+			}
+		}
+	case "merge":
+		merged, err := decodeRowJSON(conflict.ResolvedData)
+		if err != nil || merged == nil {
+			return fmt.Errorf("解析合并数据失败: %v", err)
+		}
+		if err := s.verifyRowUnchanged(ctx.sourceRaw, ctx.sourceConn.Type, tableName, ctx.primaryKeys, ctx.primaryKey, ctx.sourceData, ctx.opts); err != nil {
+			return fmt.Errorf("源库%v", err)
+		}
+		if err := s.applyRowInTx(ctx.targetRaw, &ctx.targetConn, tableName, ctx.primaryKeys, ctx.primaryKey, ctx.targetData, merged, ctx.opts); err != nil {
+			return fmt.Errorf("写入目标库失败: %v", err)
+		}
+		if twoWay {
+			if err := s.applyRowInTx(ctx.sourceRaw, &ctx.sourceConn, tableName, ctx.primaryKeys, ctx.primaryKey, ctx.sourceData, merged, ctx.opts); err != nil {
+				return fmt.Errorf("写回源库失败: %v", err)
+			}
+		}
+	default:
+		return fmt.Errorf("不支持的解决方案: %s", conflict.Resolution)
+	}
+
+	// 刷新行同步状态，避免下次同步再次判定为冲突
+	if err := s.refreshRowState(ctx.sourceRaw, ctx.targetRaw, &ctx.sourceConn, &ctx.targetConn, &ctx.task, tableName, ctx.primaryKeys, ctx.primaryKey, ctx.opts); err != nil {
+		s.logError(ctx.task.ID, fmt.Sprintf("刷新行同步状态失败: %v", err))
+	}
+
+	return nil
+}
+
+// buildMergedRow 按人工合并方案构建合并后的行，列名需存在于目标表中
+func (s *SyncService) buildMergedRow(ctx *conflictContext, merge *MergeInput) (map[string]interface{}, error) {
+	if merge == nil || (len(merge.Columns) == 0 && len(merge.Values) == 0) {
+		return nil, fmt.Errorf("%w: 缺少columns或values", ErrInvalidMerge)
+	}
+
+	tableColumns, err := dbconn.TableColumns(ctx.targetRaw, dbconn.DialectFor(ctx.targetConn.Type), ctx.conflictTable)
+	if err != nil {
+		return nil, fmt.Errorf("获取目标表列信息失败: %v", err)
+	}
+	known := make(map[string]bool, len(tableColumns))
+	for _, col := range tableColumns {
+		known[col] = true
+	}
+
+	// 以源数据为基础，源行已删除时以目标数据为基础
+	base := ctx.sourceData
+	if base == nil {
+		base = ctx.targetData
+	}
+	merged := make(map[string]interface{}, len(tableColumns))
+	for _, col := range tableColumns {
+		if val, ok := base[col]; ok {
+			merged[col] = val
+		}
+	}
+
+	for col, side := range merge.Columns {
+		if !known[col] {
+			return nil, fmt.Errorf("%w: 列 %s 不存在", ErrInvalidMerge, col)
+		}
+		var from map[string]interface{}
+		switch side {
+		case "source":
+			from = ctx.sourceData
+		case "target":
+			from = ctx.targetData
+		default:
+			return nil, fmt.Errorf("%w: 列 %s 的取值来源必须是source或target", ErrInvalidMerge, col)
+		}
+		if from == nil {
+			return nil, fmt.Errorf("%w: %s 端数据已删除，列 %s 无法取值", ErrInvalidMerge, side, col)
+		}
+		merged[col] = from[col]
+	}
+
+	for col, val := range merge.Values {
+		if !known[col] {
+			return nil, fmt.Errorf("%w: 列 %s 不存在", ErrInvalidMerge, col)
+		}
+		merged[col] = val
+	}
+
+	// 主键不允许修改
+	for _, pk := range ctx.primaryKeys {
+		if !s.valuesEqual(merged[pk], ctx.primaryKey[pk]) {
+			return nil, fmt.Errorf("%w: 不允许修改主键列 %s", ErrInvalidMerge, pk)
+		}
+	}
+
+	return merged, nil
+}
+
+// applyRowInTx 在事务中锁定并校验当前行后写入 row，row 为 nil 时删除该行
+func (s *SyncService) applyRowInTx(db *sql.DB, conn *models.DatabaseConnection, tableName string, primaryKeys []string, primaryKey, expected, row map[string]interface{}, opts *ConflictOptions) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	current, err := s.queryRowsByKeys(tx, conn.Type, tableName, primaryKeys, []map[string]interface{}{primaryKey}, true)
+	if err != nil {
+		return err
+	}
+	if !s.snapshotMatches(current[s.buildPrimaryKeyValue(primaryKey, primaryKeys)], expected, opts) {
+		return ErrRowChanged
+	}
+
+	if row == nil {
+		err = s.deleteRowByKey(tx, conn.Type, tableName, primaryKeys, primaryKey)
+	} else {
+		err = s.syncBatch(tx, conn, tableName, []map[string]interface{}{row}, primaryKeys)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// verifyRowUnchanged 确认某端当前数据与冲突记录时的快照一致
+func (s *SyncService) verifyRowUnchanged(db *sql.DB, dbType, tableName string, primaryKeys []string, primaryKey, expected map[string]interface{}, opts *ConflictOptions) error {
+	current, err := s.fetchRowsByKeys(db, dbType, tableName, primaryKeys, []map[string]interface{}{primaryKey})
+	if err != nil {
+		return fmt.Errorf("查询当前数据失败: %v", err)
+	}
+	if !s.snapshotMatches(current[s.buildPrimaryKeyValue(primaryKey, primaryKeys)], expected, opts) {
+		return ErrRowChanged
+	}
+	return nil
+}
+
+// snapshotMatches 比较当前行与快照，两者都为空（行不存在）时视为一致
+func (s *SyncService) snapshotMatches(current, expected map[string]interface{}, opts *ConflictOptions) bool {
+	if current == nil || expected == nil {
+		return current == nil && expected == nil
+	}
+	return s.rowsEqual(expected, current, opts)
+}
+
+// deleteRowByKey 按主键删除一行
+func (s *SyncService) deleteRowByKey(db dbconn.Executor, dbType, tableName string, primaryKeys []string, primaryKey map[string]interface{}) error {
+	d := dbconn.DialectFor(dbType)
+	conditions := make([]string, 0, len(primaryKeys))
+	args := make([]interface{}, 0, len(primaryKeys))
+	for _, pk := range primaryKeys {
+		args = append(args, primaryKey[pk])
+		conditions = append(conditions, fmt.Sprintf("%s = %s", d.QuoteIdentifier(pk), d.Placeholder(len(args))))
+	}
+
+	_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", d.QuoteIdentifier(tableName), strings.Join(conditions, " AND ")), args...)
+	return err
+}
+
+// refreshRowState 按两端当前数据刷新某行的同步状态
+func (s *SyncService) refreshRowState(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, primaryKeys []string, primaryKey map[string]interface{}, opts *ConflictOptions) error {
+	return s.refreshRowStates(sourceDB, targetDB, sourceConn, targetConn, task, tableName, primaryKeys, []map[string]interface{}{primaryKey}, opts)
+}
+
+// decodeRowJSON 解析JSON格式的行数据，数值保留为 json.Number 以避免大整数精度丢失
+func decodeRowJSON(data string) (map[string]interface{}, error) {
+	if data == "" {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	decoder.UseNumber()
+
+	var row map[string]interface{}
+	if err := decoder.Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// ConflictFieldDiff 冲突中两端不一致的列
+type ConflictFieldDiff struct {
+	Column      string      `json:"column"`
+	SourceValue interface{} `json:"source_value"`
+	TargetValue interface{} `json:"target_value"`
+	Type        string      `json:"type"` // 规范化后的类型：null, time, number, string
+}
+
+// ComputeConflictDiff 计算冲突两端数据的列级差异，只返回不一致的列
+// 比较规则与冲突检测一致（valuesEqual 及任务配置的容差），仅格式不同的时间或数值不视为差异
+func (s *SyncService) ComputeConflictDiff(conflict *models.DataConflict) ([]ConflictFieldDiff, error) {
+	sourceData, err := decodeRowJSON(conflict.SourceData)
+	if err != nil {
+		return nil, fmt.Errorf("解析源数据失败: %v", err)
+	}
+	targetData, err := decodeRowJSON(conflict.TargetData)
+	if err != nil {
+		return nil, fmt.Errorf("解析目标数据失败: %v", err)
+	}
+
+	task := conflict.Task
+	if task.ID == 0 {
+		database.DB.First(&task, conflict.TaskID)
+	}
+	opts := conflictOptionsFromTask(&task)
+
+	columnSet := make(map[string]bool)
+	for col := range sourceData {
+		columnSet[col] = true
+	}
+	for col := range targetData {
+		columnSet[col] = true
+	}
+	columns := make([]string, 0, len(columnSet))
+	for col := range columnSet {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	diffs := make([]ConflictFieldDiff, 0)
+	for _, col := range columns {
+		sourceVal, inSource := sourceData[col]
+		targetVal, inTarget := targetData[col]
+		if inSource && inTarget && s.valuesEqualWithOptions(sourceVal, targetVal, opts) {
+			continue
+		}
+		diffs = append(diffs, ConflictFieldDiff{
+			Column:      col,
+			SourceValue: sourceVal,
+			TargetValue: targetVal,
+			Type:        s.diffValueType(sourceVal, targetVal),
+		})
+	}
+
+	return diffs, nil
+}
+
+// diffValueType 返回两端值规范化后的类型，以非空值为准
+func (s *SyncService) diffValueType(v1, v2 interface{}) string {
+	if v1 == nil {
+		v1 = v2
+	} else if v2 == nil {
+		v2 = v1
+	}
+	if v1 == nil {
+		return "null"
+	}
+
+	_, time1 := s.parseTimeValue(v1)
+	_, time2 := s.parseTimeValue(v2)
+	if time1 && time2 {
+		return "time"
+	}
+	_, _, num1 := s.parseNumber(v1)
+	_, _, num2 := s.parseNumber(v2)
+	if num1 && num2 {
+		return "number"
+	}
+	return "string"
+}
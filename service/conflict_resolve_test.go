@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+)
+
+// newPendingConflict 同步后在两端修改同一行，返回检测到的待处理冲突
+func newPendingConflict(t *testing.T, configure func(task *models.SyncTask)) (*testEnv, *models.SyncTask, models.DataConflict) {
+	t.Helper()
+	e := newTestEnv(t, "")
+	e.insertItem(e.source, 1, item{Name: "a", Qty: 1})
+	task := e.newTask(configure)
+	e.sync(task)
+
+	e.exec(e.source, "UPDATE items SET name = 'source' WHERE id = 1")
+	e.exec(e.target, "UPDATE items SET name = 'target', qty = 2 WHERE id = 1")
+	e.sync(task)
+
+	conflicts := e.conflicts(task)
+	if len(conflicts) != 1 || conflicts[0].Status != "pending" {
+		t.Fatalf("conflicts = %+v, want one pending", conflicts)
+	}
+	return e, task, conflicts[0]
+}
+
+func reloadConflict(t *testing.T, id uint) models.DataConflict {
+	t.Helper()
+	var conflict models.DataConflict
+	if err := database.DB.First(&conflict, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return conflict
+}
+
+func TestResolveConflictWithSource(t *testing.T) {
+	e, task, conflict := newPendingConflict(t, nil)
+	s := &SyncService{}
+
+	if err := s.ResolveConflict(&conflict, "source", nil, 1); err != nil {
+		t.Fatalf("ResolveConflict: %v", err)
+	}
+
+	if got, want := e.mustItem(e.target, 1), (item{Name: "source", Qty: 1}); got != want {
+		t.Errorf("目标行 = %+v, want %+v", got, want)
+	}
+	stored := reloadConflict(t, conflict.ID)
+	if stored.Status != "resolved" || stored.Resolution != "source" || stored.ResolvedBy == nil || *stored.ResolvedBy != 1 || stored.ResolvedAt == nil {
+		t.Errorf("conflict = %+v", stored)
+	}
+
+	// 解决后刷新了同步状态，再次同步不应产生新的冲突
+	e.sync(task)
+	if got := len(e.conflicts(task)); got != 1 {
+		t.Errorf("再次同步后有 %d 条冲突记录, want 1", got)
+	}
+}
+
+func TestResolveConflictOnlyOnce(t *testing.T) {
+	e, _, conflict := newPendingConflict(t, nil)
+	s := &SyncService{}
+
+	// 另一个请求持有的过期副本，状态仍为 pending
+	stale := conflict
+	if err := s.ResolveConflict(&conflict, "target", nil, 1); err != nil {
+		t.Fatalf("ResolveConflict: %v", err)
+	}
+
+	if err := s.ResolveConflict(&stale, "source", nil, 2); !errors.Is(err, ErrConflictHandled) {
+		t.Fatalf("err = %v, want ErrConflictHandled", err)
+	}
+	if got := e.mustItem(e.target, 1).Name; got != "target" {
+		t.Errorf("已解决的冲突被再次应用，目标值为 %q", got)
+	}
+	stored := reloadConflict(t, conflict.ID)
+	if stored.Resolution != "target" || *stored.ResolvedBy != 1 {
+		t.Errorf("conflict = %+v", stored)
+	}
+}
+
+func TestResolveConflictSkipsResolving(t *testing.T) {
+	e, _, conflict := newPendingConflict(t, nil)
+	database.DB.Model(&models.DataConflict{}).Where("id = ?", conflict.ID).Update("status", "resolving")
+
+	if err := (&SyncService{}).ResolveConflict(&conflict, "source", nil, 1); !errors.Is(err, ErrConflictHandled) {
+		t.Fatalf("err = %v, want ErrConflictHandled", err)
+	}
+	if got := e.mustItem(e.target, 1).Name; got != "target" {
+		t.Errorf("正在处理的冲突被再次应用，目标值为 %q", got)
+	}
+
+	RecoverResolvingConflicts()
+	if stored := reloadConflict(t, conflict.ID); stored.Status != "failed" {
+		t.Errorf("status = %s, want failed", stored.Status)
+	}
+}
+
+func TestResolveConflictFailsWhenRowChanged(t *testing.T) {
+	e, _, conflict := newPendingConflict(t, nil)
+	s := &SyncService{}
+
+	e.exec(e.source, "UPDATE items SET name = 'again' WHERE id = 1")
+	if err := s.ResolveConflict(&conflict, "source", nil, 1); err == nil {
+		t.Fatal("源行在冲突记录后被修改，应拒绝以源数据为准")
+	}
+	stored := reloadConflict(t, conflict.ID)
+	if stored.Status != "failed" || stored.ErrorMessage == "" {
+		t.Errorf("conflict = %+v", stored)
+	}
+	if got := e.mustItem(e.target, 1).Name; got != "target" {
+		t.Errorf("目标行不应被修改，目标值为 %q", got)
+	}
+
+	// 处理失败的冲突可以重新处理
+	if err := s.ResolveConflict(&stored, "target", nil, 1); err != nil {
+		t.Fatalf("重新处理失败: %v", err)
+	}
+	if stored := reloadConflict(t, conflict.ID); stored.Status != "resolved" || stored.ErrorMessage != "" {
+		t.Errorf("conflict = %+v", stored)
+	}
+}
+
+func TestResolveConflictMerge(t *testing.T) {
+	e, task, conflict := newPendingConflict(t, nil)
+	s := &SyncService{}
+
+	merge := &MergeInput{
+		Columns: map[string]string{"qty": "target"},
+		Values:  map[string]interface{}{"version": 7},
+	}
+	if err := s.ResolveConflict(&conflict, "merge", merge, 1); err != nil {
+		t.Fatalf("ResolveConflict: %v", err)
+	}
+
+	if got, want := e.mustItem(e.target, 1), (item{Name: "source", Qty: 2, Version: 7}); got != want {
+		t.Errorf("目标行 = %+v, want %+v", got, want)
+	}
+	if got, want := e.mustItem(e.source, 1), (item{Name: "source", Qty: 1}); got != want {
+		t.Errorf("单向同步不应修改源库，源行 = %+v, want %+v", got, want)
+	}
+	stored := reloadConflict(t, conflict.ID)
+	if stored.Status != "resolved" || stored.Resolution != "merge" || stored.ResolvedData == "" {
+		t.Errorf("conflict = %+v", stored)
+	}
+
+	e.sync(task)
+	if got := len(e.conflicts(task)); got != 1 {
+		t.Errorf("再次同步后有 %d 条冲突记录, want 1", got)
+	}
+}
+
+func TestResolveConflictMergeTwoWay(t *testing.T) {
+	e, _, conflict := newPendingConflict(t, twoWay)
+	s := &SyncService{}
+
+	merge := &MergeInput{
+		Columns: map[string]string{"qty": "target"},
+		Values:  map[string]interface{}{"version": 7},
+	}
+	if err := s.ResolveConflict(&conflict, "merge", merge, 1); err != nil {
+		t.Fatalf("ResolveConflict: %v", err)
+	}
+
+	want := item{Name: "source", Qty: 2, Version: 7}
+	if got := e.mustItem(e.target, 1); got != want {
+		t.Errorf("目标行 = %+v, want %+v", got, want)
+	}
+	if got := e.mustItem(e.source, 1); got != want {
+		t.Errorf("双向同步时合并结果应写回源库，源行 = %+v, want %+v", got, want)
+	}
+}
+
+func TestResolveConflictRejectsInvalidMerge(t *testing.T) {
+	e, _, conflict := newPendingConflict(t, nil)
+	s := &SyncService{}
+
+	for _, merge := range []*MergeInput{
+		nil,
+		{Columns: map[string]string{"missing": "source"}},
+		{Columns: map[string]string{"name": "elsewhere"}},
+		{Values: map[string]interface{}{"id": 2}},
+	} {
+		if err := s.ResolveConflict(&conflict, "merge", merge, 1); !errors.Is(err, ErrInvalidMerge) {
+			t.Errorf("merge %+v: err = %v, want ErrInvalidMerge", merge, err)
+		}
+	}
+	if stored := reloadConflict(t, conflict.ID); stored.Status != "pending" {
+		t.Errorf("不合法的合并方案不应修改冲突状态: %s", stored.Status)
+	}
+	if got := e.mustItem(e.target, 1).Name; got != "target" {
+		t.Errorf("目标值为 %q", got)
+	}
+}
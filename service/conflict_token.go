@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/utils"
+)
+
+// conflictTokenTTL 冲突操作链接有效期
+const conflictTokenTTL = 24 * time.Hour
+
+var (
+	ErrTokenRevoked     = errors.New("链接已失效")
+	ErrTokenActionWrong = errors.New("链接不允许该操作")
+)
+
+// ConflictLinks 冲突通知邮件中的操作链接token
+type ConflictLinks struct {
+	ViewToken          string
+	ResolveSourceToken string
+	ResolveTargetToken string
+}
+
+// GenerateConflictLinks 为接收人生成查看及处理冲突的签名token
+func GenerateConflictLinks(conflictID, userID uint) (*ConflictLinks, error) {
+	links := &ConflictLinks{}
+	var err error
+	if links.ViewToken, err = GenerateConflictActionToken(conflictID, userID, utils.ConflictActionView); err != nil {
+		return nil, err
+	}
+	if links.ResolveSourceToken, err = GenerateConflictActionToken(conflictID, userID, utils.ConflictActionResolveSource); err != nil {
+		return nil, err
+	}
+	if links.ResolveTargetToken, err = GenerateConflictActionToken(conflictID, userID, utils.ConflictActionResolveTarget); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// GenerateConflictActionToken 生成冲突操作token并记录，用于后续校验和撤销
+func GenerateConflictActionToken(conflictID, userID uint, action string) (string, error) {
+	token, tokenID, err := utils.GenerateConflictActionToken(conflictID, userID, action, conflictTokenTTL)
+	if err != nil {
+		return "", err
+	}
+
+	record := models.ConflictActionToken{
+		TokenID:    tokenID,
+		ConflictID: conflictID,
+		UserID:     userID,
+		Action:     action,
+		ExpiresAt:  time.Now().Add(conflictTokenTTL),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ValidateConflictActionToken 校验冲突操作token：签名、有效期、是否已撤销或使用，以及操作是否在允许范围内
+func ValidateConflictActionToken(token string, allowedActions ...string) (*utils.ConflictActionClaims, *models.ConflictActionToken, error) {
+	claims, err := utils.ParseConflictActionToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var record models.ConflictActionToken
+	if err := database.DB.Where("token_id = ?", claims.ID).First(&record).Error; err != nil {
+		return nil, nil, ErrTokenRevoked
+	}
+	if record.RevokedAt != nil || record.UsedAt != nil ||
+		record.ConflictID != claims.ConflictID || record.UserID != claims.UserID || record.Action != claims.Action {
+		return nil, nil, ErrTokenRevoked
+	}
+
+	for _, action := range allowedActions {
+		if claims.Action == action {
+			return claims, &record, nil
+		}
+	}
+	return nil, nil, ErrTokenActionWrong
+}
+
+// ResolveConflictByToken 通过邮件处理链接处理冲突：处理成功后才标记链接已使用，处理失败时链接仍可重试
+func (s *SyncService) ResolveConflictByToken(conflict *models.DataConflict, record *models.ConflictActionToken, userID uint) error {
+	resolution := "source"
+	if record.Action == utils.ConflictActionResolveTarget {
+		resolution = "target"
+	}
+
+	// 重复使用同一链接时由 ResolveConflict 的认领保证只处理一次，其余处理链接在成功后由其撤销
+	if err := s.ResolveConflict(conflict, resolution, nil, userID); err != nil {
+		return err
+	}
+	if err := consumeConflictActionToken(record); err != nil {
+		s.logError(conflict.TaskID, fmt.Sprintf("标记冲突 %d 的处理链接已使用失败: %v", conflict.ID, err))
+	}
+	return nil
+}
+
+// consumeConflictActionToken 标记token已使用
+func consumeConflictActionToken(record *models.ConflictActionToken) error {
+	return database.DB.Model(&models.ConflictActionToken{}).
+		Where("id = ? AND used_at IS NULL", record.ID).
+		Update("used_at", time.Now()).Error
+}
+
+// revokeConflictResolveTokens 撤销冲突尚未使用的处理链接（冲突已处理后不应再通过链接处理）
+func revokeConflictResolveTokens(conflictID uint) error {
+	return database.DB.Model(&models.ConflictActionToken{}).
+		Where("conflict_id = ? AND action <> ? AND used_at IS NULL AND revoked_at IS NULL", conflictID, utils.ConflictActionView).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeConflictActionTokens 撤销冲突的所有操作链接
+func RevokeConflictActionTokens(conflictID uint) error {
+	return database.DB.Model(&models.ConflictActionToken{}).
+		Where("conflict_id = ? AND revoked_at IS NULL", conflictID).
+		Update("revoked_at", time.Now()).Error
+}
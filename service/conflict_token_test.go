@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+	"zh.xyz/dv/sync/utils"
+)
+
+func tokenRecord(t *testing.T, token string) *models.ConflictActionToken {
+	t.Helper()
+	_, record, err := ValidateConflictActionToken(token, utils.ConflictActionResolveSource, utils.ConflictActionResolveTarget)
+	if err != nil {
+		t.Fatalf("ValidateConflictActionToken: %v", err)
+	}
+	return record
+}
+
+func TestValidateConflictActionToken(t *testing.T) {
+	_, _, conflict := newPendingConflict(t, nil)
+	links, err := GenerateConflictLinks(conflict.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, record, err := ValidateConflictActionToken(links.ViewToken, utils.ConflictActionView)
+	if err != nil {
+		t.Fatalf("ValidateConflictActionToken: %v", err)
+	}
+	if claims.ConflictID != conflict.ID || record.UserID != 1 || record.Action != utils.ConflictActionView {
+		t.Errorf("claims = %+v, record = %+v", claims, record)
+	}
+
+	// 查看链接不能用于处理冲突
+	if _, _, err := ValidateConflictActionToken(links.ViewToken, utils.ConflictActionResolveSource); !errors.Is(err, ErrTokenActionWrong) {
+		t.Errorf("err = %v, want ErrTokenActionWrong", err)
+	}
+
+	// 未记录的token（如系统库被重建）视为已失效
+	database.DB.Where("conflict_id = ?", conflict.ID).Delete(&models.ConflictActionToken{})
+	if _, _, err := ValidateConflictActionToken(links.ViewToken, utils.ConflictActionView); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("err = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestRevokeConflictActionTokens(t *testing.T) {
+	_, _, conflict := newPendingConflict(t, nil)
+	links, err := GenerateConflictLinks(conflict.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RevokeConflictActionTokens(conflict.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{links.ViewToken, links.ResolveSourceToken, links.ResolveTargetToken} {
+		if _, _, err := ValidateConflictActionToken(token, utils.ConflictActionView, utils.ConflictActionResolveSource, utils.ConflictActionResolveTarget); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("err = %v, want ErrTokenRevoked", err)
+		}
+	}
+}
+
+func TestResolveConflictByTokenConsumesLinks(t *testing.T) {
+	e, _, conflict := newPendingConflict(t, nil)
+	links, err := GenerateConflictLinks(conflict.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := tokenRecord(t, links.ResolveTargetToken)
+
+	if err := (&SyncService{}).ResolveConflictByToken(&conflict, record, 1); err != nil {
+		t.Fatalf("ResolveConflictByToken: %v", err)
+	}
+	if stored := reloadConflict(t, conflict.ID); stored.Status != "resolved" || stored.Resolution != "target" {
+		t.Errorf("conflict = %+v", stored)
+	}
+	if got := e.mustItem(e.target, 1).Name; got != "target" {
+		t.Errorf("目标值为 %q", got)
+	}
+
+	var used models.ConflictActionToken
+	database.DB.First(&used, record.ID)
+	if used.UsedAt == nil {
+		t.Error("处理成功后链接应标记为已使用")
+	}
+	// 处理链接只能使用一次，其余处理链接随之失效，查看链接仍然有效
+	for _, token := range []string{links.ResolveTargetToken, links.ResolveSourceToken} {
+		if _, _, err := ValidateConflictActionToken(token, utils.ConflictActionResolveSource, utils.ConflictActionResolveTarget); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("err = %v, want ErrTokenRevoked", err)
+		}
+	}
+	if _, _, err := ValidateConflictActionToken(links.ViewToken, utils.ConflictActionView); err != nil {
+		t.Errorf("查看链接不应失效: %v", err)
+	}
+}
+
+func TestResolveConflictByTokenKeepsLinksOnFailure(t *testing.T) {
+	e, _, conflict := newPendingConflict(t, nil)
+	links, err := GenerateConflictLinks(conflict.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 源行在冲突记录后被修改，以源数据为准处理失败
+	e.exec(e.source, "UPDATE items SET name = 'again' WHERE id = 1")
+	if err := (&SyncService{}).ResolveConflictByToken(&conflict, tokenRecord(t, links.ResolveSourceToken), 1); err == nil {
+		t.Fatal("源行已变化，处理应失败")
+	}
+
+	// 处理失败不应使链接失效，可用其他链接重新处理
+	tokenRecord(t, links.ResolveSourceToken)
+	stored := reloadConflict(t, conflict.ID)
+	if err := (&SyncService{}).ResolveConflictByToken(&stored, tokenRecord(t, links.ResolveTargetToken), 1); err != nil {
+		t.Fatalf("重新处理失败: %v", err)
+	}
+	if stored := reloadConflict(t, conflict.ID); stored.Status != "resolved" {
+		t.Errorf("status = %s, want resolved", stored.Status)
+	}
+}
+
+func TestResolveConflictByTokenOnlyOnce(t *testing.T) {
+	e, _, conflict := newPendingConflict(t, nil)
+	links, err := GenerateConflictLinks(conflict.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 两个并发请求在处理前都通过了校验
+	target, source := tokenRecord(t, links.ResolveTargetToken), tokenRecord(t, links.ResolveSourceToken)
+	stale := conflict
+
+	s := &SyncService{}
+	if err := s.ResolveConflictByToken(&conflict, target, 1); err != nil {
+		t.Fatalf("ResolveConflictByToken: %v", err)
+	}
+	if err := s.ResolveConflictByToken(&stale, source, 1); !errors.Is(err, ErrConflictHandled) {
+		t.Fatalf("err = %v, want ErrConflictHandled", err)
+	}
+	if got := e.mustItem(e.target, 1).Name; got != "target" {
+		t.Errorf("已解决的冲突被再次应用，目标值为 %q", got)
+	}
+}
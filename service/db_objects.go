@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
 	"zh.xyz/dv/sync/models"
 )
 
@@ -109,17 +110,15 @@ func (s *DatabaseObjectService) getObjects(db *sql.DB, dbType, dbName, objType s
 	var args []interface{}
 
 	switch objType {
-	case "procedure":
-		query, args = s.getProceduresQuery(dbType, dbName)
-	case "function":
-		query, args = s.getFunctionsQuery(dbType, dbName)
-	case "view":
-		query, args = s.getViewsQuery(dbType, dbName)
-	case "trigger":
-		query, args = s.getTriggersQuery(dbType, dbName)
+	case "procedure", "function", "view", "trigger":
+		query, args = dbconn.DialectFor(dbType).ObjectsQuery(objType, dbName)
 	default:
 		return nil, fmt.Errorf("不支持的对象类型: %s", objType)
 	}
+	if query == "" {
+		// 数据库没有该类对象（如SQLite没有存储过程和函数）
+		return nil, nil
+	}
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -151,184 +150,14 @@ func (s *DatabaseObjectService) getObjects(db *sql.DB, dbType, dbName, objType s
 	return objects, nil
 }
 
-// getProceduresQuery 获取存储过程查询SQL
-func (s *DatabaseObjectService) getProceduresQuery(dbType, dbName string) (string, []interface{}) {
-	switch dbType {
-	case "mysql":
-		return "SELECT ROUTINE_NAME, ROUTINE_SCHEMA FROM information_schema.ROUTINES WHERE ROUTINE_TYPE = 'PROCEDURE' AND ROUTINE_SCHEMA = ?", []interface{}{dbName}
-	case "postgres":
-		return "SELECT routine_name, routine_schema FROM information_schema.routines WHERE routine_type = 'PROCEDURE' AND routine_schema NOT IN ('pg_catalog', 'information_schema')", []interface{}{}
-	case "oracle":
-		return "SELECT object_name, owner FROM all_procedures WHERE object_type = 'PROCEDURE' AND owner = USER", []interface{}{}
-	default:
-		return "", nil
-	}
-}
-
-// getFunctionsQuery 获取函数查询SQL
-func (s *DatabaseObjectService) getFunctionsQuery(dbType, dbName string) (string, []interface{}) {
-	switch dbType {
-	case "mysql":
-		return "SELECT ROUTINE_NAME, ROUTINE_SCHEMA FROM information_schema.ROUTINES WHERE ROUTINE_TYPE = 'FUNCTION' AND ROUTINE_SCHEMA = ?", []interface{}{dbName}
-	case "postgres":
-		return "SELECT routine_name, routine_schema FROM information_schema.routines WHERE routine_type = 'FUNCTION' AND routine_schema NOT IN ('pg_catalog', 'information_schema')", []interface{}{}
-	case "oracle":
-		return "SELECT object_name, owner FROM all_objects WHERE object_type = 'FUNCTION' AND owner = USER", []interface{}{}
-	default:
-		return "", nil
-	}
-}
-
-// getViewsQuery 获取视图查询SQL
-func (s *DatabaseObjectService) getViewsQuery(dbType, dbName string) (string, []interface{}) {
-	switch dbType {
-	case "mysql":
-		return "SELECT TABLE_NAME, TABLE_SCHEMA FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ?", []interface{}{dbName}
-	case "postgres":
-		return "SELECT table_name, table_schema FROM information_schema.views WHERE table_schema NOT IN ('pg_catalog', 'information_schema')", []interface{}{}
-	case "oracle":
-		return "SELECT view_name, owner FROM all_views WHERE owner = USER", []interface{}{}
-	default:
-		return "", nil
-	}
-}
-
-// getTriggersQuery 获取触发器查询SQL
-func (s *DatabaseObjectService) getTriggersQuery(dbType, dbName string) (string, []interface{}) {
-	switch dbType {
-	case "mysql":
-		return "SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE, TRIGGER_SCHEMA FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ?", []interface{}{dbName}
-	case "postgres":
-		return "SELECT trigger_name, event_object_table, trigger_schema FROM information_schema.triggers WHERE trigger_schema NOT IN ('pg_catalog', 'information_schema')", []interface{}{}
-	case "oracle":
-		return "SELECT trigger_name, table_name, owner FROM all_triggers WHERE owner = USER", []interface{}{}
-	default:
-		return "", nil
-	}
-}
-
 // getObjectDefinition 获取对象定义
 func (s *DatabaseObjectService) getObjectDefinition(db *sql.DB, dbType, dbName, objType, objName, tableName string) (string, error) {
-	var query string
-	var args []interface{}
-
-	switch dbType {
-	case "mysql":
-		switch objType {
-		case "procedure", "function":
-			query = "SHOW CREATE " + strings.ToUpper(objType) + " " + quoteIdentifier(objName, dbType)
-		case "view":
-			query = "SHOW CREATE VIEW " + quoteIdentifier(objName, dbType)
-		case "trigger":
-			query = "SHOW CREATE TRIGGER " + quoteIdentifier(objName, dbType)
-		}
-	case "postgres":
-		switch objType {
-		case "procedure", "function":
-			query = fmt.Sprintf("SELECT pg_get_functiondef(oid) FROM pg_proc WHERE proname = $1")
-			args = []interface{}{objName}
-		case "view":
-			query = fmt.Sprintf("SELECT definition FROM pg_views WHERE viewname = $1")
-			args = []interface{}{objName}
-		case "trigger":
-			query = fmt.Sprintf("SELECT pg_get_triggerdef(oid) FROM pg_trigger WHERE tgname = $1")
-			args = []interface{}{objName}
-		}
-	case "oracle":
-		switch objType {
-		case "procedure", "function":
-			query = "SELECT text FROM all_source WHERE type = ? AND name = ? AND owner = USER ORDER BY line"
-			args = []interface{}{strings.ToUpper(objType), objName}
-		case "view":
-			query = "SELECT text FROM all_views WHERE view_name = ? AND owner = USER"
-			args = []interface{}{objName}
-		case "trigger":
-			query = "SELECT trigger_body FROM all_triggers WHERE trigger_name = ? AND owner = USER"
-			args = []interface{}{objName}
-		}
-	}
-
-	if query == "" {
-		return "", fmt.Errorf("不支持获取%s的定义", objType)
-	}
-
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return "", err
-	}
-	defer rows.Close()
-
-	var definition strings.Builder
-	var line string
-
-	for rows.Next() {
-		if err := rows.Scan(&line); err != nil {
-			continue
-		}
-		definition.WriteString(line)
-		if dbType == "oracle" && objType != "trigger" {
-			definition.WriteString("\n")
-		}
-	}
-
-	result := definition.String()
-
-	// MySQL的SHOW CREATE结果需要解析
-	if dbType == "mysql" {
-		result = s.parseMySQLShowCreate(result, objType)
-	}
-
-	return result, nil
-}
-
-// parseMySQLShowCreate 解析MySQL的SHOW CREATE结果
-func (s *DatabaseObjectService) parseMySQLShowCreate(result, objType string) string {
-	// MySQL返回的格式类似：Create Procedure: CREATE PROCEDURE name() ...
-	// 需要提取CREATE语句部分
-	titleObjType := strings.ToUpper(objType[:1]) + strings.ToLower(objType[1:])
-	if strings.Contains(result, "Create "+titleObjType+":") {
-		parts := strings.SplitN(result, ":", 2)
-		if len(parts) == 2 {
-			return strings.TrimSpace(parts[1])
-		}
-	}
-	return result
+	return dbconn.DialectFor(dbType).ObjectDefinition(db, objType, objName)
 }
 
 // dropObject 删除数据库对象
 func (s *DatabaseObjectService) dropObject(db *sql.DB, dbType, objType, objName, tableName string) error {
-	var dropSQL string
-
-	switch dbType {
-	case "mysql":
-		switch objType {
-		case "procedure", "function":
-			dropSQL = fmt.Sprintf("DROP %s IF EXISTS %s", strings.ToUpper(objType), quoteIdentifier(objName, dbType))
-		case "view":
-			dropSQL = fmt.Sprintf("DROP VIEW IF EXISTS %s", quoteIdentifier(objName, dbType))
-		case "trigger":
-			dropSQL = fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdentifier(objName, dbType))
-		}
-	case "postgres":
-		switch objType {
-		case "procedure", "function":
-			dropSQL = fmt.Sprintf("DROP %s IF EXISTS %s CASCADE", strings.ToUpper(objType), quoteIdentifier(objName, dbType))
-		case "view":
-			dropSQL = fmt.Sprintf("DROP VIEW IF EXISTS %s CASCADE", quoteIdentifier(objName, dbType))
-		case "trigger":
-			dropSQL = fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s CASCADE", quoteIdentifier(objName, dbType), quoteIdentifier(tableName, dbType))
-		}
-	case "oracle":
-		switch objType {
-		case "procedure", "function":
-			dropSQL = fmt.Sprintf("DROP %s %s", strings.ToUpper(objType), quoteIdentifier(objName, dbType))
-		case "view":
-			dropSQL = fmt.Sprintf("DROP VIEW %s", quoteIdentifier(objName, dbType))
-		case "trigger":
-			dropSQL = fmt.Sprintf("DROP TRIGGER %s", quoteIdentifier(objName, dbType))
-		}
-	}
-
+	dropSQL := dbconn.DialectFor(dbType).DropObjectSQL(objType, objName, tableName)
 	if dropSQL == "" {
 		return fmt.Errorf("不支持删除%s", objType)
 	}
@@ -384,14 +213,3 @@ func (s *DatabaseObjectService) logObjectSync(taskID uint, objType, objName, act
 	}
 	database.DB.Create(&log)
 }
-
-func quoteIdentifier(name, dbType string) string {
-	switch dbType {
-	case "mysql":
-		return "`" + name + "`"
-	case "postgres", "oracle":
-		return `"` + name + `"`
-	default:
-		return name
-	}
-}
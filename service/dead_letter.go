@@ -0,0 +1,193 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// deadLetterReplayLimit 一次批量重放的最大记录数
+const deadLetterReplayLimit = 1000
+
+// DeadLetterFilter 死信筛选条件
+type DeadLetterFilter struct {
+	Status     string `json:"status,omitempty"`
+	TaskID     uint   `json:"task_id,omitempty"`
+	TargetDBID uint   `json:"target_db_id,omitempty"`
+	RunID      string `json:"run_id,omitempty"`
+	TableName  string `json:"table_name,omitempty"`
+}
+
+// Apply 将筛选条件应用到查询上
+func (f *DeadLetterFilter) Apply(query *gorm.DB) *gorm.DB {
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.TaskID != 0 {
+		query = query.Where("task_id = ?", f.TaskID)
+	}
+	if f.TargetDBID != 0 {
+		query = query.Where("target_db_id = ?", f.TargetDBID)
+	}
+	if f.RunID != "" {
+		query = query.Where("run_id = ?", f.RunID)
+	}
+	if f.TableName != "" {
+		query = query.Where("table_name = ?", f.TableName)
+	}
+	return query
+}
+
+// DeadLetterReplayResult 单条死信的重放结果
+type DeadLetterReplayResult struct {
+	ID      uint   `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ReplayDeadLetters 按筛选条件重放待处理的死信，返回每条记录的结果
+func (s *SyncService) ReplayDeadLetters(filter DeadLetterFilter) ([]DeadLetterReplayResult, error) {
+	filter.Status = "pending"
+	var rows []models.DeadLetterRow
+	if err := filter.Apply(database.DB).Order("id").Limit(deadLetterReplayLimit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]DeadLetterReplayResult, 0, len(rows))
+	for i := range rows {
+		result := DeadLetterReplayResult{ID: rows[i].ID, Success: true}
+		if err := s.ReplayDeadLetter(&rows[i]); err != nil {
+			result.Success = false
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ErrDeadLetterHandled 死信已被重放或正在被其他请求重放
+var ErrDeadLetterHandled = errors.New("死信记录已处理或正在重放中")
+
+// ReplayDeadLetter 将死信中的行重新写入目标库，成功后标记为已重放，失败时恢复为待处理并更新错误信息
+// 重放前先将记录置为 replaying，并发重放同一条死信时只有一个请求会写入
+func (s *SyncService) ReplayDeadLetter(deadLetter *models.DeadLetterRow) error {
+	if err := s.claimDeadLetter(deadLetter); err != nil {
+		return err
+	}
+
+	err := s.replayDeadLetter(deadLetter)
+	updates := map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}
+	if err == nil {
+		now := time.Now()
+		updates["status"] = "replayed"
+		updates["replayed_at"] = now
+		s.logInfo(deadLetter.TaskID, fmt.Sprintf("死信 %d（表 %s 主键 %s）重放成功", deadLetter.ID, deadLetter.TableName, deadLetter.PrimaryKey))
+	} else {
+		updates["status"] = "pending"
+		updates["error"] = err.Error()
+	}
+	if dbErr := database.DB.Model(deadLetter).Updates(updates).Error; dbErr != nil {
+		return fmt.Errorf("更新死信记录失败: %v", dbErr)
+	}
+	deadLetter.Status = updates["status"].(string)
+	return err
+}
+
+// claimDeadLetter 将待处理的死信置为 replaying，已被其他请求处理时返回 ErrDeadLetterHandled
+func (s *SyncService) claimDeadLetter(deadLetter *models.DeadLetterRow) error {
+	result := database.DB.Model(&models.DeadLetterRow{}).
+		Where("id = ? AND status = ?", deadLetter.ID, "pending").
+		Update("status", "replaying")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeadLetterHandled
+	}
+	deadLetter.Status = "replaying"
+	return nil
+}
+
+// RecoverReplayingDeadLetters 启动时将重放过程中服务中断、停留在 replaying 状态的死信恢复为待处理
+func RecoverReplayingDeadLetters() {
+	result := database.DB.Model(&models.DeadLetterRow{}).
+		Where("status = ?", "replaying").
+		Updates(map[string]interface{}{"status": "pending", "error": "服务重启，重放中断，请确认目标数据后重新重放"})
+	if result.Error != nil {
+		log.Printf("恢复重放中断的死信失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已将 %d 条重放中断的死信恢复为待处理", result.RowsAffected)
+	}
+}
+
+// replayDeadLetter 在目标库事务中写入死信中的行，写入成功后刷新该行的同步状态
+func (s *SyncService) replayDeadLetter(deadLetter *models.DeadLetterRow) error {
+	var task models.SyncTask
+	if err := database.DB.First(&task, deadLetter.TaskID).Error; err != nil {
+		return fmt.Errorf("同步任务不存在: %v", err)
+	}
+	// 多目标任务的死信属于其中一个目标库，按该目标库处理
+	task.TargetDBID = deadLetter.TargetDBID
+
+	var targetConn models.DatabaseConnection
+	if err := database.DB.First(&targetConn, deadLetter.TargetDBID).Error; err != nil {
+		return fmt.Errorf("目标数据库连接不存在: %v", err)
+	}
+
+	row, err := decodeRowJSON(deadLetter.RowData)
+	if err != nil {
+		return fmt.Errorf("解析行数据失败: %v", err)
+	}
+	if len(row) == 0 {
+		return fmt.Errorf("行数据为空")
+	}
+
+	targetDB, err := dbconn.GetRawConnection(&targetConn)
+	if err != nil {
+		return fmt.Errorf("获取目标数据库原生连接失败: %v", err)
+	}
+	defer dbconn.ReleaseConnection(targetDB)
+
+	primaryKeys, err := dbconn.DialectFor(targetConn.Type).PrimaryKeys(targetDB, deadLetter.TableName)
+	if err != nil {
+		return fmt.Errorf("获取主键失败: %v", err)
+	}
+
+	err = s.writeWithRetry(&task, &targetConn, func() error {
+		return s.writeBatchTx(targetDB, &targetConn, deadLetter.TableName, []map[string]interface{}{row}, primaryKeys, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(primaryKeys) > 0 {
+		if err := s.refreshDeadLetterRowState(targetDB, &targetConn, &task, deadLetter.TableName, primaryKeys, row); err != nil {
+			s.logError(task.ID, fmt.Sprintf("刷新死信 %d 的行同步状态失败: %v", deadLetter.ID, err))
+		}
+	}
+	return nil
+}
+
+// refreshDeadLetterRowState 按两端当前数据刷新重放行的同步状态，避免下次同步将重放结果误判为目标端修改
+func (s *SyncService) refreshDeadLetterRowState(targetDB *sql.DB, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, primaryKeys []string, row map[string]interface{}) error {
+	var sourceConn models.DatabaseConnection
+	if err := database.DB.First(&sourceConn, task.SourceDBID).Error; err != nil {
+		return fmt.Errorf("源数据库连接不存在: %v", err)
+	}
+	sourceDB, err := dbconn.GetRawConnection(&sourceConn)
+	if err != nil {
+		return fmt.Errorf("获取源数据库原生连接失败: %v", err)
+	}
+	defer dbconn.ReleaseConnection(sourceDB)
+
+	return s.refreshRowState(sourceDB, targetDB, &sourceConn, targetConn, task, tableName, primaryKeys, row, conflictOptionsFromTask(task))
+}
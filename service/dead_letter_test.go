@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+)
+
+func TestSyncWritesFailingRowsToDeadLetters(t *testing.T) {
+	e := newTestEnv(t, `CREATE TABLE items (
+		id INTEGER PRIMARY KEY,
+		name TEXT,
+		qty INTEGER CHECK (qty >= 0),
+		version INTEGER,
+		updated_at TEXT
+	)`)
+	for id := 1; id <= 7; id++ {
+		qty := int64(id)
+		if id == 3 || id == 6 {
+			qty = -1
+		}
+		e.insertItem(e.source, id, item{Name: fmt.Sprint("row", id), Qty: qty})
+	}
+	task := e.newTask(nil)
+
+	if err := (&SyncService{}).syncTable(task); err != nil {
+		t.Fatalf("单行写入失败不应使同步失败: %v", err)
+	}
+
+	for id := 1; id <= 7; id++ {
+		_, ok := e.getItem(e.target, id)
+		if want := id != 3 && id != 6; ok != want {
+			t.Errorf("目标行 %d 存在 = %v, want %v", id, ok, want)
+		}
+	}
+
+	var deadLetters []models.DeadLetterRow
+	database.DB.Where("task_id = ?", task.ID).Order("primary_key").Find(&deadLetters)
+	if len(deadLetters) != 2 {
+		t.Fatalf("got %d dead letters, want 2: %+v", len(deadLetters), deadLetters)
+	}
+	for i, pk := range []string{`{"id":3}`, `{"id":6}`} {
+		d := deadLetters[i]
+		if d.PrimaryKey != pk || d.TargetDBID != e.targetConn.ID || d.Status != "pending" || d.RunID == "" || d.Error == "" {
+			t.Errorf("dead letter %d = %+v", i, d)
+		}
+	}
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	e := newTestEnv(t, `CREATE TABLE items (
+		id INTEGER PRIMARY KEY,
+		name TEXT UNIQUE,
+		qty INTEGER,
+		version INTEGER,
+		updated_at TEXT
+	)`)
+	e.insertItem(e.source, 1, item{Name: "a"})
+	e.insertItem(e.source, 2, item{Name: "a"})
+	task := e.newTask(nil)
+	e.sync(task)
+
+	var deadLetter models.DeadLetterRow
+	if err := database.DB.Where("task_id = ?", task.ID).First(&deadLetter).Error; err != nil {
+		t.Fatalf("未记录死信: %v", err)
+	}
+	reload := func() models.DeadLetterRow {
+		var d models.DeadLetterRow
+		database.DB.First(&d, deadLetter.ID)
+		return d
+	}
+
+	s := &SyncService{}
+	first := reload()
+	if err := s.ReplayDeadLetter(&first); err == nil {
+		t.Fatal("唯一约束仍冲突时重放应失败")
+	}
+	if d := reload(); d.Status != "pending" || d.Attempts != 2 || d.Error == "" {
+		t.Errorf("重放失败后死信 = %+v, want pending", d)
+	}
+
+	// 两端都改名后重放成功；同时持有的旧副本再次重放应被拒绝
+	e.exec(e.source, "UPDATE items SET name = 'b' WHERE id = 1")
+	e.exec(e.target, "UPDATE items SET name = 'b' WHERE id = 1")
+	second, stale := reload(), reload()
+	if err := s.ReplayDeadLetter(&second); err != nil {
+		t.Fatalf("重放失败: %v", err)
+	}
+	if err := s.ReplayDeadLetter(&stale); !errors.Is(err, ErrDeadLetterHandled) {
+		t.Fatalf("重复重放 err = %v, want ErrDeadLetterHandled", err)
+	}
+	if d := reload(); d.Status != "replayed" || d.Attempts != 3 || d.ReplayedAt == nil {
+		t.Errorf("重放成功后死信 = %+v", d)
+	}
+	if got := e.mustItem(e.target, 2); got.Name != "a" {
+		t.Errorf("目标行 2 = %+v", got)
+	}
+
+	var state models.SyncRowState
+	if err := database.DB.Where("task_id = ? AND primary_key = ?", task.ID, `{"id":2}`).First(&state).Error; err != nil {
+		t.Fatalf("重放后未记录行同步状态: %v", err)
+	}
+	if state.SourceHash != state.TargetHash || state.TargetDBID != e.targetConn.ID {
+		t.Errorf("重放后行同步状态 = %+v", state)
+	}
+}
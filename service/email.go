@@ -2,37 +2,144 @@ package service
 
 import (
 	"fmt"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
 	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
 	"zh.xyz/dv/sync/utils"
 
 	"gopkg.in/gomail.v2"
 )
 
-// SendConflictNotification 发送冲突通知邮件
-func SendConflictNotification(email string, conflictID uint, token string, conflictType string) error {
-	// 构建链接（包含token用于身份验证）
-	link := fmt.Sprintf("http://your-domain.com/api/v1/conflicts/view?token=%s", token)
-
-	subject := "数据库同步冲突通知"
-	body := fmt.Sprintf(`
-		<html>
-		<body>
-			<h2>数据库同步冲突通知</h2>
-			<p>检测到数据库同步过程中出现数据冲突：</p>
-			<ul>
-				<li>冲突ID: %d</li>
-				<li>冲突类型: %s</li>
-			</ul>
-			<p>请点击以下链接查看和处理冲突：</p>
-			<p><a href="%s">查看冲突详情</a></p>
-			<p>链接有效期：24小时</p>
-		</body>
-		</html>
-	`, conflictID, conflictType, link)
+const (
+	emailMaxDiffColumns = 20  // 冲突邮件中最多列出的差异列数
+	emailMaxValueLength = 200 // 邮件中单个值的最大显示长度
+)
+
+// conflictEmailDiff 冲突邮件中的列差异
+type conflictEmailDiff struct {
+	Column      string
+	SourceValue string
+	TargetValue string
+}
+
+// conflictEmailData 冲突邮件模板数据
+type conflictEmailData struct {
+	ConflictID       uint
+	ConflictType     string
+	TaskName         string
+	TableName        string
+	PrimaryKey       string
+	Diffs            []conflictEmailDiff
+	OmittedDiffs     int
+	ViewURL          string
+	ResolveSourceURL string
+	ResolveTargetURL string
+	ExpireHours      int
+}
+
+// digestEmailItem 通知摘要邮件中的单条事件
+type digestEmailItem struct {
+	NotificationEvent
+	Time    time.Time
+	ViewURL string
+}
+
+// digestEmailData 通知摘要邮件模板数据
+type digestEmailData struct {
+	Digest  bool
+	Total   int
+	Items   []digestEmailItem
+	Omitted int
+}
+
+// SendConflictNotification 发送冲突通知邮件，包含冲突的表、主键和不一致的列
+func SendConflictNotification(email, lang string, conflict *models.DataConflict, links *ConflictLinks) error {
+	data := conflictEmailData{
+		ConflictID:   conflict.ID,
+		ConflictType: conflict.ConflictType,
+		TaskName:     conflict.Task.Name,
+		TableName:    conflict.TableName,
+		PrimaryKey:   conflict.PrimaryKey,
+		// 构建链接（签名token绑定冲突、接收人和操作）
+		ViewURL:          conflictLinkURL("/api/v1/conflicts/view", links.ViewToken),
+		ResolveSourceURL: conflictLinkURL("/api/v1/conflicts/action", links.ResolveSourceToken),
+		ResolveTargetURL: conflictLinkURL("/api/v1/conflicts/action", links.ResolveTargetToken),
+		ExpireHours:      int(conflictTokenTTL / time.Hour),
+	}
+	if data.TaskName == "" {
+		var task models.SyncTask
+		if err := database.DB.First(&task, conflict.TaskID).Error; err == nil {
+			data.TaskName = task.Name
+		}
+	}
+
+	syncService := &SyncService{}
+	if diffs, err := syncService.ComputeConflictDiff(conflict); err == nil {
+		for i, diff := range diffs {
+			if i == emailMaxDiffColumns {
+				data.OmittedDiffs = len(diffs) - emailMaxDiffColumns
+				break
+			}
+			data.Diffs = append(data.Diffs, conflictEmailDiff{
+				Column:      diff.Column,
+				SourceValue: emailValue(diff.SourceValue),
+				TargetValue: emailValue(diff.TargetValue),
+			})
+		}
+	}
 
+	subject, body, err := renderEmail(lang, "conflict", data)
+	if err != nil {
+		return fmt.Errorf("渲染邮件模板失败: %v", err)
+	}
 	return sendEmail(email, subject, body)
 }
 
+// SendDigestNotification 发送通知事件列表邮件（摘要或单条非冲突事件）
+func SendDigestNotification(email, lang string, msg *NotificationMessage) error {
+	data := digestEmailData{Digest: msg.Digest, Total: len(msg.Events)}
+	for i, event := range msg.Events {
+		if i == digestMaxItems {
+			data.Omitted = len(msg.Events) - digestMaxItems
+			break
+		}
+		item := digestEmailItem{NotificationEvent: event, Time: event.OccurredAt.Local()}
+		if event.Type == EventConflict && event.ConflictID != 0 {
+			if token, err := GenerateConflictActionToken(event.ConflictID, msg.UserID, utils.ConflictActionView); err == nil {
+				item.ViewURL = conflictLinkURL("/api/v1/conflicts/view", token)
+			}
+		}
+		data.Items = append(data.Items, item)
+	}
+
+	subject, body, err := renderEmail(lang, "digest", data)
+	if err != nil {
+		return fmt.Errorf("渲染邮件模板失败: %v", err)
+	}
+	return sendEmail(email, subject, body)
+}
+
+// conflictLinkURL 生成带token的冲突链接
+func conflictLinkURL(path, token string) string {
+	return publicURL(path) + "?token=" + url.QueryEscape(token)
+}
+
+// emailValue 格式化邮件中显示的值，过长时截断
+func emailValue(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	s := fmt.Sprint(v)
+	if utf8.RuneCountInString(s) > emailMaxValueLength {
+		s = string([]rune(s)[:emailMaxValueLength]) + "..."
+	}
+	return s
+}
+
 // sendEmail 发送邮件
 func sendEmail(to, subject, body string) error {
 	cfg := config.GlobalConfig.Email
@@ -47,16 +154,3 @@ func sendEmail(to, subject, body string) error {
 
 	return d.DialAndSend(m)
 }
-
-// GenerateConflictToken 生成冲突查看token（包含冲突ID和用户信息）
-func GenerateConflictToken(conflictID uint, userID uint, username string) (string, error) {
-	tokenData := map[string]interface{}{
-		"conflict_id": conflictID,
-		"user_id":     userID,
-		"username":    username,
-		"type":        "conflict_view",
-	}
-	
-	// 使用自定义token生成
-	return utils.GenerateConflictViewToken(tokenData)
-}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"zh.xyz/dv/sync/config"
+)
+
+// 内置邮件模板，部署时可通过 email.template_dir 下的同名文件覆盖
+// 目录结构：<语言>/<模板名>_subject.txt（标题，text/template）和 <语言>/<模板名>.html（正文，html/template）
+//
+//go:embed templates/email
+var embeddedEmailTemplates embed.FS
+
+// 支持的通知语言
+const (
+	LanguageZh = "zh"
+	LanguageEn = "en"
+)
+
+// NormalizeLanguage 规范化用户语言，不支持的语言使用中文
+func NormalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if strings.HasPrefix(lang, LanguageEn) {
+		return LanguageEn
+	}
+	return LanguageZh
+}
+
+// renderEmail 按语言渲染邮件标题和正文
+func renderEmail(lang, name string, data interface{}) (string, string, error) {
+	lang = NormalizeLanguage(lang)
+
+	subjectSrc, err := readEmailTemplate(lang, name+"_subject.txt")
+	if err != nil {
+		return "", "", err
+	}
+	subjectTmpl, err := texttemplate.New(name + "_subject").Parse(subjectSrc)
+	if err != nil {
+		return "", "", err
+	}
+	var subject bytes.Buffer
+	if err := subjectTmpl.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+
+	bodySrc, err := readEmailTemplate(lang, name+".html")
+	if err != nil {
+		return "", "", err
+	}
+	bodyTmpl, err := htmltemplate.New(name).Parse(bodySrc)
+	if err != nil {
+		return "", "", err
+	}
+	var body bytes.Buffer
+	if err := bodyTmpl.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// readEmailTemplate 读取模板内容，优先使用自定义模板目录中的文件
+func readEmailTemplate(lang, file string) (string, error) {
+	if dir := config.GlobalConfig.Email.TemplateDir; dir != "" {
+		if data, err := os.ReadFile(filepath.Join(dir, lang, file)); err == nil {
+			return string(data), nil
+		}
+	}
+
+	data, err := embeddedEmailTemplates.ReadFile("templates/email/" + lang + "/" + file)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// publicURL 拼接对外访问地址，未配置 server.base_url 时使用本机地址
+func publicURL(path string) string {
+	base := strings.TrimRight(config.GlobalConfig.Server.BaseURL, "/")
+	if base == "" {
+		port := config.GlobalConfig.Server.Port
+		if port == "" {
+			port = "8080"
+		}
+		base = "http://localhost:" + port
+	}
+	return base + path
+}
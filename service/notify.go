@@ -0,0 +1,365 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// 通知事件类型
+const (
+	EventConflict     = "conflict"      // 产生待处理冲突
+	EventRunFailed    = "run_failed"    // 同步执行失败
+	EventRunSucceeded = "run_succeeded" // 同步执行成功
+	EventSchemaDrift  = "schema_drift"  // 源表与目标表结构不一致
+)
+
+// defaultDigestInterval 默认摘要发送间隔（分钟）
+const defaultDigestInterval = 30
+
+// NotificationEvent 通知事件
+type NotificationEvent struct {
+	Type         string    `json:"type"`
+	TaskID       uint      `json:"task_id"`
+	TaskName     string    `json:"task_name,omitempty"`
+	TableName    string    `json:"table_name,omitempty"`
+	ConflictID   uint      `json:"conflict_id,omitempty"`
+	ConflictType string    `json:"conflict_type,omitempty"`
+	PrimaryKey   string    `json:"primary_key,omitempty"`
+	Detail       string    `json:"detail,omitempty"` // 失败原因或结构差异
+	Message      string    `json:"message"`
+	OccurredAt   time.Time `json:"occurred_at"`
+}
+
+// NotificationMessage 发送给某个接收人的通知，摘要模式下包含多个事件
+type NotificationMessage struct {
+	UserID    uint                `json:"user_id"`
+	Recipient string              `json:"recipient"` // 渠道地址：邮箱、URL或文件路径
+	Digest    bool                `json:"digest"`
+	Events    []NotificationEvent `json:"events"`
+}
+
+// NotificationChannel 通知渠道
+type NotificationChannel interface {
+	Send(msg *NotificationMessage) error
+}
+
+var (
+	channelsMu           sync.RWMutex
+	notificationChannels = map[string]NotificationChannel{
+		"smtp":    &smtpChannel{},
+		"webhook": &webhookChannel{},
+		"file":    &fileChannel{},
+	}
+	digestMu sync.Mutex
+)
+
+// RegisterNotificationChannel 注册通知渠道（同名渠道会被替换）
+func RegisterNotificationChannel(name string, channel NotificationChannel) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	notificationChannels[name] = channel
+}
+
+// IsNotificationChannel 判断渠道是否已注册
+func IsNotificationChannel(name string) bool {
+	_, ok := getNotificationChannel(name)
+	return ok
+}
+
+func getNotificationChannel(name string) (NotificationChannel, bool) {
+	channelsMu.RLock()
+	defer channelsMu.RUnlock()
+	channel, ok := notificationChannels[name]
+	return channel, ok
+}
+
+// InitNotifier 启动周期性摘要发送
+func InitNotifier() {
+	interval := config.GlobalConfig.Notification.DigestInterval
+	if interval <= 0 {
+		interval = defaultDigestInterval
+	}
+
+	if _, err := cronManager.AddFunc(fmt.Sprintf("@every %dm", interval), SendNotificationDigests); err != nil {
+		log.Printf("启动通知摘要任务失败: %v", err)
+	}
+}
+
+// recipient 通知接收人（按用户、渠道和地址去重）
+type recipient struct {
+	userID  uint
+	channel string
+	target  string
+	digest  bool
+}
+
+// Notify 发布通知事件：按订阅立即发送，或加入摘要队列等待周期性合并发送
+// 没有任何订阅的有效管理员默认以邮件摘要接收冲突和同步失败事件
+func Notify(event NotificationEvent) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	for _, r := range findRecipients(event) {
+		if !r.digest {
+			msg := &NotificationMessage{UserID: r.userID, Recipient: r.target, Events: []NotificationEvent{event}}
+			go deliverNotification(r.channel, msg)
+			continue
+		}
+
+		payload, _ := json.Marshal(event)
+		pending := models.PendingNotification{
+			UserID:    r.userID,
+			Channel:   r.channel,
+			Target:    r.target,
+			EventType: event.Type,
+			TaskID:    event.TaskID,
+			Payload:   string(payload),
+		}
+		if err := database.DB.Create(&pending).Error; err != nil {
+			log.Printf("保存待发送通知失败: %v", err)
+		}
+	}
+}
+
+// findRecipients 查找订阅了事件的接收人
+func findRecipients(event NotificationEvent) []recipient {
+	var subscriptions []models.NotificationSubscription
+	database.DB.Preload("User").
+		Where("event_type = ? AND task_id IN ?", event.Type, []uint{0, event.TaskID}).
+		Find(&subscriptions)
+
+	seen := make(map[string]bool)
+	var recipients []recipient
+	add := func(r recipient) {
+		if r.target == "" {
+			return
+		}
+		key := fmt.Sprintf("%d|%s|%s", r.userID, r.channel, r.target)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		recipients = append(recipients, r)
+	}
+
+	// 任务事件只发送给管理员和任务创建人
+	var taskOwner uint
+	if event.TaskID != 0 {
+		database.DB.Model(&models.SyncTask{}).Select("created_by").Where("id = ?", event.TaskID).Scan(&taskOwner)
+	}
+
+	for _, sub := range subscriptions {
+		if sub.User.Status != "active" {
+			continue
+		}
+		isAdmin := sub.User.Role == "admin"
+		if !isAdmin && sub.UserID != taskOwner {
+			continue
+		}
+		// 订阅后角色可能变化，发送前重新检查地址
+		if err := CheckNotificationTarget(sub.Channel, sub.Target, isAdmin); err != nil {
+			log.Printf("跳过通知订阅 %d: %v", sub.ID, err)
+			continue
+		}
+		add(recipient{
+			userID:  sub.UserID,
+			channel: sub.Channel,
+			target:  defaultNotificationTarget(sub.Channel, sub.Target, &sub.User),
+			digest:  sub.Digest,
+		})
+	}
+
+	// 默认订阅：没有任何订阅的管理员接收冲突和同步失败事件的邮件摘要
+	if event.Type == EventConflict || event.Type == EventRunFailed {
+		var admins []models.User
+		database.DB.Where("role = ? AND status = ?", "admin", "active").
+			Where("NOT EXISTS (SELECT 1 FROM notification_subscriptions ns WHERE ns.user_id = users.id)").
+			Find(&admins)
+		for i := range admins {
+			add(recipient{userID: admins[i].ID, channel: "smtp", target: admins[i].Email, digest: true})
+		}
+	}
+
+	return recipients
+}
+
+// defaultNotificationTarget 渠道地址为空时使用默认值
+func defaultNotificationTarget(channel, target string, user *models.User) string {
+	if target != "" {
+		return target
+	}
+	switch channel {
+	case "smtp":
+		return user.Email
+	case "webhook":
+		return config.GlobalConfig.Notification.WebhookURL
+	case "file":
+		if config.GlobalConfig.Notification.FilePath != "" {
+			return config.GlobalConfig.Notification.FilePath
+		}
+		return "-"
+	default:
+		return ""
+	}
+}
+
+// CheckNotificationTarget 检查用户能否使用渠道地址：管理员不受限制；普通用户的webhook地址必须在配置的允许列表中，
+// file渠道只能写入配置允许的目录；空地址使用配置的默认值，不受限制
+func CheckNotificationTarget(channel, target string, isAdmin bool) error {
+	if isAdmin || target == "" {
+		return nil
+	}
+
+	switch channel {
+	case "webhook":
+		for _, allowed := range config.GlobalConfig.Notification.WebhookAllowlist {
+			if urlWithinPrefix(target, allowed) {
+				return nil
+			}
+		}
+		return fmt.Errorf("webhook地址不在允许的列表中")
+	case "file":
+		if target == "-" {
+			return nil
+		}
+		_, allowed, err := dbconn.PathWithinDirs(target, config.GlobalConfig.Notification.FileDirs)
+		if err != nil {
+			return fmt.Errorf("解析文件路径失败: %v", err)
+		}
+		if !allowed {
+			return fmt.Errorf("文件路径不在允许的目录中")
+		}
+		return nil
+	}
+	return nil
+}
+
+// urlWithinPrefix 判断URL与允许的地址协议、主机（含端口）相同，且路径以允许的路径为前缀
+func urlWithinPrefix(rawURL, prefix string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User != nil {
+		return false
+	}
+	p, err := url.Parse(prefix)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(u.Scheme, p.Scheme) || !strings.EqualFold(u.Host, p.Host) {
+		return false
+	}
+	path := "/" + strings.TrimPrefix(u.EscapedPath(), "/")
+	allowed := "/" + strings.TrimPrefix(p.EscapedPath(), "/")
+	if strings.Contains(path, "/../") || strings.HasSuffix(path, "/..") {
+		return false
+	}
+	return path == allowed || strings.HasPrefix(path, strings.TrimSuffix(allowed, "/")+"/")
+}
+
+// deliverNotification 通过指定渠道发送通知
+func deliverNotification(channelName string, msg *NotificationMessage) error {
+	channel, ok := getNotificationChannel(channelName)
+	if !ok {
+		err := fmt.Errorf("未知的通知渠道: %s", channelName)
+		log.Print(err)
+		return err
+	}
+	if err := channel.Send(msg); err != nil {
+		log.Printf("通过%s发送通知失败: %v", channelName, err)
+		return err
+	}
+	return nil
+}
+
+// SendNotificationDigests 将待发送通知按接收人合并为摘要发送，发送失败的通知保留到下次
+func SendNotificationDigests() {
+	digestMu.Lock()
+	defer digestMu.Unlock()
+
+	var pending []models.PendingNotification
+	if err := database.DB.Where("sent_at IS NULL").Order("id").Limit(10000).Find(&pending).Error; err != nil {
+		log.Printf("查询待发送通知失败: %v", err)
+		return
+	}
+
+	type group struct {
+		channel string
+		msg     *NotificationMessage
+		ids     []uint
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, p := range pending {
+		key := fmt.Sprintf("%d|%s|%s", p.UserID, p.Channel, p.Target)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{channel: p.Channel, msg: &NotificationMessage{UserID: p.UserID, Recipient: p.Target, Digest: true}}
+			groups[key] = g
+			order = append(order, key)
+		}
+		var event NotificationEvent
+		if err := json.Unmarshal([]byte(p.Payload), &event); err == nil {
+			g.msg.Events = append(g.msg.Events, event)
+		}
+		g.ids = append(g.ids, p.ID)
+	}
+
+	for _, key := range order {
+		g := groups[key]
+		if err := deliverNotification(g.channel, g.msg); err != nil {
+			continue
+		}
+		database.DB.Model(&models.PendingNotification{}).Where("id IN ?", g.ids).Update("sent_at", time.Now())
+	}
+}
+
+// notifyRunResult 发布同步执行结果通知
+func notifyRunResult(task *models.SyncTask, runErr error) {
+	event := NotificationEvent{
+		Type:      EventRunSucceeded,
+		TaskID:    task.ID,
+		TaskName:  task.Name,
+		TableName: task.TableName,
+		Message:   fmt.Sprintf("任务 %s 同步成功", task.Name),
+	}
+	if runErr != nil {
+		event.Type = EventRunFailed
+		event.Detail = runErr.Error()
+		event.Message = fmt.Sprintf("任务 %s 同步失败: %v", task.Name, runErr)
+	}
+	Notify(event)
+
+	if runErr != nil {
+		DispatchWebhookEvent(WebhookEventTaskFailed, task.ID, taskEventData(task, runErr))
+	} else {
+		DispatchWebhookEvent(WebhookEventTaskSucceeded, task.ID, taskEventData(task, nil))
+	}
+}
+
+// notifySchemaDrift 发布表结构不一致通知
+func notifySchemaDrift(task *models.SyncTask, tableName, message string) {
+	DispatchWebhookEvent(WebhookEventSchemaDrift, task.ID, map[string]interface{}{
+		"task_id":    task.ID,
+		"task_name":  task.Name,
+		"table_name": tableName,
+		"detail":     message,
+	})
+	Notify(NotificationEvent{
+		Type:      EventSchemaDrift,
+		TaskID:    task.ID,
+		TaskName:  task.Name,
+		TableName: tableName,
+		Detail:    message,
+		Message:   fmt.Sprintf("任务 %s：%s", task.Name, message),
+	})
+}
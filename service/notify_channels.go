@@ -0,0 +1,94 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+)
+
+// digestMaxItems 摘要邮件中最多列出的事件数
+const digestMaxItems = 50
+
+// smtpChannel 邮件通知渠道，按接收人的语言偏好渲染模板
+type smtpChannel struct{}
+
+// Send 单条冲突事件发送带操作链接的冲突邮件，其余情况发送事件列表
+func (c *smtpChannel) Send(msg *NotificationMessage) error {
+	var user models.User
+	database.DB.First(&user, msg.UserID)
+	lang := user.Language
+
+	if !msg.Digest && len(msg.Events) == 1 && msg.Events[0].Type == EventConflict {
+		var conflict models.DataConflict
+		if err := database.DB.Preload("Task").First(&conflict, msg.Events[0].ConflictID).Error; err != nil {
+			return err
+		}
+		links, err := GenerateConflictLinks(conflict.ID, msg.UserID)
+		if err != nil {
+			return err
+		}
+		return SendConflictNotification(msg.Recipient, lang, &conflict, links)
+	}
+
+	return SendDigestNotification(msg.Recipient, lang, msg)
+}
+
+// webhookChannel 以JSON格式POST到指定URL的通知渠道
+type webhookChannel struct{}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (c *webhookChannel) Send(msg *NotificationMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookClient.Post(msg.Recipient, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// fileChannel 将通知以JSON行写入文件或标准输出，便于测试
+type fileChannel struct {
+	mu sync.Mutex
+}
+
+func (c *fileChannel) Send(msg *NotificationMessage) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if msg.Recipient == "" || msg.Recipient == "-" {
+		_, err = os.Stdout.Write(line)
+		return err
+	}
+
+	f, err := os.OpenFile(msg.Recipient, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(line)
+	return err
+}
@@ -17,61 +17,67 @@ import (
 // SyncService 同步服务
 type SyncService struct{}
 
-// SyncTable 同步表数据
+// SyncTable 同步表数据，并发布任务开始、成功/失败事件
 func (s *SyncService) SyncTable(task *models.SyncTask) error {
-	// 获取源数据库和目标数据库连接
-	var sourceDB, targetDB models.DatabaseConnection
+	DispatchWebhookEvent(WebhookEventTaskStarted, task.ID, taskEventData(task, nil))
+	err := s.syncTable(task)
+	notifyRunResult(task, err)
+	return err
+}
+
+// syncTable 执行同步
+func (s *SyncService) syncTable(task *models.SyncTask) error {
+	// 获取源数据库连接
+	var sourceDB models.DatabaseConnection
 	if err := database.DB.First(&sourceDB, task.SourceDBID).Error; err != nil {
 		return fmt.Errorf("源数据库连接不存在: %v", err)
 	}
-	if err := database.DB.First(&targetDB, task.TargetDBID).Error; err != nil {
-		return fmt.Errorf("目标数据库连接不存在: %v", err)
-	}
 
 	// 获取源数据库原生连接用于查询
 	sourceRaw, err := dbconn.GetRawConnection(&sourceDB)
 	if err != nil {
 		return fmt.Errorf("获取源数据库原生连接失败: %v", err)
 	}
-	defer sourceRaw.Close()
+	defer dbconn.ReleaseConnection(sourceRaw)
 
 	// 测试源数据库连接
 	if err := sourceRaw.Ping(); err != nil {
 		return fmt.Errorf("源数据库连接不可用: %v", err)
 	}
 
-	targetRaw, err := dbconn.GetRawConnection(&targetDB)
-	if err != nil {
-		return fmt.Errorf("获取目标数据库原生连接失败: %v", err)
-	}
-	defer targetRaw.Close()
+	task.RunID = newRunID()
 
-	// 测试目标数据库连接
-	if err := targetRaw.Ping(); err != nil {
-		return fmt.Errorf("目标数据库连接不可用: %v", err)
+	// 连接所有目标数据库，连接失败的目标库不影响其他目标库
+	targets, err := s.openTargets(task)
+	if err != nil {
+		return err
 	}
 
-	// 如果表名为空，同步整个数据库
 	if task.TableName == "" {
-		return s.syncDatabase(sourceRaw, targetRaw, &sourceDB, &targetDB, task)
+		// 如果表名为空，同步整个数据库
+		err = s.syncDatabase(sourceRaw, &sourceDB, targets, task)
+	} else {
+		// 同步单个表
+		err = s.syncSingleTable(sourceRaw, &sourceDB, targets, task, task.TableName)
 	}
 
-	// 同步单个表
-	return s.syncSingleTable(sourceRaw, targetRaw, &sourceDB, &targetDB, task)
+	if targetErr := s.finishTargets(targets); err == nil {
+		err = targetErr
+	}
+	return err
 }
 
 // syncDatabase 同步整个数据库
-func (s *SyncService) syncDatabase(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask) error {
+func (s *SyncService) syncDatabase(sourceDB *sql.DB, sourceConn *models.DatabaseConnection, targets []*syncTarget, task *models.SyncTask) error {
 	// 1. 获取源数据库所有表
-	tables, err := s.getTables(sourceDB, sourceConn.Type)
+	tables, err := dbconn.DialectFor(sourceConn.Type).Tables(sourceDB)
 	if err != nil {
 		return err
 	}
 
 	// 2. 先同步所有表的结构和数据（数据库对象依赖表，必须先创建表）
 	for _, tableName := range tables {
-		task.TableName = tableName
-		if err := s.syncSingleTable(sourceDB, targetDB, sourceConn, targetConn, task); err != nil {
+		if err := s.syncSingleTable(sourceDB, sourceConn, targets, task, tableName); err != nil {
 			s.logError(task.ID, fmt.Sprintf("同步表 %s 失败: %v", tableName, err))
 			continue
 		}
@@ -80,45 +86,69 @@ func (s *SyncService) syncDatabase(sourceDB, targetDB *sql.DB, sourceConn, targe
 	// 3. 表同步完成后，再同步数据库对象（存储过程、触发器、视图、函数等）
 	// 注意：对象同步顺序很重要，应该按依赖关系：视图 → 存储过程/函数 → 触发器
 	objectService := &DatabaseObjectService{}
-	
-	// 先同步视图（可能依赖表，但不依赖其他对象）
-	if err := objectService.SyncObjectsByType(sourceDB, targetDB, sourceConn, targetConn, task, "view"); err != nil {
-		s.logError(task.ID, fmt.Sprintf("同步视图失败: %v", err))
-	}
-	
-	// 再同步存储过程和函数（可能引用表，但不依赖触发器）
-	if err := objectService.SyncObjectsByType(sourceDB, targetDB, sourceConn, targetConn, task, "procedure"); err != nil {
-		s.logError(task.ID, fmt.Sprintf("同步存储过程失败: %v", err))
-	}
-	if err := objectService.SyncObjectsByType(sourceDB, targetDB, sourceConn, targetConn, task, "function"); err != nil {
-		s.logError(task.ID, fmt.Sprintf("同步函数失败: %v", err))
-	}
-	
-	// 最后同步触发器（依赖表，必须最后同步）
-	if err := objectService.SyncObjectsByType(sourceDB, targetDB, sourceConn, targetConn, task, "trigger"); err != nil {
-		s.logError(task.ID, fmt.Sprintf("同步触发器失败: %v", err))
+	for _, t := range targets {
+		if t.db == nil {
+			continue
+		}
+
+		// 先同步视图（可能依赖表，但不依赖其他对象）
+		if err := objectService.SyncObjectsByType(sourceDB, t.db, sourceConn, &t.conn, &t.task, "view"); err != nil {
+			s.logError(task.ID, fmt.Sprintf("目标库 %s 同步视图失败: %v", t.name(), err))
+		}
+
+		// 再同步存储过程和函数（可能引用表，但不依赖触发器）
+		if err := objectService.SyncObjectsByType(sourceDB, t.db, sourceConn, &t.conn, &t.task, "procedure"); err != nil {
+			s.logError(task.ID, fmt.Sprintf("目标库 %s 同步存储过程失败: %v", t.name(), err))
+		}
+		if err := objectService.SyncObjectsByType(sourceDB, t.db, sourceConn, &t.conn, &t.task, "function"); err != nil {
+			s.logError(task.ID, fmt.Sprintf("目标库 %s 同步函数失败: %v", t.name(), err))
+		}
+
+		// 最后同步触发器（依赖表，必须最后同步）
+		if err := objectService.SyncObjectsByType(sourceDB, t.db, sourceConn, &t.conn, &t.task, "trigger"); err != nil {
+			s.logError(task.ID, fmt.Sprintf("目标库 %s 同步触发器失败: %v", t.name(), err))
+		}
 	}
 
 	return nil
 }
 
-// syncSingleTable 同步单个表
-func (s *SyncService) syncSingleTable(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask) error {
-	tableName := task.TableName
-
-	// 1. 确保表结构一致
-	if err := s.syncTableStructure(sourceDB, targetDB, sourceConn, targetConn, tableName); err != nil {
-		return fmt.Errorf("同步表结构失败: %v", err)
+// syncSingleTable 同步单个表：源表只读取一次，每批数据写入所有目标库
+// 返回的错误只表示源端失败，各目标库的失败记录在对应的 syncTarget 上
+func (s *SyncService) syncSingleTable(sourceDB *sql.DB, sourceConn *models.DatabaseConnection, targets []*syncTarget, task *models.SyncTask, tableName string) error {
+	// 1. 确保各目标库的表结构一致
+	active := make([]*syncTarget, 0, len(targets))
+	for _, t := range targets {
+		if t.db == nil {
+			continue
+		}
+		t.tableErr = nil
+		t.writeBack = &pendingChanges{}
+		if err := s.syncTableStructure(sourceDB, t.db, sourceConn, &t.conn, &t.task, tableName); err != nil {
+			s.failTable(t, tableName, fmt.Errorf("同步表结构失败: %v", err))
+			continue
+		}
+		active = append(active, t)
+	}
+	if len(active) == 0 {
+		return nil
 	}
 
 	// 2. 获取主键信息
-	primaryKeys, err := s.getPrimaryKeys(sourceDB, sourceConn.Type, tableName)
+	sourceDialect := dbconn.DialectFor(sourceConn.Type)
+	primaryKeys, err := sourceDialect.PrimaryKeys(sourceDB, tableName)
 	if err != nil {
 		return fmt.Errorf("获取主键失败: %v", err)
 	}
 
-	// 3. 查询源表数据
-	sourceRows, err := sourceDB.Query(fmt.Sprintf("SELECT * FROM %s", s.quoteIdentifier(tableName, sourceConn.Type)))
+	// 3. 目标表为空的目标库使用批量装载，其余目标库按批同步
+	active = s.bulkLoadTargets(sourceDB, sourceConn, active, task, tableName, primaryKeys)
+	if len(active) == 0 {
+		return nil
+	}
+
+	// 4. 查询源表数据
+	sourceRows, err := sourceDB.Query(fmt.Sprintf("SELECT * FROM %s", sourceDialect.QuoteIdentifier(tableName)))
 	if err != nil {
 		return fmt.Errorf("查询源表数据失败: %v", err)
 	}
@@ -128,438 +158,223 @@ func (s *SyncService) syncSingleTable(sourceDB, targetDB *sql.DB, sourceConn, ta
 	if err != nil {
 		return err
 	}
+	typeNames := dbconn.ColumnTypeNames(sourceRows)
 
-	// 4. 批量处理数据
-	batchSize := 100
+	// 5. 批量处理数据，所有目标库都失败后不再读取
+	targetDialects := make([]dbconn.Dialect, len(active))
+	for i, t := range active {
+		targetDialects[i] = dbconn.DialectFor(t.conn.Type)
+	}
+	batchSize := taskBatchSize(task, len(columns), targetDialects...)
 	batch := make([]map[string]interface{}, 0, batchSize)
+	conflictOpts := conflictOptionsFromTask(task)
+	limiter := newThrottle(task)
 
 	for sourceRows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-
-		if err := sourceRows.Scan(valuePtrs...); err != nil {
-			continue
-		}
-
-		rowData := make(map[string]interface{})
-		for i, col := range columns {
-			val := values[i]
-			rowData[col] = s.normalizeValue(val)
+		rowData, err := s.scanRow(sourceRows, columns, typeNames, sourceDialect)
+		if err != nil {
+			return fmt.Errorf("读取源表数据失败: %v", err)
 		}
 
 		batch = append(batch, rowData)
 
 		if len(batch) >= batchSize {
-			if err := s.syncBatch(targetDB, targetConn, tableName, batch, primaryKeys); err != nil {
-				s.logError(task.ID, fmt.Sprintf("批量同步失败: %v", err))
-			}
+			started := time.Now()
+			s.writeBatchToTargets(active, tableName, batch, primaryKeys, conflictOpts)
+			limiter.wait(batch, time.Since(started))
 			batch = batch[:0]
+			if !anyActive(active) {
+				return nil
+			}
 		}
 	}
 
 	// 处理剩余数据
 	if len(batch) > 0 {
-		if err := s.syncBatch(targetDB, targetConn, tableName, batch, primaryKeys); err != nil {
-			return err
-		}
+		s.writeBatchToTargets(active, tableName, batch, primaryKeys, conflictOpts)
 	}
 
-	// 5. 检查冲突
-	return s.checkConflicts(sourceDB, targetDB, sourceConn, targetConn, task, tableName, primaryKeys)
-}
-
-// syncTableStructure 同步表结构（简化版本，实际应该使用更复杂的DDL同步）
-func (s *SyncService) syncTableStructure(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, tableName string) error {
-	// 检查目标表是否存在
-	exists, err := s.tableExists(targetDB, targetConn.Type, tableName)
-	if err != nil {
-		return err
-	}
+	// 6. 双向同步（只有一个目标库）：先执行需要写回源库的变更，再将目标端的变更同步到源库
+	if isTwoWay(task) {
+		t := active[0]
+		if !t.active() {
+			return nil
+		}
+		if len(primaryKeys) == 0 {
+			s.logInfo(task.ID, fmt.Sprintf("表 %s 没有主键，无法双向同步，只同步源→目标", tableName))
+			return nil
+		}
 
-	if !exists {
-		// 创建表（需要根据源表结构生成DDL）
-		// 这里简化处理，实际应该解析源表结构并生成目标数据库的DDL
-		s.logInfo(0, fmt.Sprintf("目标表 %s 不存在，需要创建", tableName))
-		// TODO: 实现DDL同步逻辑
+		sourceRows.Close()
+		if err := s.applyPendingChanges(sourceDB, t.db, sourceConn, &t.conn, &t.task, tableName, primaryKeys, conflictOpts, t.writeBack, true); err != nil {
+			s.failTable(t, tableName, fmt.Errorf("写回源库失败: %v", err))
+			return nil
+		}
+		if err := s.syncReverse(sourceDB, t.db, sourceConn, &t.conn, &t.task, tableName, primaryKeys, conflictOpts, limiter); err != nil {
+			s.failTable(t, tableName, err)
+		}
 	}
 
 	return nil
 }
 
-// syncBatch 批量同步数据
-func (s *SyncService) syncBatch(targetDB *sql.DB, targetConn *models.DatabaseConnection, tableName string, batch []map[string]interface{}, primaryKeys []string) error {
-	if len(batch) == 0 {
-		return nil
+// scanRow 读取当前行，按列名返回转换并规范化后的值
+func (s *SyncService) scanRow(rows *sql.Rows, columns, typeNames []string, d dbconn.Dialect) (map[string]interface{}, error) {
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
 	}
 
-	// 获取所有列名（使用 map 的键，但需要保持顺序）
-	// 为了保持一致性，我们从第一条记录获取列名
-	columns := make([]string, 0, len(batch[0]))
-	columnMap := make(map[string]bool)
-	for col := range batch[0] {
-		columns = append(columns, col)
-		columnMap[col] = true
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return nil, err
 	}
 
-	// 验证所有记录都有相同的列
-	for i, row := range batch {
-		if len(row) != len(columns) {
-			return fmt.Errorf("记录 %d 的列数与第一条记录不匹配", i)
-		}
-		for col := range row {
-			if !columnMap[col] {
-				return fmt.Errorf("记录 %d 包含未知列: %s", i, col)
-			}
+	rowData := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		val := values[i]
+		if i < len(typeNames) {
+			val = d.ConvertValue(typeNames[i], val)
 		}
+		rowData[col] = s.normalizeValue(val)
 	}
-
-	quotedTableName := s.quoteIdentifier(tableName, targetConn.Type)
-
-	// 根据数据库类型使用不同的 UPSERT 策略
-	switch targetConn.Type {
-	case "mysql":
-		return s.syncBatchMySQL(targetDB, quotedTableName, batch, columns, primaryKeys)
-	case "postgres":
-		return s.syncBatchPostgres(targetDB, quotedTableName, batch, columns, primaryKeys)
-	case "oracle":
-		return s.syncBatchOracle(targetDB, quotedTableName, batch, columns, primaryKeys)
-	default:
-		return fmt.Errorf("不支持的数据库类型: %s", targetConn.Type)
-	}
+	return rowData, nil
 }
 
-// syncBatchMySQL 使用 MySQL 的 INSERT ... ON DUPLICATE KEY UPDATE
-func (s *SyncService) syncBatchMySQL(targetDB *sql.DB, tableName string, batch []map[string]interface{}, columns []string, primaryKeys []string) error {
-	if len(batch) == 0 {
-		return nil
+// processBatch 检测冲突后写入一批数据，并记录写入行的同步状态；需要写回源库的行加入 writeBack，在源表读取完成后执行
+// cache 为本次运行写入目标库时复用的表元数据
+func (s *SyncService) processBatch(targetDB *sql.DB, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, batch []map[string]interface{}, primaryKeys []string, opts *ConflictOptions, writeBack *pendingChanges, cache *dbconn.UpsertCache) error {
+	// 没有主键，无法检测冲突，直接写入
+	if len(primaryKeys) == 0 {
+		_, err := s.writeRows(targetDB, targetConn, task, tableName, batch, primaryKeys, cache)
+		return err
 	}
 
-	// 构建 INSERT 语句
-	placeholders := ""
-	for i := 0; i < len(columns); i++ {
-		if i > 0 {
-			placeholders += ","
-		}
-		placeholders += "?"
+	plan, err := s.detectBatchConflicts(targetDB, targetConn, task, tableName, batch, primaryKeys, opts)
+	if err != nil {
+		return err
 	}
 
-	// 构建列名列表
-	columnList := ""
-	for i, col := range columns {
-		if i > 0 {
-			columnList += ","
-		}
-		columnList += fmt.Sprintf("`%s`", col)
+	failed, err := s.writeRows(targetDB, targetConn, task, tableName, plan.toWrite, primaryKeys, cache)
+	if err != nil {
+		return err
 	}
-
-	// 构建 ON DUPLICATE KEY UPDATE 子句
-	updateClause := ""
-	for i, col := range columns {
-		if i > 0 {
-			updateClause += ","
-		}
-		updateClause += fmt.Sprintf("`%s`=VALUES(`%s`)", col, col)
+	// 写入死信表的行不记录同步状态，下次同步时重新处理
+	for _, row := range failed {
+		delete(plan.sourceRows, s.buildPrimaryKeyValue(row, primaryKeys))
 	}
+	writeBack.add(plan.writeBack, plan.deleteBack)
 
-	// 构建批量插入的占位符
-	batchPlaceholders := ""
-	for i := 0; i < len(batch); i++ {
-		if i > 0 {
-			batchPlaceholders += ","
-		}
-		batchPlaceholders += "(" + placeholders + ")"
+	if err := s.recordRowStates(targetDB, targetConn, task, tableName, plan, primaryKeys, opts); err != nil {
+		s.logError(task.ID, fmt.Sprintf("记录行同步状态失败: %v", err))
 	}
+	return nil
+}
 
-	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON DUPLICATE KEY UPDATE %s",
-		tableName, columnList, batchPlaceholders, updateClause)
-
-	// 准备参数，确保字符串值是有效的 UTF-8
-	args := make([]interface{}, 0, len(batch)*len(columns))
-	for _, row := range batch {
-		for _, col := range columns {
-			args = append(args, s.sanitizeValueForPostgres(row[col]))
-		}
+// syncTableStructure 同步表结构（简化版本，实际应该使用更复杂的DDL同步）
+func (s *SyncService) syncTableStructure(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string) error {
+	// 检查目标表是否存在
+	exists, err := dbconn.DialectFor(targetConn.Type).TableExists(targetDB, tableName)
+	if err != nil {
+		return err
 	}
 
-	_, err := targetDB.Exec(sql, args...)
-	return err
-}
-
-// syncBatchPostgres 使用 PostgreSQL 的 INSERT ... ON CONFLICT ... DO UPDATE
-func (s *SyncService) syncBatchPostgres(targetDB *sql.DB, tableName string, batch []map[string]interface{}, columns []string, primaryKeys []string) error {
-	if len(batch) == 0 {
+	if !exists {
+		// 创建表（需要根据源表结构生成DDL）
+		// 这里简化处理，实际应该解析源表结构并生成目标数据库的DDL
+		s.logInfo(task.ID, fmt.Sprintf("目标表 %s 不存在，需要创建", tableName))
+		notifySchemaDrift(task, tableName, fmt.Sprintf("目标表 %s 不存在", tableName))
+		// TODO: 实现DDL同步逻辑
 		return nil
 	}
 
-	// 构建列名列表
-	columnList := ""
-	for i, col := range columns {
-		if i > 0 {
-			columnList += ","
-		}
-		columnList += fmt.Sprintf(`"%s"`, col)
+	// 检查源表和目标表的列是否一致
+	if drift := s.compareTableColumns(sourceDB, targetDB, sourceConn, targetConn, tableName); drift != "" {
+		s.logInfo(task.ID, fmt.Sprintf("表 %s 结构不一致: %s", tableName, drift))
+		notifySchemaDrift(task, tableName, fmt.Sprintf("表 %s 结构不一致: %s", tableName, drift))
 	}
 
-	// 如果没有主键，使用简单的 INSERT（可能会因为唯一约束失败，但这是预期行为）
-	if len(primaryKeys) == 0 {
-		return s.syncBatchPostgresSimpleInsert(targetDB, tableName, batch, columns)
-	}
+	return nil
+}
 
-	// 构建冲突目标（主键列）
-	conflictTarget := ""
-	for i, pk := range primaryKeys {
-		if i > 0 {
-			conflictTarget += ","
-		}
-		conflictTarget += fmt.Sprintf(`"%s"`, pk)
+// compareTableColumns 比较源表和目标表的列（忽略大小写），返回差异描述，一致时返回空字符串
+func (s *SyncService) compareTableColumns(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, tableName string) string {
+	sourceColumns, err := dbconn.TableColumns(sourceDB, dbconn.DialectFor(sourceConn.Type), tableName)
+	if err != nil {
+		return ""
 	}
-
-	// 构建 UPDATE 子句
-	updateClause := ""
-	for i, col := range columns {
-		if i > 0 {
-			updateClause += ","
-		}
-		updateClause += fmt.Sprintf(`"%s"=EXCLUDED."%s"`, col, col)
+	targetColumns, err := dbconn.TableColumns(targetDB, dbconn.DialectFor(targetConn.Type), tableName)
+	if err != nil {
+		return ""
 	}
 
-	// 为每条记录构建 VALUES 子句
-	valuesClauses := make([]string, 0, len(batch))
-	args := make([]interface{}, 0, len(batch)*len(columns))
-	argIndex := 1
-
-	for _, row := range batch {
-		placeholders := ""
-		for i := 0; i < len(columns); i++ {
-			if i > 0 {
-				placeholders += ","
-			}
-			placeholders += fmt.Sprintf("$%d", argIndex)
-			// 确保字符串值是有效的 UTF-8
-			args = append(args, s.sanitizeValueForPostgres(row[columns[i]]))
-			argIndex++
-		}
-		valuesClauses = append(valuesClauses, "("+placeholders+")")
+	targetSet := make(map[string]bool, len(targetColumns))
+	for _, col := range targetColumns {
+		targetSet[strings.ToLower(col)] = true
 	}
-
-	valuesClause := ""
-	for i, v := range valuesClauses {
-		if i > 0 {
-			valuesClause += ","
+	sourceSet := make(map[string]bool, len(sourceColumns))
+	var missing, extra []string
+	for _, col := range sourceColumns {
+		sourceSet[strings.ToLower(col)] = true
+		if !targetSet[strings.ToLower(col)] {
+			missing = append(missing, col)
 		}
-		valuesClause += v
 	}
-
-	sql := fmt.Sprintf(`INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) DO UPDATE SET %s`,
-		tableName, columnList, valuesClause, conflictTarget, updateClause)
-
-	_, err := targetDB.Exec(sql, args...)
-	return err
-}
-
-// syncBatchPostgresSimpleInsert 当没有主键时，使用简单的 INSERT
-func (s *SyncService) syncBatchPostgresSimpleInsert(targetDB *sql.DB, tableName string, batch []map[string]interface{}, columns []string) error {
-	// 构建列名列表
-	columnList := ""
-	for i, col := range columns {
-		if i > 0 {
-			columnList += ","
+	for _, col := range targetColumns {
+		if !sourceSet[strings.ToLower(col)] {
+			extra = append(extra, col)
 		}
-		columnList += fmt.Sprintf(`"%s"`, col)
 	}
 
-	// 为每条记录构建 VALUES 子句
-	valuesClauses := make([]string, 0, len(batch))
-	args := make([]interface{}, 0, len(batch)*len(columns))
-	argIndex := 1
-
-	for _, row := range batch {
-		placeholders := ""
-		for i := 0; i < len(columns); i++ {
-			if i > 0 {
-				placeholders += ","
-			}
-			placeholders += fmt.Sprintf("$%d", argIndex)
-			// 确保字符串值是有效的 UTF-8
-			args = append(args, s.sanitizeValueForPostgres(row[columns[i]]))
-			argIndex++
-		}
-		valuesClauses = append(valuesClauses, "("+placeholders+")")
+	var parts []string
+	if len(missing) > 0 {
+		parts = append(parts, fmt.Sprintf("目标表缺少列 %s", strings.Join(missing, ", ")))
 	}
-
-	valuesClause := ""
-	for i, v := range valuesClauses {
-		if i > 0 {
-			valuesClause += ","
-		}
-		valuesClause += v
+	if len(extra) > 0 {
+		parts = append(parts, fmt.Sprintf("目标表多出列 %s", strings.Join(extra, ", ")))
 	}
-
-	sql := fmt.Sprintf(`INSERT INTO %s (%s) VALUES %s`, tableName, columnList, valuesClause)
-	_, err := targetDB.Exec(sql, args...)
-	return err
+	return strings.Join(parts, "；")
 }
 
-// syncBatchOracle 使用 Oracle 的 MERGE 语句
-func (s *SyncService) syncBatchOracle(targetDB *sql.DB, tableName string, batch []map[string]interface{}, columns []string, primaryKeys []string) error {
+// syncBatch 批量同步数据
+func (s *SyncService) syncBatch(targetDB dbconn.Executor, targetConn *models.DatabaseConnection, tableName string, batch []map[string]interface{}, primaryKeys []string) error {
 	if len(batch) == 0 {
 		return nil
 	}
 
-	// Oracle 使用 MERGE 语句
-	// 由于 Oracle 的 MERGE 语法较复杂，这里使用逐条处理的方式
-	for _, row := range batch {
-		// 构建主键条件
-		whereClause := ""
-		whereArgs := make([]interface{}, 0)
-		if len(primaryKeys) > 0 {
-			for i, pk := range primaryKeys {
-				if i > 0 {
-					whereClause += " AND "
-				}
-				whereClause += fmt.Sprintf(`"%s"=:pk%d`, pk, i+1)
-				whereArgs = append(whereArgs, row[pk])
-			}
-		}
-
-		// 检查记录是否存在
-		checkSQL := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", tableName, whereClause)
-		var count int
-		err := targetDB.QueryRow(checkSQL, whereArgs...).Scan(&count)
-		if err != nil {
-			return fmt.Errorf("检查记录是否存在失败: %v", err)
-		}
-
-		if count > 0 {
-			// 更新
-			setClause := ""
-			updateArgs := make([]interface{}, 0)
-			argIndex := 1
-			for i, col := range columns {
-				if i > 0 {
-					setClause += ","
-				}
-				setClause += fmt.Sprintf(`"%s"=:val%d`, col, argIndex)
-				updateArgs = append(updateArgs, row[col])
-				argIndex++
-			}
-			updateArgs = append(updateArgs, whereArgs...)
-
-			updateSQL := fmt.Sprintf("UPDATE %s SET %s WHERE %s", tableName, setClause, whereClause)
-			_, err = targetDB.Exec(updateSQL, updateArgs...)
-			if err != nil {
-				return fmt.Errorf("更新记录失败: %v", err)
-			}
-		} else {
-			// 插入
-			columnList := ""
-			placeholders := ""
-			insertArgs := make([]interface{}, 0)
-			argIndex := 1
-			for i, col := range columns {
-				if i > 0 {
-					columnList += ","
-					placeholders += ","
-				}
-				columnList += fmt.Sprintf(`"%s"`, col)
-				placeholders += fmt.Sprintf(":val%d", argIndex)
-				insertArgs = append(insertArgs, row[col])
-				argIndex++
-			}
-
-			insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, columnList, placeholders)
-			_, err = targetDB.Exec(insertSQL, insertArgs...)
-			if err != nil {
-				return fmt.Errorf("插入记录失败: %v", err)
-			}
-		}
-	}
-
-	return nil
-}
-
-// checkConflicts 检查数据冲突
-func (s *SyncService) checkConflicts(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, primaryKeys []string) error {
-	if len(primaryKeys) == 0 {
-		return nil // 没有主键，无法检测冲突
-	}
-
-	// 查询源数据库和目标数据库的所有数据
-	sourceRows, err := sourceDB.Query(fmt.Sprintf("SELECT * FROM %s", s.quoteIdentifier(tableName, sourceConn.Type)))
-	if err != nil {
-		return err
-	}
-	defer sourceRows.Close()
-
-	targetRows, err := targetDB.Query(fmt.Sprintf("SELECT * FROM %s", s.quoteIdentifier(tableName, targetConn.Type)))
-	if err != nil {
-		return err
+	// 获取所有列名（使用 map 的键，但需要保持顺序）
+	// 为了保持一致性，我们从第一条记录获取列名
+	columns := make([]string, 0, len(batch[0]))
+	columnMap := make(map[string]bool)
+	for col := range batch[0] {
+		columns = append(columns, col)
+		columnMap[col] = true
 	}
-	defer targetRows.Close()
-
-	// 构建主键条件SQL
-	sourceCols, _ := sourceRows.Columns()
-	targetCols, _ := targetRows.Columns()
 
-	// 将数据加载到内存进行比较（实际应用中应该使用更高效的方法）
-	sourceDataMap := make(map[string]map[string]interface{})
-	sourceRows2, _ := sourceDB.Query(fmt.Sprintf("SELECT * FROM %s", s.quoteIdentifier(tableName, sourceConn.Type)))
-	defer sourceRows2.Close()
-	for sourceRows2.Next() {
-		values := make([]interface{}, len(sourceCols))
-		valuePtrs := make([]interface{}, len(sourceCols))
-		for i := range values {
-			valuePtrs[i] = &values[i]
+	// 验证所有记录都有相同的列
+	for i, row := range batch {
+		if len(row) != len(columns) {
+			return fmt.Errorf("记录 %d 的列数与第一条记录不匹配", i)
 		}
-		sourceRows2.Scan(valuePtrs...)
-
-		rowData := make(map[string]interface{})
-		for i, col := range sourceCols {
-			val := values[i]
-			rowData[col] = s.normalizeValue(val)
+		for col := range row {
+			if !columnMap[col] {
+				return fmt.Errorf("记录 %d 包含未知列: %s", i, col)
+			}
 		}
-
-		// 构建主键字符串
-		pkValue := s.buildPrimaryKeyValue(rowData, primaryKeys)
-		sourceDataMap[pkValue] = rowData
 	}
 
-	// 比较目标数据库数据
-	targetRows2, _ := targetDB.Query(fmt.Sprintf("SELECT * FROM %s", s.quoteIdentifier(tableName, targetConn.Type)))
-	defer targetRows2.Close()
-	for targetRows2.Next() {
-		values := make([]interface{}, len(targetCols))
-		valuePtrs := make([]interface{}, len(targetCols))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-		targetRows2.Scan(valuePtrs...)
-
-		rowData := make(map[string]interface{})
-		for i, col := range targetCols {
-			val := values[i]
-			rowData[col] = s.normalizeValue(val)
-		}
-
-		pkValue := s.buildPrimaryKeyValue(rowData, primaryKeys)
-		sourceRow, exists := sourceDataMap[pkValue]
-
-		if exists {
-			// 比较数据是否一致
-			if !s.compareRows(sourceRow, rowData) {
-				// 发现冲突
-				if err := s.createConflict(task, tableName, pkValue, sourceRow, rowData, "update_conflict"); err != nil {
-					s.logError(task.ID, fmt.Sprintf("创建冲突记录失败: %v", err))
-				}
-			}
-			delete(sourceDataMap, pkValue)
+	// 按列顺序准备参数，确保字符串值是有效的 UTF-8
+	rows := make([][]interface{}, len(batch))
+	for i, row := range batch {
+		values := make([]interface{}, len(columns))
+		for j, col := range columns {
+			values[j] = s.sanitizeValueForPostgres(row[col])
 		}
+		rows[i] = values
 	}
 
-	return nil
+	// 根据数据库类型使用不同的 UPSERT 策略
+	return dbconn.DialectFor(targetConn.Type).Upsert(targetDB, tableName, columns, primaryKeys, rows)
 }
 
 // buildPrimaryKeyValue 构建主键值字符串
@@ -574,28 +389,13 @@ func (s *SyncService) buildPrimaryKeyValue(row map[string]interface{}, primaryKe
 	return string(data)
 }
 
-// compareRows 比较两行数据是否一致
-func (s *SyncService) compareRows(row1, row2 map[string]interface{}) bool {
-	if len(row1) != len(row2) {
-		return false
-	}
-
-	for k, v1 := range row1 {
-		v2, ok := row2[k]
-		if !ok {
-			return false
-		}
-		// 使用规范化比较，处理时间类型等特殊情况
-		if !s.valuesEqual(v1, v2) {
-			return false
-		}
-	}
-
-	return true
-}
-
 // valuesEqual 比较两个值是否相等，处理时间类型等特殊情况
 func (s *SyncService) valuesEqual(v1, v2 interface{}) bool {
+	return s.valuesEqualWithOptions(v1, v2, nil)
+}
+
+// valuesEqualWithOptions 按冲突检测选项比较两个值，支持数值和时间容差
+func (s *SyncService) valuesEqualWithOptions(v1, v2 interface{}, opts *ConflictOptions) bool {
 	// 如果都是 nil，相等
 	if v1 == nil && v2 == nil {
 		return true
@@ -611,6 +411,13 @@ func (s *SyncService) valuesEqual(v1, v2 interface{}) bool {
 
 	// 如果两个值都能解析为时间，则比较时间
 	if ok1 && ok2 {
+		if opts != nil && opts.TimeTolerance > 0 {
+			diff := t1.Sub(t2)
+			if diff < 0 {
+				diff = -diff
+			}
+			return diff <= opts.TimeTolerance
+		}
 		// 比较时间（忽略纳秒精度差异，只比较到秒）
 		return t1.Unix() == t2.Unix()
 	}
@@ -620,8 +427,19 @@ func (s *SyncService) valuesEqual(v1, v2 interface{}) bool {
 		return false
 	}
 
+	// 两个值都能解析为数值时按数值比较（如 int64 与 DECIMAL 字符串），整数精确比较，容差只用于浮点数和小数
+	if r1, int1, ok := s.parseNumber(v1); ok {
+		if r2, int2, ok := s.parseNumber(v2); ok {
+			tolerance := 0.0
+			if opts != nil {
+				tolerance = opts.NumericTolerance
+			}
+			return numbersEqual(r1, int1, r2, int2, tolerance)
+		}
+	}
+
 	// 对于其他类型，使用标准比较
-	return v1 == v2
+	return fmt.Sprint(v1) == fmt.Sprint(v2)
 }
 
 // parseTimeValue 尝试将值解析为时间类型
@@ -679,6 +497,7 @@ func (s *SyncService) createConflict(task *models.SyncTask, tableName, primaryKe
 
 	conflict := models.DataConflict{
 		TaskID:       task.ID,
+		TargetDBID:   task.TargetDBID,
 		TableName:    tableName,
 		PrimaryKey:   primaryKey,
 		SourceData:   string(sourceDataJSON),
@@ -691,176 +510,23 @@ func (s *SyncService) createConflict(task *models.SyncTask, tableName, primaryKe
 		return err
 	}
 
-	// 获取管理员邮箱并发送通知
-	var admins []models.User
-	database.DB.Where("role = ? AND status = ?", "admin", "active").Find(&admins)
+	DispatchWebhookEvent(WebhookEventConflictCreated, task.ID, conflictEventData(&conflict))
 
-	for _, admin := range admins {
-		token, err := GenerateConflictToken(conflict.ID, admin.ID, admin.Username)
-		if err != nil {
-			continue
-		}
-
-		if err := SendConflictNotification(admin.Email, conflict.ID, token, conflictType); err != nil {
-			s.logError(task.ID, fmt.Sprintf("发送冲突通知邮件失败: %v", err))
-		}
-	}
-
-	return nil
-}
-
-// ApplyConflictResolution 应用冲突解决方案
-func (s *SyncService) ApplyConflictResolution(conflict *models.DataConflict) error {
-	// 获取任务信息
-	var task models.SyncTask
-	if err := database.DB.First(&task, conflict.TaskID).Error; err != nil {
-		return err
-	}
-
-	// 获取数据库连接
-	var targetDB models.DatabaseConnection
-	database.DB.First(&targetDB, task.TargetDBID)
-
-	// 根据resolution决定使用哪个数据
-	var dataToApply string
-	if conflict.Resolution == "source" {
-		dataToApply = conflict.SourceData
-	} else {
-		dataToApply = conflict.TargetData
-	}
-
-	// 解析JSON数据
-	var rowData map[string]interface{}
-	if err := json.Unmarshal([]byte(dataToApply), &rowData); err != nil {
-		return err
-	}
-
-	// 解析主键
-	var primaryKey map[string]interface{}
-	if err := json.Unmarshal([]byte(conflict.PrimaryKey), &primaryKey); err != nil {
-		return err
-	}
-
-	// 应用数据到目标数据库
-	_, err := dbconn.GetConnection(&targetDB)
-	if err != nil {
-		return err
-	}
-
-	// TODO: 实现具体的更新/插入逻辑
-	// 这里简化处理，实际应该构建UPDATE或INSERT语句
-	_ = rowData
-	_ = primaryKey
+	// 按订阅发送通知（默认合并为摘要，避免逐行发送）
+	Notify(NotificationEvent{
+		Type:         EventConflict,
+		TaskID:       task.ID,
+		TaskName:     task.Name,
+		TableName:    tableName,
+		ConflictID:   conflict.ID,
+		ConflictType: conflictType,
+		PrimaryKey:   primaryKey,
+		Message:      fmt.Sprintf("任务 %s 表 %s 主键 %s 出现冲突（%s）", task.Name, tableName, primaryKey, conflictType),
+	})
 
 	return nil
 }
 
-// 辅助函数
-func (s *SyncService) getTables(db *sql.DB, dbType string) ([]string, error) {
-	var query string
-	switch dbType {
-	case "mysql":
-		query = "SHOW TABLES"
-	case "postgres":
-		// 使用 information_schema 更标准，兼容性更好
-		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_type = 'BASE TABLE' ORDER BY table_name"
-	case "oracle":
-		query = "SELECT table_name FROM user_tables"
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", dbType)
-	}
-
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var tables []string
-	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
-			continue
-		}
-		tables = append(tables, tableName)
-	}
-
-	return tables, nil
-}
-
-func (s *SyncService) getPrimaryKeys(db *sql.DB, dbType, tableName string) ([]string, error) {
-	var query string
-	switch dbType {
-	case "mysql":
-		// 使用 information_schema 查询主键，更标准
-		query = fmt.Sprintf(`SELECT column_name FROM information_schema.key_column_usage 
-			WHERE table_schema = DATABASE() AND table_name = '%s' 
-			AND constraint_name = 'PRIMARY'
-			ORDER BY ordinal_position`, tableName)
-	case "postgres":
-		// 使用 information_schema 查询主键，需要指定 schema
-		query = fmt.Sprintf(`SELECT column_name FROM information_schema.key_column_usage 
-			WHERE table_schema = 'public' AND table_name = '%s' 
-			AND constraint_name IN (
-				SELECT constraint_name FROM information_schema.table_constraints 
-				WHERE table_schema = 'public' AND table_name = '%s' AND constraint_type = 'PRIMARY KEY'
-			)
-			ORDER BY ordinal_position`, tableName, tableName)
-	case "oracle":
-		query = fmt.Sprintf("SELECT column_name FROM user_cons_columns WHERE constraint_name = (SELECT constraint_name FROM user_constraints WHERE table_name = '%s' AND constraint_type = 'P')", tableName)
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", dbType)
-	}
-
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var keys []string
-	for rows.Next() {
-		var key string
-		if err := rows.Scan(&key); err != nil {
-			continue
-		}
-		keys = append(keys, key)
-	}
-
-	return keys, nil
-}
-
-func (s *SyncService) tableExists(db *sql.DB, dbType, tableName string) (bool, error) {
-	var query string
-	switch dbType {
-	case "mysql":
-		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
-	case "postgres":
-		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = $1"
-	case "oracle":
-		query = "SELECT COUNT(*) FROM user_tables WHERE table_name = :1"
-	default:
-		return false, fmt.Errorf("unsupported database type: %s", dbType)
-	}
-
-	var count int
-	err := db.QueryRow(query, tableName).Scan(&count)
-	return count > 0, err
-}
-
-func (s *SyncService) quoteIdentifier(name, dbType string) string {
-	switch dbType {
-	case "mysql":
-		return fmt.Sprintf("`%s`", name)
-	case "postgres":
-		return fmt.Sprintf(`"%s"`, name)
-	case "oracle":
-		return fmt.Sprintf(`"%s"`, name)
-	default:
-		return name
-	}
-}
-
 func (s *SyncService) logInfo(taskID uint, message string) {
 	log := models.SyncLog{
 		TaskID:  taskID,
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// 批量装载
+//
+// 目标表为空（首次同步）且目标库支持批量装载协议时，不逐批执行 UPSERT，而是将源表数据
+// 以流的方式通过 COPY / LOAD DATA 一次装载到目标表。源表只读取一次，同时装载到所有符合条件的目标库。
+// 装载失败的目标库回退为按批同步。批量装载不检测冲突，装载完成后再次读取源表，为两端一致的行
+// 记录同步状态，使之后的同步能够识别目标端的修改；已有同步状态的目标表（如被清空）不使用批量装载。
+
+// bulkLoadBuffer 每个目标库待装载行的缓冲数
+const bulkLoadBuffer = 256
+
+// bulkTarget 一个正在批量装载的目标库
+type bulkTarget struct {
+	*syncTarget
+	loader dbconn.BulkLoader
+	rows   chan []interface{}
+	done   chan struct{}
+	err    error
+	loaded int64
+}
+
+// bulkLoadTargets 对目标表为空且没有行同步状态的目标库执行批量装载，返回仍需按批同步的目标库
+func (s *SyncService) bulkLoadTargets(sourceDB *sql.DB, sourceConn *models.DatabaseConnection, targets []*syncTarget, task *models.SyncTask, tableName string, primaryKeys []string) []*syncTarget {
+	if task.BulkLoadMode == "off" {
+		return targets
+	}
+
+	var bulk []*bulkTarget
+	rest := make([]*syncTarget, 0, len(targets))
+	for _, t := range targets {
+		d := dbconn.DialectFor(t.conn.Type)
+		loader, ok := d.(dbconn.BulkLoader)
+		if !ok {
+			rest = append(rest, t)
+			continue
+		}
+		empty, err := dbconn.TableEmpty(t.db, d, tableName)
+		if err != nil || !empty {
+			rest = append(rest, t)
+			continue
+		}
+		// 目标表曾经同步过（如被清空）时按批同步，由冲突检测处理目标端的删除
+		var states int64
+		if err := database.DB.Model(&models.SyncRowState{}).
+			Where("task_id = ? AND target_db_id = ? AND table_name = ?", t.task.ID, t.task.TargetDBID, tableName).
+			Count(&states).Error; err != nil || states > 0 {
+			rest = append(rest, t)
+			continue
+		}
+		bulk = append(bulk, &bulkTarget{syncTarget: t, loader: loader})
+	}
+	if len(bulk) == 0 {
+		return targets
+	}
+
+	if err := s.bulkLoad(sourceDB, sourceConn, bulk, task, tableName); err != nil {
+		s.logError(task.ID, fmt.Sprintf("表 %s 批量装载失败: %v", tableName, err))
+	}
+	var loaded []*syncTarget
+	for _, b := range bulk {
+		if b.err != nil {
+			s.logError(task.ID, fmt.Sprintf("目标库 %s 批量装载表 %s 失败，改为按批同步: %v", b.name(), tableName, b.err))
+			rest = append(rest, b.syncTarget)
+			continue
+		}
+		s.logInfo(task.ID, fmt.Sprintf("目标库 %s 批量装载表 %s 完成，共 %d 行", b.name(), tableName, b.loaded))
+		loaded = append(loaded, b.syncTarget)
+	}
+
+	if len(loaded) > 0 && len(primaryKeys) > 0 {
+		if err := s.recordBulkRowStates(sourceDB, sourceConn, loaded, task, tableName, primaryKeys); err != nil {
+			s.logError(task.ID, fmt.Sprintf("表 %s 批量装载后记录行同步状态失败: %v", tableName, err))
+		}
+	}
+	return rest
+}
+
+// recordBulkRowStates 批量装载完成后按批读取源表和各目标库中对应的行，为两端一致的行记录同步状态
+// 装载期间源表被修改的行两端不一致，不记录状态，下次同步时按首次同步以源数据为准
+func (s *SyncService) recordBulkRowStates(sourceDB *sql.DB, sourceConn *models.DatabaseConnection, targets []*syncTarget, task *models.SyncTask, tableName string, primaryKeys []string) error {
+	sourceDialect := dbconn.DialectFor(sourceConn.Type)
+	sourceRows, err := sourceDB.Query(fmt.Sprintf("SELECT * FROM %s", sourceDialect.QuoteIdentifier(tableName)))
+	if err != nil {
+		return fmt.Errorf("查询源表数据失败: %v", err)
+	}
+	defer sourceRows.Close()
+
+	columns, err := sourceRows.Columns()
+	if err != nil {
+		return err
+	}
+	typeNames := dbconn.ColumnTypeNames(sourceRows)
+
+	// 按主键查询目标库，参数个数为 行数 × 主键列数
+	targetDialects := make([]dbconn.Dialect, len(targets))
+	for i, t := range targets {
+		targetDialects[i] = dbconn.DialectFor(t.conn.Type)
+	}
+	batchSize := taskBatchSize(task, len(primaryKeys), targetDialects...)
+	opts := conflictOptionsFromTask(task)
+
+	flush := func(batch []map[string]interface{}) {
+		for _, t := range targets {
+			if err := s.recordMatchingRowStates(t, tableName, batch, primaryKeys, opts); err != nil {
+				s.logError(task.ID, fmt.Sprintf("目标库 %s 记录表 %s 的行同步状态失败: %v", t.name(), tableName, err))
+			}
+		}
+	}
+
+	batch := make([]map[string]interface{}, 0, batchSize)
+	for sourceRows.Next() {
+		rowData, err := s.scanRow(sourceRows, columns, typeNames, sourceDialect)
+		if err != nil {
+			return fmt.Errorf("读取源表数据失败: %v", err)
+		}
+		if batch = append(batch, rowData); len(batch) >= batchSize {
+			flush(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := sourceRows.Err(); err != nil {
+		return fmt.Errorf("读取源表数据失败: %v", err)
+	}
+	if len(batch) > 0 {
+		flush(batch)
+	}
+	return nil
+}
+
+// recordMatchingRowStates 查询目标库中一批源数据对应的行，为两端一致的行记录同步状态
+func (s *SyncService) recordMatchingRowStates(t *syncTarget, tableName string, batch []map[string]interface{}, primaryKeys []string, opts *ConflictOptions) error {
+	targetRows, err := s.fetchRowsByKeys(t.db, t.conn.Type, tableName, primaryKeys, batch)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	states := make([]models.SyncRowState, 0, len(batch))
+	for _, row := range batch {
+		pkValue := s.buildPrimaryKeyValue(row, primaryKeys)
+		targetRow, ok := targetRows[pkValue]
+		if !ok || !s.rowsEqual(row, targetRow, opts) {
+			continue
+		}
+		states = append(states, s.buildRowState(&t.task, tableName, pkValue, row, targetRow, opts, now))
+	}
+	return s.saveRowStates(states)
+}
+
+// bulkLoad 读取源表，将每行同时发送给各目标库的装载流；源表读取失败时所有装载都会失败
+func (s *SyncService) bulkLoad(sourceDB *sql.DB, sourceConn *models.DatabaseConnection, bulk []*bulkTarget, task *models.SyncTask, tableName string) error {
+	sourceDialect := dbconn.DialectFor(sourceConn.Type)
+	sourceRows, err := sourceDB.Query(fmt.Sprintf("SELECT * FROM %s", sourceDialect.QuoteIdentifier(tableName)))
+	if err != nil {
+		for _, b := range bulk {
+			b.err = err
+		}
+		return fmt.Errorf("查询源表数据失败: %v", err)
+	}
+	defer sourceRows.Close()
+
+	columns, err := sourceRows.Columns()
+	if err != nil {
+		for _, b := range bulk {
+			b.err = err
+		}
+		return err
+	}
+	typeNames := dbconn.ColumnTypeNames(sourceRows)
+
+	// 源表读取或转换出错时通过 next 返回错误，使装载中止
+	var sourceErr error
+	var wg sync.WaitGroup
+	for _, b := range bulk {
+		b.rows = make(chan []interface{}, bulkLoadBuffer)
+		b.done = make(chan struct{})
+		wg.Add(1)
+		go func(b *bulkTarget) {
+			defer wg.Done()
+			defer close(b.done)
+			b.loaded, b.err = s.runBulkLoader(b, task, tableName, columns, func() ([]interface{}, error) {
+				row, ok := <-b.rows
+				if !ok {
+					return nil, sourceErr
+				}
+				return row, nil
+			})
+		}(b)
+	}
+
+	// 所有装载都结束（失败）后不再读取；配置了限速时按批限速
+	limiter := newThrottle(task)
+	throttled := make([]map[string]interface{}, 0, defaultBatchSize)
+	loading := append([]*bulkTarget{}, bulk...)
+	var scanErr error
+	for len(loading) > 0 && sourceRows.Next() {
+		rowData, err := s.scanRow(sourceRows, columns, typeNames, sourceDialect)
+		if err != nil {
+			scanErr = err
+			break
+		}
+		if limiter != nil {
+			if throttled = append(throttled, rowData); len(throttled) >= defaultBatchSize {
+				limiter.wait(throttled, 0)
+				throttled = throttled[:0]
+			}
+		}
+		values := make([]interface{}, len(columns))
+		for i, col := range columns {
+			values[i] = s.sanitizeValueForPostgres(rowData[col])
+		}
+
+		remaining := loading[:0]
+		for _, b := range loading {
+			select {
+			case b.rows <- values:
+				remaining = append(remaining, b)
+			case <-b.done:
+			}
+		}
+		loading = remaining
+	}
+	sourceErr = sourceRows.Err()
+	if sourceErr == nil {
+		sourceErr = scanErr
+	}
+	if sourceErr != nil {
+		sourceErr = fmt.Errorf("读取源表数据失败: %v", sourceErr)
+	}
+
+	for _, b := range bulk {
+		close(b.rows)
+	}
+	wg.Wait()
+	return sourceErr
+}
+
+// runBulkLoader 在一个目标库连接上执行装载，按任务配置在装载前后删除、重建二级索引
+func (s *SyncService) runBulkLoader(b *bulkTarget, task *models.SyncTask, tableName string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	conn, err := b.db.Conn(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if task.BulkLoadDisableIndexes {
+		restore, err := b.loader.DisableIndexes(conn, tableName)
+		if err != nil {
+			s.logInfo(task.ID, fmt.Sprintf("目标库 %s 表 %s 装载前禁用索引失败，保留索引装载: %v", b.name(), tableName, err))
+		} else {
+			defer func() {
+				if err := restore(); err != nil {
+					s.failTable(b.syncTarget, tableName, fmt.Errorf("装载后重建索引失败: %v", err))
+				}
+			}()
+		}
+	}
+
+	return b.loader.BulkLoad(conn, tableName, columns, next)
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// bulkSQLiteDialect 支持批量装载的 SQLite 方言，装载时逐行插入，记录装载次数
+type bulkSQLiteDialect struct {
+	dbconn.Dialect
+}
+
+var (
+	registerBulkSQLite sync.Once
+	bulkLoads          atomic.Int64
+)
+
+func (bulkSQLiteDialect) Name() string { return "sqlite_bulk" }
+
+func (d bulkSQLiteDialect) BulkLoad(conn *sql.Conn, table string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	bulkLoads.Add(1)
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = d.QuoteIdentifier(col)
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", d.QuoteIdentifier(table), strings.Join(quoted, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+
+	var loaded int64
+	for {
+		row, err := next()
+		if err != nil || row == nil {
+			return loaded, err
+		}
+		if _, err := conn.ExecContext(context.Background(), stmt, row...); err != nil {
+			return loaded, err
+		}
+		loaded++
+	}
+}
+
+func (bulkSQLiteDialect) DisableIndexes(conn *sql.Conn, table string) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+// useBulkTarget 将目标库改为支持批量装载的 SQLite 连接
+func (e *testEnv) useBulkTarget() {
+	e.t.Helper()
+	registerBulkSQLite.Do(func() {
+		dbconn.RegisterDialect(bulkSQLiteDialect{dbconn.DialectFor("sqlite")})
+	})
+	bulkLoads.Store(0)
+	e.targetConn.Type = "sqlite_bulk"
+	if err := database.DB.Save(&e.targetConn).Error; err != nil {
+		e.t.Fatalf("更新目标库连接失败: %v", err)
+	}
+}
+
+func TestBulkLoadRecordsRowStates(t *testing.T) {
+	e := newTestEnv(t, "")
+	e.useBulkTarget()
+	e.insertItem(e.source, 1, item{Name: "a"})
+	e.insertItem(e.source, 2, item{Name: "b"})
+	task := e.newTask(twoWay)
+	e.sync(task)
+
+	if n := bulkLoads.Load(); n != 1 {
+		t.Fatalf("bulk loads = %d, want 1", n)
+	}
+	var states int64
+	database.DB.Model(&models.SyncRowState{}).Where("task_id = ? AND target_db_id = ?", task.ID, e.targetConn.ID).Count(&states)
+	if states != 2 {
+		t.Fatalf("批量装载后记录了 %d 条行同步状态, want 2", states)
+	}
+
+	// 装载后目标端的修改在增量同步时写回源库，而不是被源数据覆盖
+	e.exec(e.target, "UPDATE items SET name = 'target' WHERE id = 1")
+	e.sync(task)
+
+	if n := bulkLoads.Load(); n != 1 {
+		t.Errorf("增量同步不应再次批量装载, bulk loads = %d", n)
+	}
+	if got := e.mustItem(e.target, 1).Name; got != "target" {
+		t.Errorf("目标端的修改被覆盖，目标值为 %q", got)
+	}
+	if got := e.mustItem(e.source, 1).Name; got != "target" {
+		t.Errorf("源行 1 = %q, want target", got)
+	}
+	if conflicts := e.conflicts(task); len(conflicts) != 0 {
+		t.Errorf("conflicts = %+v", conflicts)
+	}
+}
+
+func TestBulkLoadSkipsTargetWithRowStates(t *testing.T) {
+	e := newTestEnv(t, "")
+	e.useBulkTarget()
+	e.insertItem(e.source, 1, item{Name: "a"})
+	e.insertItem(e.source, 2, item{Name: "b"})
+	task := e.newTask(twoWay)
+	e.sync(task)
+
+	// 已同步过的目标表被清空：按批同步，将删除写回源库而不是重新装载
+	e.exec(e.target, "DELETE FROM items")
+	e.sync(task)
+
+	if n := bulkLoads.Load(); n != 1 {
+		t.Errorf("bulk loads = %d, want 1", n)
+	}
+	for id := 1; id <= 2; id++ {
+		if _, ok := e.getItem(e.source, id); ok {
+			t.Errorf("源行 %d 应被删除", id)
+		}
+		if _, ok := e.getItem(e.target, id); ok {
+			t.Errorf("目标行 %d 不应被重新装载", id)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// syncTarget 一次同步运行中的一个目标库
+// 源数据只读取一次，每批数据并发写入各目标库；各目标库独立检测冲突、重试和记录状态，
+// 某个目标库失败只影响它自己
+type syncTarget struct {
+	record    models.SyncTaskTarget
+	conn      models.DatabaseConnection
+	db        *sql.DB
+	task      models.SyncTask     // 任务副本，TargetDBID 为该目标库，冲突和行同步状态按目标库区分
+	cache     *dbconn.UpsertCache // 本次运行写入该目标库时复用的表元数据
+	tableErr  error               // 当前表的写入错误，出错后本表不再写入该目标库
+	writeBack *pendingChanges     // 双向同步时当前表需要写回源库的变更
+	errs      []string            // 本次运行的错误信息
+}
+
+// active 目标库是否可以继续写入当前表
+func (t *syncTarget) active() bool {
+	return t.db != nil && t.tableErr == nil
+}
+
+// name 目标库名称，用于日志
+func (t *syncTarget) name() string {
+	if t.conn.Name != "" {
+		return t.conn.Name
+	}
+	return fmt.Sprintf("#%d", t.record.TargetDBID)
+}
+
+// openTargets 加载任务的目标库并建立连接，连接失败的目标库记录错误后跳过
+func (s *SyncService) openTargets(task *models.SyncTask) ([]*syncTarget, error) {
+	var records []models.SyncTaskTarget
+	if err := database.DB.Where("task_id = ?", task.ID).Order("id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询目标数据库失败: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("同步任务没有目标数据库")
+	}
+	if isTwoWay(task) && len(records) > 1 {
+		return nil, fmt.Errorf("双向同步只支持一个目标数据库")
+	}
+
+	targets := make([]*syncTarget, 0, len(records))
+	for _, record := range records {
+		t := &syncTarget{record: record, task: *task, cache: dbconn.NewUpsertCache()}
+		t.task.TargetDBID = record.TargetDBID
+		targets = append(targets, t)
+
+		database.DB.Model(&t.record).Updates(map[string]interface{}{"status": "running", "last_error": ""})
+
+		if err := database.DB.First(&t.conn, record.TargetDBID).Error; err != nil {
+			t.errs = append(t.errs, fmt.Sprintf("目标数据库连接不存在: %v", err))
+			continue
+		}
+		db, err := dbconn.GetRawConnection(&t.conn)
+		if err != nil {
+			t.errs = append(t.errs, fmt.Sprintf("获取目标数据库原生连接失败: %v", err))
+			continue
+		}
+		if err := db.Ping(); err != nil {
+			dbconn.ReleaseConnection(db)
+			t.errs = append(t.errs, fmt.Sprintf("目标数据库连接不可用: %v", err))
+			continue
+		}
+		t.db = db
+	}
+	return targets, nil
+}
+
+// finishTargets 释放目标库连接并保存各目标库的同步结果，有目标库失败时返回汇总错误
+func (s *SyncService) finishTargets(targets []*syncTarget) error {
+	now := time.Now()
+	var failed []string
+	for _, t := range targets {
+		if t.db != nil {
+			dbconn.ReleaseConnection(t.db)
+		}
+
+		status := "success"
+		lastError := strings.Join(t.errs, "；")
+		if len(t.errs) > 0 {
+			status = "error"
+			failed = append(failed, fmt.Sprintf("目标库 %s: %s", t.name(), lastError))
+		}
+		database.DB.Model(&t.record).Updates(map[string]interface{}{"status": status, "last_error": lastError, "last_sync_at": now})
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d/%d 个目标库同步失败: %s", len(failed), len(targets), strings.Join(failed, "；"))
+	}
+	return nil
+}
+
+// failTable 记录目标库当前表同步失败，本表剩余数据不再写入该目标库
+func (s *SyncService) failTable(t *syncTarget, tableName string, err error) {
+	t.tableErr = err
+	t.errs = append(t.errs, fmt.Sprintf("表 %s: %v", tableName, err))
+	s.logError(t.task.ID, fmt.Sprintf("目标库 %s 同步表 %s 失败: %v", t.name(), tableName, err))
+}
+
+// writeBatchToTargets 将一批源数据并发写入各目标库
+func (s *SyncService) writeBatchToTargets(targets []*syncTarget, tableName string, batch []map[string]interface{}, primaryKeys []string, opts *ConflictOptions) {
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		if !t.active() {
+			continue
+		}
+		wg.Add(1)
+		go func(t *syncTarget) {
+			defer wg.Done()
+			if err := s.processBatch(t.db, &t.conn, &t.task, tableName, batch, primaryKeys, opts, t.writeBack, t.cache); err != nil {
+				s.failTable(t, tableName, fmt.Errorf("批量同步失败: %v", err))
+			}
+		}(t)
+	}
+	wg.Wait()
+}
+
+// anyActive 是否还有可以写入当前表的目标库
+func anyActive(targets []*syncTarget) bool {
+	for _, t := range targets {
+		if t.active() {
+			return true
+		}
+	}
+	return false
+}
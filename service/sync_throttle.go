@@ -0,0 +1,152 @@
+package service
+
+import (
+	"time"
+
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// defaultBatchSize 每批读取和写入的默认行数
+const defaultBatchSize = 100
+
+const (
+	// adaptiveMaxFactor 自适应模式的最大降速倍数
+	adaptiveMaxFactor = 16
+	// adaptiveSlowRatio 写入延迟超过基线的该倍数时降速
+	adaptiveSlowRatio = 2.0
+	// adaptiveRecoverRatio 写入延迟回落到基线的该倍数以内时恢复速度
+	adaptiveRecoverRatio = 1.2
+)
+
+// taskBatchSize 任务的每批行数：按任务配置（未配置时使用默认值），
+// 并保证 行数 × 列数 不超过各写入端数据库单条语句的参数上限
+func taskBatchSize(task *models.SyncTask, columns int, dialects ...dbconn.Dialect) int {
+	size := task.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	if columns <= 0 {
+		return size
+	}
+	for _, d := range dialects {
+		if limit := d.MaxParams(); limit > 0 {
+			size = min(size, limit/columns)
+		}
+	}
+	return max(size, 1)
+}
+
+// throttle 同步限速
+//
+// 按任务配置的每秒行数、每秒字节数限制同步速度：每批写入后，如果已同步的数据量超过
+// 按限速计算的允许量，则等待到允许的时间点。
+// 自适应模式下记录每批写入目标库的延迟，延迟明显高于基线（运行中观察到的最低延迟）时
+// 成倍降低速度，延迟回落后逐步恢复；未配置限速时，通过在批次之间插入等待降低目标库负载
+type throttle struct {
+	rowsPerSecond  float64
+	bytesPerSecond float64
+	adaptive       bool
+
+	start time.Time
+	due   time.Duration // 按限速计算，已同步的数据最早应在开始后多久完成
+
+	latency  time.Duration // 写入延迟的指数移动平均
+	baseline time.Duration // 最低的平均写入延迟
+	factor   float64       // 当前降速倍数，1 表示不降速
+}
+
+// newThrottle 根据任务配置创建限速器，未配置限速且未开启自适应时返回 nil
+func newThrottle(task *models.SyncTask) *throttle {
+	if task.MaxRowsPerSecond <= 0 && task.MaxBytesPerSecond <= 0 && !task.AdaptiveThrottle {
+		return nil
+	}
+	return &throttle{
+		rowsPerSecond:  float64(task.MaxRowsPerSecond),
+		bytesPerSecond: float64(task.MaxBytesPerSecond),
+		adaptive:       task.AdaptiveThrottle,
+		start:          time.Now(),
+		factor:         1,
+	}
+}
+
+// wait 记录一批已同步的数据及其写入耗时，需要限速时阻塞到允许继续的时间点
+func (t *throttle) wait(batch []map[string]interface{}, writeLatency time.Duration) {
+	if t == nil {
+		return
+	}
+	if t.adaptive {
+		t.observe(writeLatency)
+	}
+
+	if t.rowsPerSecond <= 0 && t.bytesPerSecond <= 0 {
+		// 只开启自适应时，降速后在每批之后等待，使目标库的写入时间占比降为 1/factor
+		if t.factor > 1 {
+			time.Sleep(time.Duration(float64(writeLatency) * (t.factor - 1)))
+		}
+		return
+	}
+
+	// 按限速计算同步这批数据需要的时间
+	var cost time.Duration
+	if t.rowsPerSecond > 0 {
+		cost = max(cost, time.Duration(float64(len(batch))/t.rowsPerSecond*float64(time.Second)))
+	}
+	if t.bytesPerSecond > 0 {
+		bytes := 0
+		for _, row := range batch {
+			bytes += estimateRowBytes(row)
+		}
+		cost = max(cost, time.Duration(float64(bytes)/t.bytesPerSecond*float64(time.Second)))
+	}
+
+	// 之前低于限速的时间不累积，避免之后突发写入
+	elapsed := time.Since(t.start)
+	t.due = max(t.due, elapsed) + time.Duration(float64(cost)*t.factor)
+	if delay := t.due - elapsed; delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// observe 根据本批写入延迟调整降速倍数
+func (t *throttle) observe(latency time.Duration) {
+	if t.latency == 0 {
+		t.latency = latency
+	} else {
+		t.latency = (t.latency*7 + latency*3) / 10
+	}
+	if t.baseline == 0 || t.latency < t.baseline {
+		t.baseline = t.latency
+	}
+	if t.baseline <= 0 {
+		return
+	}
+
+	ratio := float64(t.latency) / float64(t.baseline)
+	switch {
+	case ratio > adaptiveSlowRatio:
+		t.factor = min(t.factor*2, adaptiveMaxFactor)
+	case ratio < adaptiveRecoverRatio:
+		t.factor = max(t.factor/2, 1)
+	}
+}
+
+// estimateRowBytes 估算一行数据的字节数
+func estimateRowBytes(row map[string]interface{}) int {
+	size := 0
+	for col, val := range row {
+		size += len(col)
+		switch v := val.(type) {
+		case nil:
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		case bool:
+			size++
+		default:
+			size += 8
+		}
+	}
+	return size
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+func TestTaskBatchSize(t *testing.T) {
+	sqlserver, postgres := dbconn.DialectFor("sqlserver"), dbconn.DialectFor("postgres")
+	tests := []struct {
+		name      string
+		batchSize int
+		columns   int
+		dialects  []dbconn.Dialect
+		want      int
+	}{
+		{"默认值", 0, 10, nil, defaultBatchSize},
+		{"任务配置", 5000, 10, nil, 5000},
+		{"列数未知", 5000, 0, []dbconn.Dialect{sqlserver}, 5000},
+		{"按参数上限截断", 10000, 10, []dbconn.Dialect{postgres}, 6553},
+		{"取各端上限的最小值", 5000, 10, []dbconn.Dialect{postgres, sqlserver}, 200},
+		{"不超过任务配置", 50, 10, []dbconn.Dialect{sqlserver}, 50},
+		{"列数超过上限时每批一行", 5000, 3000, []dbconn.Dialect{sqlserver}, 1},
+		{"未知数据库不限制", 5000, 10, []dbconn.Dialect{dbconn.DialectFor("unknown")}, 5000},
+	}
+	for _, tt := range tests {
+		task := &models.SyncTask{BatchSize: tt.batchSize}
+		if got := taskBatchSize(task, tt.columns, tt.dialects...); got != tt.want {
+			t.Errorf("%s: taskBatchSize = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewThrottle(t *testing.T) {
+	if th := newThrottle(&models.SyncTask{}); th != nil {
+		t.Errorf("未配置限速时 throttle = %+v, want nil", th)
+	}
+	// nil 限速器不等待
+	var th *throttle
+	th.wait([]map[string]interface{}{{"id": 1}}, time.Second)
+
+	th = newThrottle(&models.SyncTask{MaxRowsPerSecond: 100, AdaptiveThrottle: true})
+	if th == nil || th.rowsPerSecond != 100 || !th.adaptive || th.factor != 1 {
+		t.Errorf("throttle = %+v", th)
+	}
+}
+
+func TestThrottleLimitsRows(t *testing.T) {
+	th := newThrottle(&models.SyncTask{MaxRowsPerSecond: 1000})
+	batch := make([]map[string]interface{}, 50)
+
+	start := time.Now()
+	th.wait(batch, 0)
+	th.wait(batch, 0)
+	// 100 行按每秒 1000 行至少需要 100ms
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("限速后耗时 %v, want >= 100ms", elapsed)
+	}
+}
+
+func TestThrottleDoesNotAccumulateIdleTime(t *testing.T) {
+	th := newThrottle(&models.SyncTask{MaxRowsPerSecond: 1000})
+	// 开始后空闲了 1 秒，之后的批次仍按限速等待
+	th.start = time.Now().Add(-time.Second)
+
+	start := time.Now()
+	th.wait(make([]map[string]interface{}, 50), 0)
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("空闲后第一批耗时 %v, want >= 50ms", elapsed)
+	}
+}
+
+func TestThrottleLimitsBytes(t *testing.T) {
+	row := map[string]interface{}{"name": "abcdefgh", "data": []byte("12345678"), "qty": int64(1), "ok": true, "nil": nil}
+	// 列名 4+4+3+2+3，值 8+8+8+1
+	if got := estimateRowBytes(row); got != 41 {
+		t.Fatalf("estimateRowBytes = %d, want 41", got)
+	}
+
+	th := newThrottle(&models.SyncTask{MaxBytesPerSecond: 41 * 20})
+	start := time.Now()
+	th.wait([]map[string]interface{}{row}, 0)
+	// 一行按每秒 20 行的字节数需要 50ms
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("限速后耗时 %v, want >= 50ms", elapsed)
+	}
+}
+
+func TestThrottleAdaptiveFactor(t *testing.T) {
+	th := newThrottle(&models.SyncTask{AdaptiveThrottle: true})
+
+	th.observe(10 * time.Millisecond)
+	if th.factor != 1 || th.baseline != 10*time.Millisecond {
+		t.Fatalf("首批后 factor = %v, baseline = %v", th.factor, th.baseline)
+	}
+	// 延迟持续高于基线两倍时成倍降速，最多降到 adaptiveMaxFactor
+	for i := 0; i < 20; i++ {
+		th.observe(time.Second)
+	}
+	if th.factor != adaptiveMaxFactor {
+		t.Errorf("持续高延迟后 factor = %v, want %v", th.factor, adaptiveMaxFactor)
+	}
+	// 延迟回落后逐步恢复
+	for i := 0; i < 50; i++ {
+		th.observe(10 * time.Millisecond)
+	}
+	if th.factor != 1 {
+		t.Errorf("延迟回落后 factor = %v, want 1", th.factor)
+	}
+}
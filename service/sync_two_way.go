@@ -0,0 +1,209 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// 双向同步
+//
+// 每次运行先执行正向阶段（源→目标，见 syncSingleTable），再执行反向阶段（目标→源）。
+// 两个阶段共用 SyncRowState 中记录的上次同步后两端的行哈希：
+//   - 只有一端相对上次同步发生变化的行，由变化的一端写入另一端（包括删除）
+//   - 两端都发生变化的行视为冲突，按任务的冲突解决策略处理或记录为待处理冲突
+//   - 每次写入后按两端当前数据刷新行状态，被复制过去的变更在对端的哈希与状态一致，
+//     不会在下一阶段或下次运行时被当作新的变更再复制回来（防止回环）
+
+// isTwoWay 任务是否为双向同步
+func isTwoWay(task *models.SyncTask) bool {
+	return task.Direction == "two_way"
+}
+
+// pendingChanges 需要写入正在读取的一端的变更，在读取结束后统一执行，避免边读边写同一张表
+type pendingChanges struct {
+	writes  []map[string]interface{}
+	deletes []map[string]interface{}
+}
+
+func (p *pendingChanges) add(writes, deletes []map[string]interface{}) {
+	p.writes = append(p.writes, writes...)
+	p.deletes = append(p.deletes, deletes...)
+}
+
+// applyPendingChanges 将变更写入源库（toSource 为 true）或目标库，并刷新相关行的同步状态
+// 刷新状态需要查询两端，调用时两端都不能有未关闭的结果集，否则连接数较少的连接池（如SQLite）会阻塞
+func (s *SyncService) applyPendingChanges(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, primaryKeys []string, opts *ConflictOptions, changes *pendingChanges, toSource bool) error {
+	db, conn := targetDB, targetConn
+	if toSource {
+		db, conn = sourceDB, sourceConn
+	}
+	if err := s.writePendingChanges(db, conn, task, tableName, primaryKeys, changes); err != nil {
+		return err
+	}
+	s.refreshPendingStates(sourceDB, targetDB, sourceConn, targetConn, task, tableName, primaryKeys, opts, changes)
+	return nil
+}
+
+// writePendingChanges 将变更写入 db，不刷新同步状态
+func (s *SyncService) writePendingChanges(db *sql.DB, conn *models.DatabaseConnection, task *models.SyncTask, tableName string, primaryKeys []string, changes *pendingChanges) error {
+	columns := 0
+	if len(changes.writes) > 0 {
+		columns = len(changes.writes[0])
+	}
+	batchSize := taskBatchSize(task, columns, dbconn.DialectFor(conn.Type))
+	for start := 0; start < len(changes.writes); start += batchSize {
+		end := min(start+batchSize, len(changes.writes))
+		if err := s.syncBatch(db, conn, tableName, changes.writes[start:end], primaryKeys); err != nil {
+			return err
+		}
+	}
+	for _, row := range changes.deletes {
+		if err := s.deleteRowByKey(db, conn.Type, tableName, primaryKeys, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshPendingStates 按两端当前数据刷新变更行的同步状态
+func (s *SyncService) refreshPendingStates(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, primaryKeys []string, opts *ConflictOptions, changes *pendingChanges) {
+	rows := append(append([]map[string]interface{}{}, changes.writes...), changes.deletes...)
+	// 刷新状态时按主键查询两端，参数个数为 行数 × 主键列数
+	stateBatchSize := taskBatchSize(task, len(primaryKeys), dbconn.DialectFor(sourceConn.Type), dbconn.DialectFor(targetConn.Type))
+	for start := 0; start < len(rows); start += stateBatchSize {
+		end := min(start+stateBatchSize, len(rows))
+		if err := s.refreshRowStates(sourceDB, targetDB, sourceConn, targetConn, task, tableName, primaryKeys, rows[start:end], opts); err != nil {
+			s.logError(task.ID, fmt.Sprintf("刷新行同步状态失败: %v", err))
+		}
+	}
+}
+
+// syncReverse 双向同步的反向阶段：读取目标表，将目标端自上次同步以来的变更同步到源库
+func (s *SyncService) syncReverse(sourceDB, targetDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, primaryKeys []string, opts *ConflictOptions, limiter *throttle) error {
+	targetDialect := dbconn.DialectFor(targetConn.Type)
+	targetRows, err := targetDB.Query(fmt.Sprintf("SELECT * FROM %s", targetDialect.QuoteIdentifier(tableName)))
+	if err != nil {
+		return fmt.Errorf("查询目标表数据失败: %v", err)
+	}
+	defer targetRows.Close()
+
+	columns, err := targetRows.Columns()
+	if err != nil {
+		return err
+	}
+	typeNames := dbconn.ColumnTypeNames(targetRows)
+
+	// 读取目标表期间不再查询目标库：写回源库的行在读取结束后再刷新同步状态，源端已删除的行在读取结束后再删除
+	batchSize := taskBatchSize(task, len(columns), dbconn.DialectFor(sourceConn.Type))
+	batch := make([]map[string]interface{}, 0, batchSize)
+	written := &pendingChanges{}
+	targetDeletes := &pendingChanges{}
+	for targetRows.Next() {
+		rowData, err := s.scanRow(targetRows, columns, typeNames, targetDialect)
+		if err != nil {
+			return fmt.Errorf("读取目标表数据失败: %v", err)
+		}
+
+		batch = append(batch, rowData)
+
+		if len(batch) >= batchSize {
+			started := time.Now()
+			if err := s.processReverseBatch(sourceDB, sourceConn, targetConn, task, tableName, batch, primaryKeys, opts, written, targetDeletes); err != nil {
+				s.logError(task.ID, fmt.Sprintf("反向批量同步失败: %v", err))
+			}
+			limiter.wait(batch, time.Since(started))
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := s.processReverseBatch(sourceDB, sourceConn, targetConn, task, tableName, batch, primaryKeys, opts, written, targetDeletes); err != nil {
+			return err
+		}
+	}
+
+	targetRows.Close()
+	if err := targetRows.Err(); err != nil {
+		return fmt.Errorf("读取目标表数据失败: %v", err)
+	}
+	s.refreshPendingStates(sourceDB, targetDB, sourceConn, targetConn, task, tableName, primaryKeys, opts, written)
+	if err := s.applyPendingChanges(sourceDB, targetDB, sourceConn, targetConn, task, tableName, primaryKeys, opts, targetDeletes, false); err != nil {
+		return fmt.Errorf("删除目标行失败: %v", err)
+	}
+	return nil
+}
+
+// processReverseBatch 对比上次同步后的行状态，将一批目标行中只在目标端变化的行写回源库，写回的行加入 written 待刷新同步状态
+// 两端都存在且都发生变化的冲突已在正向阶段处理，这里只处理源端已删除的行：
+// 目标端未变化时同步删除目标行，目标端也有修改时视为删除冲突
+func (s *SyncService) processReverseBatch(sourceDB *sql.DB, sourceConn, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, batch []map[string]interface{}, primaryKeys []string, opts *ConflictOptions, written, targetDeletes *pendingChanges) error {
+	sourceRows, err := s.fetchRowsByKeys(sourceDB, sourceConn.Type, tableName, primaryKeys, batch)
+	if err != nil {
+		return fmt.Errorf("查询源表数据失败: %v", err)
+	}
+
+	states, err := s.loadRowStates(task, tableName, primaryKeys, batch)
+	if err != nil {
+		return fmt.Errorf("查询行同步状态失败: %v", err)
+	}
+
+	writeBack := &pendingChanges{}
+	for _, row := range batch {
+		pkValue := s.buildPrimaryKeyValue(row, primaryKeys)
+		sourceRow, sourceExists := sourceRows[pkValue]
+		state, hasState := states[pkValue]
+		if !hasState {
+			// 只存在于目标端的新行写回源库；两端都存在的行首次同步时以源数据为准，已在正向阶段处理
+			if !sourceExists {
+				writeBack.writes = append(writeBack.writes, row)
+			}
+			continue
+		}
+
+		targetChanged := s.fingerprintRow(row, opts).Hash != state.TargetHash
+		// 源行不存在时按空行计算指纹，与按策略保留删除后记录的空状态一致
+		sourceChanged := s.fingerprintRow(sourceRow, opts).Hash != state.SourceHash
+
+		switch {
+		case !targetChanged && !sourceChanged:
+			continue
+		case sourceExists || !sourceChanged:
+			if !sourceChanged {
+				writeBack.writes = append(writeBack.writes, row)
+			}
+		case !targetChanged:
+			targetDeletes.deletes = append(targetDeletes.deletes, row)
+		default:
+			outcome, policyErr := s.applyConflictPolicy(task, state, nil, row, opts)
+			if policyErr == nil {
+				if err := s.createAutoResolvedConflict(task, tableName, pkValue, nil, row, "delete_conflict", outcome); err != nil {
+					s.logError(task.ID, fmt.Sprintf("记录自动解决的冲突失败: %v", err))
+				}
+				if outcome.write {
+					// 以源端的删除为准
+					targetDeletes.deletes = append(targetDeletes.deletes, row)
+				} else {
+					writeBack.writes = append(writeBack.writes, outcome.row)
+				}
+				continue
+			}
+			if task.ConflictPolicy != "" && task.ConflictPolicy != PolicyManual {
+				s.logInfo(task.ID, fmt.Sprintf("表 %s 主键 %s 的冲突无法自动解决: %v", tableName, pkValue, policyErr))
+			}
+
+			if err := s.recordDetectedConflict(task, tableName, pkValue, nil, row, "delete_conflict"); err != nil {
+				s.logError(task.ID, fmt.Sprintf("创建冲突记录失败: %v", err))
+			}
+		}
+	}
+
+	if err := s.writePendingChanges(sourceDB, sourceConn, task, tableName, primaryKeys, writeBack); err != nil {
+		return err
+	}
+	written.add(writeBack.writes, nil)
+	return nil
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"testing"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+)
+
+// twoWay 双向同步，每批一行，使读取过程中也会处理批次
+func twoWay(task *models.SyncTask) {
+	task.Direction = "two_way"
+	task.BatchSize = 1
+}
+
+func TestTwoWaySyncWritesTargetChangesBack(t *testing.T) {
+	e := newTestEnv(t, "")
+	e.insertItem(e.source, 1, item{Name: "a"})
+	e.insertItem(e.source, 2, item{Name: "b"})
+	e.insertItem(e.source, 3, item{Name: "c"})
+	task := e.newTask(twoWay)
+	e.sync(task)
+
+	e.exec(e.target, "UPDATE items SET name = 'target' WHERE id = 1")
+	e.exec(e.target, "DELETE FROM items WHERE id = 2")
+	e.exec(e.source, "DELETE FROM items WHERE id = 3")
+	e.insertItem(e.target, 4, item{Name: "new"})
+	e.sync(task)
+
+	if got := e.mustItem(e.source, 1).Name; got != "target" {
+		t.Errorf("源行 1 = %q, want target", got)
+	}
+	if _, ok := e.getItem(e.source, 2); ok {
+		t.Error("目标端删除的行应从源库删除")
+	}
+	if _, ok := e.getItem(e.target, 3); ok {
+		t.Error("源端删除的行应从目标库删除")
+	}
+	if got := e.mustItem(e.source, 4).Name; got != "new" {
+		t.Errorf("源行 4 = %q, want new", got)
+	}
+	if conflicts := e.conflicts(task); len(conflicts) != 0 {
+		t.Errorf("只有一端变化不应产生冲突: %+v", conflicts)
+	}
+}
+
+func TestTwoWaySyncDoesNotLoop(t *testing.T) {
+	e := newTestEnv(t, "")
+	e.insertItem(e.source, 1, item{Name: "a"})
+	e.insertItem(e.source, 2, item{Name: "b"})
+	task := e.newTask(twoWay)
+	e.sync(task)
+
+	e.exec(e.target, "UPDATE items SET name = 'target' WHERE id = 1")
+	e.exec(e.source, "UPDATE items SET name = 'source' WHERE id = 2")
+	e.sync(task)
+
+	loadStates := func() map[string]models.SyncRowState {
+		var states []models.SyncRowState
+		database.DB.Where("task_id = ?", task.ID).Find(&states)
+		result := make(map[string]models.SyncRowState, len(states))
+		for _, st := range states {
+			result[st.PrimaryKey] = st
+		}
+		return result
+	}
+	before := loadStates()
+	for pk, st := range before {
+		if st.SourceHash != st.TargetHash {
+			t.Errorf("行 %s 写回后两端哈希应一致", pk)
+		}
+	}
+
+	// 写回的变更不应在之后的运行中被当作新变更来回同步
+	e.sync(task)
+	e.sync(task)
+
+	after := loadStates()
+	if len(after) != len(before) {
+		t.Fatalf("states = %d, want %d", len(after), len(before))
+	}
+	for pk, st := range before {
+		if !after[pk].SyncedAt.Equal(st.SyncedAt) || after[pk].SourceHash != st.SourceHash {
+			t.Errorf("行 %s 在没有变更时被重新同步", pk)
+		}
+	}
+	if got := e.mustItem(e.source, 1).Name; got != "target" {
+		t.Errorf("源行 1 = %q, want target", got)
+	}
+	if got := e.mustItem(e.target, 2).Name; got != "source" {
+		t.Errorf("目标行 2 = %q, want source", got)
+	}
+	if conflicts := e.conflicts(task); len(conflicts) != 0 {
+		t.Errorf("conflicts = %+v", conflicts)
+	}
+}
+
+func TestTwoWaySyncRecordsDeleteConflict(t *testing.T) {
+	e := newTestEnv(t, "")
+	e.insertItem(e.source, 1, item{Name: "a"})
+	task := e.newTask(twoWay)
+	e.sync(task)
+
+	e.exec(e.source, "DELETE FROM items WHERE id = 1")
+	e.exec(e.target, "UPDATE items SET name = 'target' WHERE id = 1")
+	e.sync(task)
+
+	conflicts := e.conflicts(task)
+	if len(conflicts) != 1 || conflicts[0].ConflictType != "delete_conflict" || conflicts[0].Status != "pending" {
+		t.Fatalf("conflicts = %+v", conflicts)
+	}
+	if got := e.mustItem(e.target, 1).Name; got != "target" {
+		t.Errorf("冲突行不应被删除，目标值为 %q", got)
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// 写入目标库
+//
+// 每批数据在一个目标库事务中写入，整批成功或整批回滚：
+//   - 暂时性错误（死锁、锁等待超时、连接中断等）按指数退避重试，重试用尽后视为目标库不可用
+//   - 其他错误说明批内有无法写入的行，将批次二分后分别写入，最终定位到单行，
+//     无法写入的行记录到死信表，其余行正常写入
+
+const (
+	// targetWriteRetries 暂时性错误的最大重试次数
+	targetWriteRetries = 3
+	// targetRetryBaseDelay 第一次重试前的等待时间，之后每次翻倍
+	targetRetryBaseDelay = time.Second
+)
+
+// runSeq 进程内的运行序号，保证同一时刻启动的运行ID不重复
+var runSeq atomic.Uint64
+
+// newRunID 生成同步运行ID：启动时间（精确到纳秒）加进程内序号
+func newRunID() string {
+	now := time.Now()
+	return fmt.Sprintf("%s%09d-%d", now.Format("20060102150405"), now.Nanosecond(), runSeq.Add(1))
+}
+
+// writeRows 写入一批行，返回写入死信表的行；只有暂时性错误重试用尽时返回错误
+func (s *SyncService) writeRows(targetDB *sql.DB, targetConn *models.DatabaseConnection, task *models.SyncTask, tableName string, rows []map[string]interface{}, primaryKeys []string, cache *dbconn.UpsertCache) ([]map[string]interface{}, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	err := s.writeWithRetry(task, targetConn, func() error {
+		return s.writeBatchTx(targetDB, targetConn, tableName, rows, primaryKeys, cache)
+	})
+	if err == nil {
+		return nil, nil
+	}
+	if dbconn.IsTransientError(err) {
+		return nil, err
+	}
+
+	if len(rows) == 1 {
+		s.recordDeadLetter(task, tableName, primaryKeys, rows[0], err)
+		return rows, nil
+	}
+
+	mid := len(rows) / 2
+	left, err := s.writeRows(targetDB, targetConn, task, tableName, rows[:mid], primaryKeys, cache)
+	if err != nil {
+		return nil, err
+	}
+	right, err := s.writeRows(targetDB, targetConn, task, tableName, rows[mid:], primaryKeys, cache)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+// writeBatchTx 在目标库事务中写入一批行，cache 不为 nil 时复用其中的表元数据
+func (s *SyncService) writeBatchTx(targetDB *sql.DB, targetConn *models.DatabaseConnection, tableName string, rows []map[string]interface{}, primaryKeys []string, cache *dbconn.UpsertCache) error {
+	tx, err := targetDB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := s.syncBatch(dbconn.WithUpsertCache(tx, cache), targetConn, tableName, rows, primaryKeys); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeWithRetry 写入目标库，暂时性错误按指数退避重试
+func (s *SyncService) writeWithRetry(task *models.SyncTask, targetConn *models.DatabaseConnection, write func() error) error {
+	delay := targetRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := write()
+		if err == nil || attempt >= targetWriteRetries || !dbconn.IsTransientError(err) {
+			return err
+		}
+		s.logInfo(task.ID, fmt.Sprintf("写入目标库 %s 失败，%v 后重试: %v", targetConn.Name, delay, err))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// recordDeadLetter 将无法写入的行记录到死信表
+func (s *SyncService) recordDeadLetter(task *models.SyncTask, tableName string, primaryKeys []string, row map[string]interface{}, writeErr error) {
+	rowJSON, _ := json.Marshal(row)
+	primaryKey := ""
+	if len(primaryKeys) > 0 {
+		primaryKey = s.buildPrimaryKeyValue(row, primaryKeys)
+	}
+
+	deadLetter := models.DeadLetterRow{
+		TaskID:     task.ID,
+		RunID:      task.RunID,
+		TargetDBID: task.TargetDBID,
+		TableName:  tableName,
+		PrimaryKey: primaryKey,
+		RowData:    string(rowJSON),
+		Error:      writeErr.Error(),
+		Status:     "pending",
+		Attempts:   1,
+	}
+	if err := database.DB.Create(&deadLetter).Error; err != nil {
+		s.logError(task.ID, fmt.Sprintf("记录死信失败: %v", err))
+	}
+	s.logError(task.ID, fmt.Sprintf("表 %s 主键 %s 写入失败，已记录到死信表: %v", tableName, primaryKey, writeErr))
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"zh.xyz/dv/sync/config"
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/dbconn"
+	"zh.xyz/dv/sync/models"
+)
+
+// itemsDDL 测试使用的表结构，源库和目标库相同
+const itemsDDL = `CREATE TABLE items (
+	id INTEGER PRIMARY KEY,
+	name TEXT,
+	qty INTEGER,
+	version INTEGER,
+	updated_at TEXT
+)`
+
+// testEnv 基于SQLite的测试环境：系统库、源库和目标库都是临时目录中的SQLite文件
+type testEnv struct {
+	t          *testing.T
+	source     *sql.DB // 直接操作源库数据
+	target     *sql.DB // 直接操作目标库数据
+	sourceConn models.DatabaseConnection
+	targetConn models.DatabaseConnection
+}
+
+// newTestEnv 初始化系统库，创建源库和目标库连接；targetDDL 为空时目标表与源表结构相同
+func newTestEnv(t *testing.T, targetDDL string) *testEnv {
+	t.Helper()
+	dir := t.TempDir()
+
+	prev := config.GlobalConfig
+	config.GlobalConfig = &config.Config{
+		Database: config.DatabaseConfig{Type: "sqlite", DBName: filepath.Join(dir, "system.db")},
+		SQLite:   config.SQLiteConfig{DataDirs: []string{dir}},
+		// 每个连接池只有一个连接：读取结果集期间在同一连接池上再查询会阻塞
+		Pool: config.PoolConfig{MaxOpenConns: 1, MaxIdleConns: 1},
+	}
+	if err := database.InitDatabase(); err != nil {
+		t.Fatalf("初始化系统库失败: %v", err)
+	}
+
+	e := &testEnv{t: t}
+	e.sourceConn = e.createConnection("source", filepath.Join(dir, "source.db"))
+	e.targetConn = e.createConnection("target", filepath.Join(dir, "target.db"))
+	e.source = e.open(e.sourceConn.Database)
+	e.target = e.open(e.targetConn.Database)
+
+	if targetDDL == "" {
+		targetDDL = itemsDDL
+	}
+	e.exec(e.source, itemsDDL)
+	e.exec(e.target, targetDDL)
+
+	t.Cleanup(func() {
+		e.source.Close()
+		e.target.Close()
+		dbconn.CloseConnection(e.sourceConn.ID)
+		dbconn.CloseConnection(e.targetConn.ID)
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+		config.GlobalConfig = prev
+	})
+	return e
+}
+
+func (e *testEnv) createConnection(name, path string) models.DatabaseConnection {
+	conn := models.DatabaseConnection{Name: name, Type: "sqlite", Database: path}
+	if err := database.DB.Create(&conn).Error; err != nil {
+		e.t.Fatalf("创建连接失败: %v", err)
+	}
+	return conn
+}
+
+func (e *testEnv) open(path string) *sql.DB {
+	db, err := dbconn.OpenDB(&dbconn.ConnOptions{Type: "sqlite", Database: path})
+	if err != nil {
+		e.t.Fatalf("打开 %s 失败: %v", path, err)
+	}
+	return db
+}
+
+// newTask 创建同步 items 表的任务，configure 可修改任务配置
+func (e *testEnv) newTask(configure func(task *models.SyncTask)) *models.SyncTask {
+	e.t.Helper()
+	task := &models.SyncTask{
+		Name:       "items",
+		SourceDBID: e.sourceConn.ID,
+		TargetDBID: e.targetConn.ID,
+		Direction:  "one_way",
+		TableName:  "items",
+		SyncType:   "scheduled",
+		CreatedBy:  1,
+	}
+	if configure != nil {
+		configure(task)
+	}
+	if err := database.DB.Create(task).Error; err != nil {
+		e.t.Fatalf("创建任务失败: %v", err)
+	}
+	target := models.SyncTaskTarget{TaskID: task.ID, TargetDBID: e.targetConn.ID}
+	if err := database.DB.Create(&target).Error; err != nil {
+		e.t.Fatalf("创建任务目标库失败: %v", err)
+	}
+	return task
+}
+
+func (e *testEnv) sync(task *models.SyncTask) {
+	e.t.Helper()
+	if err := (&SyncService{}).syncTable(task); err != nil {
+		e.t.Fatalf("同步失败: %v", err)
+	}
+}
+
+func (e *testEnv) exec(db *sql.DB, query string, args ...interface{}) {
+	e.t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		e.t.Fatalf("执行 %s 失败: %v", query, err)
+	}
+}
+
+// item items 表的一行
+type item struct {
+	Name      string
+	Qty       int64
+	Version   int64
+	UpdatedAt string
+}
+
+func (e *testEnv) insertItem(db *sql.DB, id int, it item) {
+	e.t.Helper()
+	e.exec(db, "INSERT INTO items (id, name, qty, version, updated_at) VALUES (?, ?, ?, ?, ?)", id, it.Name, it.Qty, it.Version, it.UpdatedAt)
+}
+
+// getItem 读取一行，行不存在时 ok 为 false
+func (e *testEnv) getItem(db *sql.DB, id int) (it item, ok bool) {
+	e.t.Helper()
+	err := db.QueryRow("SELECT name, qty, version, updated_at FROM items WHERE id = ?", id).Scan(&it.Name, &it.Qty, &it.Version, &it.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return it, false
+	}
+	if err != nil {
+		e.t.Fatalf("读取行 %d 失败: %v", id, err)
+	}
+	return it, true
+}
+
+func (e *testEnv) mustItem(db *sql.DB, id int) item {
+	e.t.Helper()
+	it, ok := e.getItem(db, id)
+	if !ok {
+		e.t.Fatalf("行 %d 不存在", id)
+	}
+	return it
+}
+
+func (e *testEnv) conflicts(task *models.SyncTask) []models.DataConflict {
+	e.t.Helper()
+	var conflicts []models.DataConflict
+	if err := database.DB.Where("task_id = ?", task.ID).Order("id").Find(&conflicts).Error; err != nil {
+		e.t.Fatal(err)
+	}
+	return conflicts
+}
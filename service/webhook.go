@@ -0,0 +1,303 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+)
+
+// webhook 事件类型
+const (
+	WebhookEventTaskStarted      = "task.started"
+	WebhookEventTaskSucceeded    = "task.succeeded"
+	WebhookEventTaskFailed       = "task.failed"
+	WebhookEventTaskCancelled    = "task.cancelled"
+	WebhookEventConflictCreated  = "conflict.created"
+	WebhookEventConflictResolved = "conflict.resolved"
+	WebhookEventSchemaDrift      = "schema.drift"
+)
+
+// WebhookEvents 所有支持的webhook事件
+var WebhookEvents = []string{
+	WebhookEventTaskStarted,
+	WebhookEventTaskSucceeded,
+	WebhookEventTaskFailed,
+	WebhookEventTaskCancelled,
+	WebhookEventConflictCreated,
+	WebhookEventConflictResolved,
+	WebhookEventSchemaDrift,
+}
+
+const (
+	webhookMaxAttempts     = 6                // 最多投递次数（含首次）
+	webhookBaseBackoff     = 30 * time.Second // 首次重试间隔，之后按指数增长
+	webhookMaxBackoff      = time.Hour
+	webhookDeliveryLease   = 2 * time.Minute // 投递中的记录在此期间不会被重复领取
+	webhookMaxResponseBody = 2048            // 保存的响应内容最大长度
+	webhookRetryBatch      = 100             // 每次重试扫描处理的记录数
+)
+
+// webhookPayload 投递的JSON内容
+type webhookPayload struct {
+	Event     string      `json:"event"`
+	TaskID    uint        `json:"task_id,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// InitWebhookWorker 启动webhook重试任务
+func InitWebhookWorker() {
+	if _, err := cronManager.AddFunc("@every 30s", RetryWebhookDeliveries); err != nil {
+		log.Printf("启动webhook重试任务失败: %v", err)
+	}
+}
+
+// IsWebhookEvent 判断是否为支持的webhook事件
+func IsWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateWebhookSecret 生成随机签名密钥
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SignWebhookPayload 计算payload的签名：HMAC-SHA256(secret, timestamp + "." + body)
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSubscribed 判断webhook是否订阅了事件
+func webhookSubscribed(webhook *models.Webhook, event string, taskID uint) bool {
+	if webhook.TaskID != 0 && webhook.TaskID != taskID {
+		return false
+	}
+	events := strings.TrimSpace(webhook.Events)
+	if events == "" || events == "*" {
+		return true
+	}
+	for _, e := range strings.Split(events, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// DispatchWebhookEvent 为订阅了事件的webhook创建投递记录并异步投递
+func DispatchWebhookEvent(event string, taskID uint, data interface{}) {
+	var webhooks []models.Webhook
+	if err := database.DB.Where("active = ?", true).Find(&webhooks).Error; err != nil {
+		log.Printf("查询webhook失败: %v", err)
+		return
+	}
+
+	var payload []byte
+	for i := range webhooks {
+		if !webhookSubscribed(&webhooks[i], event, taskID) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(webhookPayload{Event: event, TaskID: taskID, CreatedAt: time.Now(), Data: data})
+			if err != nil {
+				log.Printf("序列化webhook事件失败: %v", err)
+				return
+			}
+		}
+
+		now := time.Now()
+		delivery := models.WebhookDelivery{
+			WebhookID:   webhooks[i].ID,
+			EventType:   event,
+			Payload:     string(payload),
+			Status:      "pending",
+			NextRetryAt: &now,
+		}
+		if err := database.DB.Create(&delivery).Error; err != nil {
+			log.Printf("创建webhook投递记录失败: %v", err)
+			continue
+		}
+		go attemptWebhookDelivery(delivery.ID)
+	}
+}
+
+// RedeliverWebhook 以原投递内容创建新的投递记录并立即投递
+func RedeliverWebhook(original *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		WebhookID:    original.WebhookID,
+		EventType:    original.EventType,
+		Payload:      original.Payload,
+		Status:       "pending",
+		NextRetryAt:  &now,
+		RedeliveryOf: original.ID,
+	}
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	go attemptWebhookDelivery(delivery.ID)
+	return &delivery, nil
+}
+
+// RetryWebhookDeliveries 投递到期的待重试记录
+func RetryWebhookDeliveries() {
+	var ids []uint
+	database.DB.Model(&models.WebhookDelivery{}).
+		Where("status IN ? AND next_retry_at <= ?", []string{"pending", "retrying"}, time.Now()).
+		Order("next_retry_at").Limit(webhookRetryBatch).
+		Pluck("id", &ids)
+
+	for _, id := range ids {
+		attemptWebhookDelivery(id)
+	}
+}
+
+// attemptWebhookDelivery 投递一次，失败时按指数退避安排重试，超过最大次数标记为失败
+func attemptWebhookDelivery(deliveryID uint) {
+	// 领取投递记录，避免即时投递和重试任务重复投递
+	now := time.Now()
+	lease := now.Add(webhookDeliveryLease)
+	result := database.DB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status IN ? AND next_retry_at <= ?", deliveryID, []string{"pending", "retrying"}, now).
+		Update("next_retry_at", lease)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	if err := database.DB.First(&delivery, deliveryID).Error; err != nil {
+		return
+	}
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, delivery.WebhookID).Error; err != nil {
+		delivery.Status = "failed"
+		delivery.ErrorMessage = "webhook不存在"
+		delivery.NextRetryAt = nil
+		database.DB.Save(&delivery)
+		return
+	}
+
+	delivery.Attempts++
+	code, body, err := postWebhook(&webhook, &delivery)
+	delivery.ResponseCode = code
+	delivery.ResponseBody = body
+
+	if err == nil {
+		delivered := time.Now()
+		delivery.Status = "succeeded"
+		delivery.ErrorMessage = ""
+		delivery.DeliveredAt = &delivered
+		delivery.NextRetryAt = nil
+	} else {
+		delivery.ErrorMessage = err.Error()
+		if delivery.Attempts >= webhookMaxAttempts || !webhook.Active {
+			delivery.Status = "failed"
+			delivery.NextRetryAt = nil
+		} else {
+			next := time.Now().Add(webhookBackoff(delivery.Attempts))
+			delivery.Status = "retrying"
+			delivery.NextRetryAt = &next
+		}
+	}
+	database.DB.Save(&delivery)
+}
+
+// webhookBackoff 第n次失败后的重试间隔
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// postWebhook 发送签名请求，非2xx响应视为失败
+func postWebhook(webhook *models.Webhook, delivery *models.WebhookDelivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "db-sync-webhook")
+	req.Header.Set("X-Sync-Event", delivery.EventType)
+	req.Header.Set("X-Sync-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Sync-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Sync-Signature", SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("webhook返回状态码 %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+// taskEventData 任务事件的数据
+func taskEventData(task *models.SyncTask, runErr error) map[string]interface{} {
+	data := map[string]interface{}{
+		"task_id":    task.ID,
+		"task_name":  task.Name,
+		"table_name": task.TableName,
+		"status":     task.Status,
+	}
+	if runErr != nil {
+		data["error"] = runErr.Error()
+	}
+	return data
+}
+
+// PublishTaskCancelled 发布任务取消事件
+func PublishTaskCancelled(task *models.SyncTask) {
+	DispatchWebhookEvent(WebhookEventTaskCancelled, task.ID, taskEventData(task, nil))
+}
+
+// conflictEventData 冲突事件的数据
+func conflictEventData(conflict *models.DataConflict) map[string]interface{} {
+	return map[string]interface{}{
+		"conflict_id":   conflict.ID,
+		"task_id":       conflict.TaskID,
+		"table_name":    conflict.TableName,
+		"primary_key":   conflict.PrimaryKey,
+		"conflict_type": conflict.ConflictType,
+		"status":        conflict.Status,
+		"resolution":    conflict.Resolution,
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"zh.xyz/dv/sync/database"
+	"zh.xyz/dv/sync/models"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	body := []byte(`{"event":"task.failed"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := SignWebhookPayload("secret", 1700000000, body); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+	// 时间戳、内容和密钥都参与签名
+	for name, got := range map[string]string{
+		"timestamp": SignWebhookPayload("secret", 1700000001, body),
+		"body":      SignWebhookPayload("secret", 1700000000, []byte(`{"event":"task.succeeded"}`)),
+		"secret":    SignWebhookPayload("other", 1700000000, body),
+	} {
+		if got == want {
+			t.Errorf("修改%s后签名不变", name)
+		}
+	}
+}
+
+func TestWebhookSubscribed(t *testing.T) {
+	tests := []struct {
+		webhook models.Webhook
+		event   string
+		taskID  uint
+		want    bool
+	}{
+		{models.Webhook{}, WebhookEventTaskFailed, 1, true},
+		{models.Webhook{Events: "*"}, WebhookEventTaskFailed, 1, true},
+		{models.Webhook{Events: "task.failed, conflict.created"}, WebhookEventConflictCreated, 1, true},
+		{models.Webhook{Events: "task.failed"}, WebhookEventTaskSucceeded, 1, false},
+		{models.Webhook{TaskID: 2}, WebhookEventTaskFailed, 1, false},
+		{models.Webhook{TaskID: 1, Events: "task.failed"}, WebhookEventTaskFailed, 1, true},
+	}
+	for _, tt := range tests {
+		if got := webhookSubscribed(&tt.webhook, tt.event, tt.taskID); got != tt.want {
+			t.Errorf("webhookSubscribed(%+v, %s, %d) = %v, want %v", tt.webhook, tt.event, tt.taskID, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		10: time.Hour,
+	} {
+		if got := webhookBackoff(attempts); got != want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+// newWebhookDelivery 创建指向 url 的webhook及一条到期的投递记录
+func newWebhookDelivery(t *testing.T, url string) models.WebhookDelivery {
+	t.Helper()
+	webhook := models.Webhook{Name: "test", URL: url, Secret: "secret"}
+	if err := database.DB.Create(&webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		WebhookID:   webhook.ID,
+		EventType:   WebhookEventTaskFailed,
+		Payload:     `{"event":"task.failed","task_id":1}`,
+		Status:      "pending",
+		NextRetryAt: &now,
+	}
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func reloadDelivery(t *testing.T, id uint) models.WebhookDelivery {
+	t.Helper()
+	var delivery models.WebhookDelivery
+	if err := database.DB.First(&delivery, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func TestWebhookDeliveryIsSigned(t *testing.T) {
+	newTestEnv(t, "")
+	verified := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-Sync-Timestamp"), 10, 64)
+		switch {
+		case err != nil:
+			verified <- err
+		case !hmac.Equal([]byte(r.Header.Get("X-Sync-Signature")), []byte(SignWebhookPayload("secret", timestamp, body))):
+			verified <- errors.New("签名不正确")
+		case r.Header.Get("X-Sync-Event") != WebhookEventTaskFailed:
+			verified <- errors.New("事件头不正确")
+		default:
+			verified <- nil
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	delivery := newWebhookDelivery(t, server.URL)
+	attemptWebhookDelivery(delivery.ID)
+
+	if err := <-verified; err != nil {
+		t.Fatalf("签名校验失败: %v", err)
+	}
+	stored := reloadDelivery(t, delivery.ID)
+	if stored.Status != "succeeded" || stored.Attempts != 1 || stored.ResponseCode != 200 || stored.ResponseBody != "ok" || stored.DeliveredAt == nil || stored.NextRetryAt != nil {
+		t.Errorf("delivery = %+v", stored)
+	}
+}
+
+func TestWebhookDeliveryRetriesWithBackoff(t *testing.T) {
+	newTestEnv(t, "")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	delivery := newWebhookDelivery(t, server.URL)
+	before := time.Now()
+	attemptWebhookDelivery(delivery.ID)
+
+	stored := reloadDelivery(t, delivery.ID)
+	if stored.Status != "retrying" || stored.Attempts != 1 || stored.ResponseCode != http.StatusServiceUnavailable || stored.ErrorMessage == "" {
+		t.Fatalf("delivery = %+v", stored)
+	}
+	if stored.NextRetryAt == nil || stored.NextRetryAt.Before(before.Add(webhookBaseBackoff)) {
+		t.Errorf("next_retry_at = %v, want >= %v", stored.NextRetryAt, before.Add(webhookBaseBackoff))
+	}
+
+	// 未到重试时间不会重复投递
+	attemptWebhookDelivery(delivery.ID)
+	RetryWebhookDeliveries()
+	if requests != 1 {
+		t.Errorf("发送了 %d 次请求, want 1", requests)
+	}
+
+	// 达到最大次数后标记为失败
+	database.DB.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).
+		Updates(map[string]interface{}{"attempts": webhookMaxAttempts - 1, "next_retry_at": time.Now()})
+	RetryWebhookDeliveries()
+	if stored := reloadDelivery(t, delivery.ID); stored.Status != "failed" || stored.Attempts != webhookMaxAttempts || stored.NextRetryAt != nil {
+		t.Errorf("delivery = %+v", stored)
+	}
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"zh.xyz/dv/sync/config"
+)
+
+// 加密后的密文格式：enc:v1:<主密钥ID>:<被主密钥加密的数据密钥>:<被数据密钥加密的内容>
+// 每个密文使用独立的随机数据密钥（信封加密），主密钥只用于加密数据密钥
+const encryptedSecretPrefix = "enc:v1:"
+
+// 主密钥环境变量，优先于配置文件
+const (
+	MasterKeyEnv         = "DB_SYNC_MASTER_KEY"
+	PreviousMasterKeyEnv = "DB_SYNC_PREVIOUS_MASTER_KEYS" // 逗号分隔，轮换密钥时用于解密旧密文
+)
+
+var ErrMasterKeyMissing = errors.New("未配置主密钥")
+
+// masterKey 主密钥
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// secretKeyring 当前主密钥及可用于解密的历史主密钥
+type secretKeyring struct {
+	active *masterKey
+	keys   map[string]*masterKey
+}
+
+var (
+	keyringOnce sync.Once
+	keyring     *secretKeyring
+	keyringErr  error
+)
+
+// getKeyring 加载主密钥（仅加载一次）
+func getKeyring() (*secretKeyring, error) {
+	keyringOnce.Do(func() {
+		keyring, keyringErr = loadKeyring()
+		if keyringErr == nil && keyring.active == nil {
+			log.Printf("警告: 未配置主密钥（%s 或 security.master_key），数据库连接密码将以明文保存", MasterKeyEnv)
+		}
+	})
+	return keyring, keyringErr
+}
+
+// loadKeyring 从环境变量或配置读取主密钥（base64编码的32字节密钥）
+func loadKeyring() (*secretKeyring, error) {
+	var cfg config.SecurityConfig
+	if config.GlobalConfig != nil {
+		cfg = config.GlobalConfig.Security
+	}
+
+	active := cfg.MasterKey
+	if env := os.Getenv(MasterKeyEnv); env != "" {
+		active = env
+	}
+	previous := cfg.PreviousMasterKeys
+	if env := os.Getenv(PreviousMasterKeyEnv); env != "" {
+		previous = strings.Split(env, ",")
+	}
+
+	ring := &secretKeyring{keys: make(map[string]*masterKey)}
+	if active != "" {
+		key, err := parseMasterKey(active)
+		if err != nil {
+			return nil, fmt.Errorf("主密钥无效: %v", err)
+		}
+		ring.active = key
+		ring.keys[key.id] = key
+	}
+	for _, encoded := range previous {
+		encoded = strings.TrimSpace(encoded)
+		if encoded == "" {
+			continue
+		}
+		key, err := parseMasterKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("历史主密钥无效: %v", err)
+		}
+		if _, ok := ring.keys[key.id]; !ok {
+			ring.keys[key.id] = key
+		}
+	}
+	return ring, nil
+}
+
+// parseMasterKey 解析base64编码的AES-256密钥，密钥ID取密钥SHA-256的前8个字节
+func parseMasterKey(encoded string) (*masterKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("密钥长度必须为32字节，实际为%d字节", len(raw))
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &masterKey{id: hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// InitSecretKeys 校验主密钥配置，启动时调用以尽早发现错误
+func InitSecretKeys() error {
+	_, err := getKeyring()
+	return err
+}
+
+// SecretEncryptionEnabled 是否配置了主密钥
+func SecretEncryptionEnabled() bool {
+	ring, err := getKeyring()
+	return err == nil && ring.active != nil
+}
+
+// IsEncryptedSecret 判断是否为加密后的密文
+func IsEncryptedSecret(s string) bool {
+	return strings.HasPrefix(s, encryptedSecretPrefix)
+}
+
+// EncryptSecret 使用当前主密钥加密敏感信息，空值和已加密的值原样返回；未配置主密钥时原样返回
+func EncryptSecret(plain string) (string, error) {
+	if plain == "" || IsEncryptedSecret(plain) {
+		return plain, nil
+	}
+	ring, err := getKeyring()
+	if err != nil {
+		return "", err
+	}
+	if ring.active == nil {
+		return plain, nil
+	}
+	return encryptWithKey(ring.active, plain)
+}
+
+// DecryptSecret 解密敏感信息，非密文（历史明文数据）原样返回
+func DecryptSecret(s string) (string, error) {
+	if !IsEncryptedSecret(s) {
+		return s, nil
+	}
+	ring, err := getKeyring()
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.Split(strings.TrimPrefix(s, encryptedSecretPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("密文格式错误")
+	}
+	key, ok := ring.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("主密钥 %s 未配置，无法解密", parts[0])
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("密文格式错误")
+	}
+	dataKey, err := openSealed(key.aead, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("解密数据密钥失败: %v", err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("密文格式错误")
+	}
+	plain, err := openSealed(dataAEAD, sealed)
+	if err != nil {
+		return "", fmt.Errorf("解密失败: %v", err)
+	}
+	return string(plain), nil
+}
+
+// ReencryptSecret 使用当前主密钥和新的数据密钥重新加密（用于轮换主密钥）
+func ReencryptSecret(s string) (string, error) {
+	ring, err := getKeyring()
+	if err != nil {
+		return "", err
+	}
+	if ring.active == nil {
+		return "", ErrMasterKeyMissing
+	}
+	plain, err := DecryptSecret(s)
+	if err != nil {
+		return "", err
+	}
+	if plain == "" {
+		return plain, nil
+	}
+	return encryptWithKey(ring.active, plain)
+}
+
+// encryptWithKey 生成随机数据密钥加密内容，再用主密钥加密数据密钥
+func encryptWithKey(key *masterKey, plain string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(dataAEAD, []byte(plain))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(key.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedSecretPrefix + key.id + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// seal 加密并将随机nonce放在密文前
+func seal(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+func openSealed(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("密文长度错误")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
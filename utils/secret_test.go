@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+
+	"zh.xyz/dv/sync/config"
+)
+
+var (
+	testOldKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	testNewKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+)
+
+// withMasterKeys 使用指定的主密钥重新加载密钥环
+func withMasterKeys(t *testing.T, active string, previous ...string) {
+	t.Helper()
+	t.Setenv(MasterKeyEnv, "")
+	t.Setenv(PreviousMasterKeyEnv, "")
+	prev := config.GlobalConfig
+	config.GlobalConfig = &config.Config{Security: config.SecurityConfig{MasterKey: active, PreviousMasterKeys: previous}}
+	keyringOnce = sync.Once{}
+	t.Cleanup(func() {
+		config.GlobalConfig = prev
+		keyringOnce = sync.Once{}
+	})
+}
+
+func TestEncryptSecretRoundTrip(t *testing.T) {
+	withMasterKeys(t, testOldKey)
+
+	encrypted, err := EncryptSecret("p@ss:word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedSecret(encrypted) || strings.Contains(encrypted, "p@ss") {
+		t.Fatalf("encrypted = %s", encrypted)
+	}
+	if again, _ := EncryptSecret("p@ss:word"); again == encrypted {
+		t.Error("每次加密应使用新的数据密钥和nonce")
+	}
+	if plain, err := DecryptSecret(encrypted); err != nil || plain != "p@ss:word" {
+		t.Errorf("DecryptSecret = %q, %v", plain, err)
+	}
+
+	// 空值、已加密的值和历史明文原样返回
+	if got, _ := EncryptSecret(""); got != "" {
+		t.Errorf("EncryptSecret(\"\") = %q", got)
+	}
+	if got, _ := EncryptSecret(encrypted); got != encrypted {
+		t.Error("已加密的值不应再次加密")
+	}
+	if got, _ := DecryptSecret("plain"); got != "plain" {
+		t.Errorf("DecryptSecret(plain) = %q", got)
+	}
+}
+
+func TestDecryptSecretRejectsTampering(t *testing.T) {
+	withMasterKeys(t, testOldKey)
+	encrypted, _ := EncryptSecret("secret")
+	parts := strings.Split(encrypted, ":")
+
+	sealed, _ := base64.StdEncoding.DecodeString(parts[4])
+	sealed[len(sealed)-1] ^= 1
+	parts[4] = base64.StdEncoding.EncodeToString(sealed)
+	if _, err := DecryptSecret(strings.Join(parts, ":")); err == nil {
+		t.Error("篡改的密文不应解密成功")
+	}
+	if _, err := DecryptSecret("enc:v1:broken"); err == nil {
+		t.Error("格式错误的密文不应解密成功")
+	}
+}
+
+func TestSecretEncryptionDisabledWithoutMasterKey(t *testing.T) {
+	withMasterKeys(t, "")
+
+	if SecretEncryptionEnabled() {
+		t.Error("未配置主密钥时不应启用加密")
+	}
+	if got, err := EncryptSecret("secret"); err != nil || got != "secret" {
+		t.Errorf("EncryptSecret = %q, %v", got, err)
+	}
+	if _, err := ReencryptSecret("secret"); err != ErrMasterKeyMissing {
+		t.Errorf("err = %v, want ErrMasterKeyMissing", err)
+	}
+}
+
+func TestInvalidMasterKey(t *testing.T) {
+	withMasterKeys(t, base64.StdEncoding.EncodeToString([]byte("short")))
+	if err := InitSecretKeys(); err == nil {
+		t.Error("长度错误的主密钥应报错")
+	}
+}
+
+func TestReencryptSecretRotatesMasterKey(t *testing.T) {
+	withMasterKeys(t, testOldKey)
+	old, _ := EncryptSecret("secret")
+
+	// 轮换后旧密文仍可用历史主密钥解密，重新加密后使用新主密钥
+	withMasterKeys(t, testNewKey, testOldKey)
+	if plain, err := DecryptSecret(old); err != nil || plain != "secret" {
+		t.Fatalf("DecryptSecret = %q, %v", plain, err)
+	}
+	rotated, err := ReencryptSecret(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Split(rotated, ":")[2] == strings.Split(old, ":")[2] {
+		t.Error("重新加密后应使用新的主密钥")
+	}
+	// 明文（未加密的历史数据）也会被加密
+	if plain, err := ReencryptSecret("legacy"); err != nil || !IsEncryptedSecret(plain) {
+		t.Errorf("ReencryptSecret(legacy) = %q, %v", plain, err)
+	}
+
+	// 移除历史主密钥后新密文仍可解密，旧密文不能
+	withMasterKeys(t, testNewKey)
+	if plain, err := DecryptSecret(rotated); err != nil || plain != "secret" {
+		t.Errorf("DecryptSecret = %q, %v", plain, err)
+	}
+	if _, err := DecryptSecret(old); err == nil {
+		t.Error("缺少历史主密钥时不应解密旧密文")
+	}
+}
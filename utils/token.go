@@ -1,45 +1,97 @@
 package utils
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"zh.xyz/dv/sync/config"
 )
 
-// GenerateConflictViewToken 生成冲突查看token（简化版本，实际可以使用JWT）
-func GenerateConflictViewToken(data map[string]interface{}) (string, error) {
-	data["exp"] = time.Now().Add(24 * time.Hour).Unix()
+// 冲突操作链接允许的操作
+const (
+	ConflictActionView          = "view"           // 查看冲突
+	ConflictActionResolveSource = "resolve_source" // 以源数据库为准处理冲突
+	ConflictActionResolveTarget = "resolve_target" // 以目标数据库为准处理冲突
+)
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return "", err
-	}
+// conflictActionAudience 冲突操作token的受众，与登录token区分
+const conflictActionAudience = "conflict-action"
 
-	// Base64编码
-	return base64.URLEncoding.EncodeToString(jsonData), nil
+// ConflictActionClaims 冲突操作链接token的声明，绑定冲突ID、接收人和允许的操作
+type ConflictActionClaims struct {
+	ConflictID uint   `json:"conflict_id"`
+	UserID     uint   `json:"user_id"`
+	Action     string `json:"action"`
+	jwt.RegisteredClaims
 }
 
-// ParseConflictViewToken 解析冲突查看token
-func ParseConflictViewToken(token string) (map[string]interface{}, error) {
-	data, err := base64.URLEncoding.DecodeString(token)
+// GenerateConflictActionToken 生成签名的冲突操作token，返回token及其唯一ID（用于撤销）
+func GenerateConflictActionToken(conflictID, userID uint, action string, ttl time.Duration) (string, string, error) {
+	tokenID, err := randomTokenID()
 	if err != nil {
-		return nil, err
+		return "", "", err
 	}
 
-	var result map[string]interface{}
-	err = json.Unmarshal(data, &result)
+	now := time.Now()
+	claims := ConflictActionClaims{
+		ConflictID: conflictID,
+		UserID:     userID,
+		Action:     action,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Audience:  jwt.ClaimStrings{conflictActionAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "db-sync-system",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(conflictActionKey())
 	if err != nil {
-		return nil, err
+		return "", "", err
 	}
+	return signed, tokenID, nil
+}
+
+// ParseConflictActionToken 校验签名并解析冲突操作token
+func ParseConflictActionToken(tokenString string) (*ConflictActionClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ConflictActionClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return conflictActionKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(conflictActionAudience))
 
-	// 检查过期时间
-	if exp, ok := result["exp"].(float64); ok {
-		if time.Now().Unix() > int64(exp) {
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
 			return nil, ErrTokenExpired
 		}
+		return nil, err
 	}
 
-	return result, nil
+	if claims, ok := token.Claims.(*ConflictActionClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+// conflictActionKey 由JWT密钥派生冲突操作token的签名密钥，使其无法被当作登录token使用
+func conflictActionKey() []byte {
+	mac := hmac.New(sha256.New, []byte(config.GlobalConfig.JWT.Secret))
+	mac.Write([]byte(conflictActionAudience))
+	return mac.Sum(nil)
+}
+
+func randomTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
 var ErrTokenExpired = &TokenError{Message: "token已过期"}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"zh.xyz/dv/sync/config"
+)
+
+func withJWTSecret(t *testing.T, secret string) {
+	t.Helper()
+	prev := config.GlobalConfig
+	config.GlobalConfig = &config.Config{JWT: config.JWTConfig{Secret: secret, ExpireTime: 1}}
+	t.Cleanup(func() { config.GlobalConfig = prev })
+}
+
+func TestConflictActionTokenRoundTrip(t *testing.T) {
+	withJWTSecret(t, "secret")
+
+	token, tokenID, err := GenerateConflictActionToken(3, 7, ConflictActionResolveSource, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseConflictActionToken(token)
+	if err != nil {
+		t.Fatalf("ParseConflictActionToken: %v", err)
+	}
+	if claims.ConflictID != 3 || claims.UserID != 7 || claims.Action != ConflictActionResolveSource || claims.ID != tokenID {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	_, otherID, _ := GenerateConflictActionToken(3, 7, ConflictActionResolveSource, time.Hour)
+	if otherID == tokenID {
+		t.Error("每个token应有唯一ID")
+	}
+}
+
+func TestConflictActionTokenExpired(t *testing.T) {
+	withJWTSecret(t, "secret")
+
+	token, _, err := GenerateConflictActionToken(3, 7, ConflictActionView, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseConflictActionToken(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("err = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestConflictActionTokenRejectsForeignSignatures(t *testing.T) {
+	withJWTSecret(t, "secret")
+	token, _, _ := GenerateConflictActionToken(3, 7, ConflictActionView, time.Hour)
+
+	// 被篡改的token
+	if _, err := ParseConflictActionToken(token[:len(token)-2] + "xx"); err == nil {
+		t.Error("篡改签名的token不应通过校验")
+	}
+
+	// 登录token与冲突操作token使用不同的密钥和受众，不能互相替代
+	login, err := GenerateToken(7, "admin", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseConflictActionToken(login); err == nil {
+		t.Error("登录token不应被当作冲突操作token")
+	}
+	if _, err := ParseToken(token); err == nil {
+		t.Error("冲突操作token不应被当作登录token")
+	}
+
+	// 更换JWT密钥后旧链接失效
+	withJWTSecret(t, "rotated")
+	if _, err := ParseConflictActionToken(token); err == nil {
+		t.Error("更换密钥后旧token不应通过校验")
+	}
+}